@@ -0,0 +1,391 @@
+package capacity
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	jfauth "github.com/jfrog/jfrog-client-go/auth"
+	jflog "github.com/jfrog/jfrog-client-go/utils/log"
+	"jfrog.com/datasim/remoteartifacts"
+)
+
+// Defaults used for the settings left unset in Config
+const (
+	DefaultIntervalSecs      = 300
+	DefaultCalculateWaitSecs = 30
+	DefaultDurationSecs      = 3600
+	// The DB estimates are rough averages of the rows of a file and of a
+	// binary, with their properties and indexes
+	DefaultDbBytesPerFile   = 1024
+	DefaultDbBytesPerBinary = 256
+)
+
+// DefaultProjectionDays are the horizons of the projections
+var DefaultProjectionDays = []int{30, 90, 365}
+
+// Config of the capacity planning, sampling api/storageinfo of the DUTs
+// before, during and after the simulations to project their growth, or on its
+// own for DurationSecs with the capacity command
+type Config struct {
+	Enabled      bool `yaml:"enabled"`
+	IntervalSecs int  `yaml:"intervalsecs"`
+	DurationSecs int  `yaml:"durationsecs"`
+	// Calculate, true by default, recalculates the storage summary before each
+	// sample, waiting CalculateWaitSecs for it, as Artifactory otherwise only
+	// refreshes it periodically
+	Calculate         *bool `yaml:"calculate"`
+	CalculateWaitSecs int   `yaml:"calculatewaitsecs"`
+	// The daily workload is the sampled one, simulated or not, sustained
+	// WorkloadHoursPerDay hours a day, 24 by default, or scaled to DailyFiles
+	// new files a day when set
+	WorkloadHoursPerDay float64 `yaml:"workloadhoursperday"`
+	DailyFiles          int64   `yaml:"dailyfiles"`
+	ProjectionDays      []int   `yaml:"projectiondays"`
+	DbBytesPerFile      int64   `yaml:"dbbytesperfile"`
+	DbBytesPerBinary    int64   `yaml:"dbbytesperbinary"`
+	ReportFile          string  `yaml:"reportfile"`
+}
+
+// withDefaults returns a copy of the config with unset values defaulted
+func (c Config) withDefaults() Config {
+	if c.IntervalSecs <= 0 {
+		c.IntervalSecs = DefaultIntervalSecs
+	}
+	if c.DurationSecs <= 0 {
+		c.DurationSecs = DefaultDurationSecs
+	}
+	if c.Calculate == nil {
+		calculate := true
+		c.Calculate = &calculate
+	}
+	if c.CalculateWaitSecs <= 0 {
+		c.CalculateWaitSecs = DefaultCalculateWaitSecs
+	}
+	if c.WorkloadHoursPerDay <= 0 {
+		c.WorkloadHoursPerDay = 24
+	}
+	if len(c.ProjectionDays) == 0 {
+		c.ProjectionDays = DefaultProjectionDays
+	}
+	if c.DbBytesPerFile <= 0 {
+		c.DbBytesPerFile = DefaultDbBytesPerFile
+	}
+	if c.DbBytesPerBinary <= 0 {
+		c.DbBytesPerBinary = DefaultDbBytesPerBinary
+	}
+	return c
+}
+
+// Duration is how long the capacity command samples the DUTs
+func (c Config) Duration() time.Duration {
+	return time.Duration(c.withDefaults().DurationSecs) * time.Second
+}
+
+// Sample is the storage summary of a DUT at a time
+type Sample struct {
+	Time          time.Time
+	BinariesCount int64
+	BinariesSize  int64
+	ArtifactsSize int64
+	FilesCount    int64
+	// SizeResolution is the least growth the binaries sizes can tell
+	SizeResolution int64
+	Repos          map[string]RepoSample
+}
+
+// RepoSample is the storage of a repo at a time
+type RepoSample struct {
+	UsedSpace  int64
+	FilesCount int64
+}
+
+// Growth are the daily growths of the workload
+type Growth struct {
+	BinariesCount float64 `json:"binariesCount"`
+	BinariesSize  float64 `json:"binariesSize"`
+	ArtifactsSize float64 `json:"artifactsSize"`
+	FilesCount    float64 `json:"filesCount"`
+	DbSize        float64 `json:"dbSize"`
+}
+
+// Usage is the disk and DB usage of a DUT, current or projected
+type Usage struct {
+	Days          int   `json:"days"`
+	BinariesCount int64 `json:"binariesCount"`
+	FilesCount    int64 `json:"filesCount"`
+	DiskBytes     int64 `json:"diskBytes"`
+	DbBytes       int64 `json:"dbBytes"`
+}
+
+// RepoGrowth is the growth of a repo and its projected usage
+type RepoGrowth struct {
+	Key            string  `json:"key"`
+	UsedSpace      int64   `json:"usedSpace"`
+	DailyBytes     float64 `json:"dailyBytes"`
+	DailyFiles     float64 `json:"dailyFiles"`
+	ProjectedSpace []int64 `json:"projectedSpace"`
+}
+
+// Projection is the capacity plan of a DUT
+type Projection struct {
+	Dut          string  `json:"dut"`
+	Samples      int     `json:"samples"`
+	DurationSecs float64 `json:"durationSecs"`
+	Daily        Growth  `json:"daily"`
+	// SizeResolution is the least binaries size growth the samples can tell
+	SizeResolution int64        `json:"sizeResolution"`
+	Current        Usage        `json:"current"`
+	Projected      []Usage      `json:"projected"`
+	Repos          []RepoGrowth `json:"repos"`
+}
+
+// Sampler samples the storage summary of a DUT in the background
+type Sampler struct {
+	dut     string
+	details *jfauth.ServiceDetails
+	cfg     Config
+	mu      sync.Mutex
+	samples []Sample
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// NewSampler creates a sampler of the DUT
+func NewSampler(dut string, details *jfauth.ServiceDetails, cfg Config) *Sampler {
+	return &Sampler{
+		dut:     dut,
+		details: details,
+		cfg:     cfg.withDefaults(),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+// Start samples the DUT now, then every interval until Stop
+func (s *Sampler) Start() {
+	s.sample()
+	go func() {
+		defer close(s.done)
+		ticker := time.NewTicker(time.Duration(s.cfg.IntervalSecs) * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+				s.sample()
+			}
+		}
+	}()
+}
+
+// StartAll starts the samplers concurrently, returning once each took its
+// first sample, as they may each wait for a storage summary calculation
+func StartAll(samplers []*Sampler) {
+	var wg sync.WaitGroup
+	wg.Add(len(samplers))
+	for _, s := range samplers {
+		go func(s *Sampler) {
+			defer wg.Done()
+			s.Start()
+		}(s)
+	}
+	wg.Wait()
+}
+
+// StopAll stops the samplers concurrently and returns the projection or the
+// error of each
+func StopAll(samplers []*Sampler) ([]*Projection, []error) {
+	projections := make([]*Projection, len(samplers))
+	errs := make([]error, len(samplers))
+	var wg sync.WaitGroup
+	wg.Add(len(samplers))
+	for i, s := range samplers {
+		go func(i int, s *Sampler) {
+			defer wg.Done()
+			projections[i], errs[i] = s.Stop()
+		}(i, s)
+	}
+	wg.Wait()
+	return projections, errs
+}
+
+// Stop samples the DUT a last time and returns its projection
+func (s *Sampler) Stop() (*Projection, error) {
+	close(s.stop)
+	<-s.done
+	s.sample()
+	return s.project()
+}
+
+// sample reads the storage summary of the DUT
+func (s *Sampler) sample() {
+	if *s.cfg.Calculate {
+		if err := remoteartifacts.CalculateStorageInfo(s.details); err != nil {
+			jflog.Error(fmt.Sprintf("Failed to calculate the storage summary of DUT %s : %v", s.dut, err))
+		} else {
+			time.Sleep(time.Duration(s.cfg.CalculateWaitSecs) * time.Second)
+		}
+	}
+	summary, err := remoteartifacts.GetStorageSummary(s.details)
+	if err != nil {
+		jflog.Error(fmt.Sprintf("Failed to get the storage summary of DUT %s : %v", s.dut, err))
+		return
+	}
+	sample := Sample{
+		Time:           time.Now(),
+		BinariesCount:  summary.Binaries.Count,
+		BinariesSize:   summary.Binaries.Size,
+		ArtifactsSize:  summary.Binaries.ArtifactsSize,
+		SizeResolution: summary.Binaries.SizeResolution,
+		Repos:          map[string]RepoSample{},
+	}
+	for _, r := range summary.Repos {
+		sample.Repos[r.Key] = RepoSample{UsedSpace: r.UsedSpace, FilesCount: r.FilesCount}
+		sample.FilesCount += r.FilesCount
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.samples = append(s.samples, sample)
+}
+
+// slope returns the least squares growth per second of the values at the sample times
+func slope(samples []Sample, value func(Sample) float64) float64 {
+	n := float64(len(samples))
+	var sumX, sumY, sumXY, sumXX float64
+	for _, s := range samples {
+		x := s.Time.Sub(samples[0].Time).Seconds()
+		y := value(s)
+		sumX, sumY, sumXY, sumXX = sumX+x, sumY+y, sumXY+x*y, sumXX+x*x
+	}
+	den := n*sumXX - sumX*sumX
+	if den == 0 {
+		return 0
+	}
+	return (n*sumXY - sumX*sumY) / den
+}
+
+// identicalSamples tells if the samples all report the same storage, as when
+// the storage summary was not refreshed between them
+func identicalSamples(samples []Sample) bool {
+	for _, x := range samples[1:] {
+		if x.BinariesCount != samples[0].BinariesCount || x.BinariesSize != samples[0].BinariesSize ||
+			x.ArtifactsSize != samples[0].ArtifactsSize || x.FilesCount != samples[0].FilesCount {
+			return false
+		}
+	}
+	return true
+}
+
+// project computes the growth rates of the samples and projects them
+func (s *Sampler) project() (*Projection, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.samples) < 2 {
+		return nil, fmt.Errorf("%d storage summary samples of DUT %s, at least 2 are needed", len(s.samples), s.dut)
+	}
+	first, last := s.samples[0], s.samples[len(s.samples)-1]
+	if identicalSamples(s.samples) {
+		jflog.Warn(fmt.Sprintf("Capacity dut=%s : the %d storage summary samples are identical, the projected growth is zero; set calculate or sample longer than the storage summary refresh",
+			s.dut, len(s.samples)))
+	}
+	p := &Projection{Dut: s.dut, Samples: len(s.samples), DurationSecs: last.Time.Sub(first.Time).Seconds()}
+
+	perSec := Growth{
+		BinariesCount: slope(s.samples, func(x Sample) float64 { return float64(x.BinariesCount) }),
+		BinariesSize:  slope(s.samples, func(x Sample) float64 { return float64(x.BinariesSize) }),
+		ArtifactsSize: slope(s.samples, func(x Sample) float64 { return float64(x.ArtifactsSize) }),
+		FilesCount:    slope(s.samples, func(x Sample) float64 { return float64(x.FilesCount) }),
+	}
+	// Seconds of the simulated workload in a day of the planned one
+	daySecs := s.cfg.WorkloadHoursPerDay * 3600
+	if s.cfg.DailyFiles > 0 && perSec.FilesCount > 0 {
+		daySecs = float64(s.cfg.DailyFiles) / perSec.FilesCount
+	}
+	p.Daily = Growth{
+		BinariesCount: perSec.BinariesCount * daySecs,
+		BinariesSize:  perSec.BinariesSize * daySecs,
+		ArtifactsSize: perSec.ArtifactsSize * daySecs,
+		FilesCount:    perSec.FilesCount * daySecs,
+	}
+	p.Daily.DbSize = p.Daily.FilesCount*float64(s.cfg.DbBytesPerFile) + p.Daily.BinariesCount*float64(s.cfg.DbBytesPerBinary)
+
+	// The binaries sizes are only reported rounded to their unit, e.g. "1.45
+	// TB", so their growth over the run is off by up to the resolution
+	for _, sample := range s.samples {
+		if sample.SizeResolution > p.SizeResolution {
+			p.SizeResolution = sample.SizeResolution
+		}
+	}
+	if grown := math.Abs(perSec.BinariesSize * p.DurationSecs); grown < 10*float64(p.SizeResolution) {
+		jflog.Warn(fmt.Sprintf("Capacity dut=%s : the binaries grew by about %.0f bytes, not well above the %d bytes resolution of the storage summary sizes, the projected disk usage is unreliable; run the simulations longer or with more data",
+			s.dut, grown, p.SizeResolution))
+	}
+
+	p.Current = Usage{
+		BinariesCount: last.BinariesCount,
+		FilesCount:    last.FilesCount,
+		DiskBytes:     last.BinariesSize,
+		DbBytes:       last.FilesCount*s.cfg.DbBytesPerFile + last.BinariesCount*s.cfg.DbBytesPerBinary,
+	}
+	for _, days := range s.cfg.ProjectionDays {
+		d := float64(days)
+		p.Projected = append(p.Projected, Usage{
+			Days:          days,
+			BinariesCount: p.Current.BinariesCount + int64(p.Daily.BinariesCount*d),
+			FilesCount:    p.Current.FilesCount + int64(p.Daily.FilesCount*d),
+			DiskBytes:     p.Current.DiskBytes + int64(p.Daily.BinariesSize*d),
+			DbBytes:       p.Current.DbBytes + int64(p.Daily.DbSize*d),
+		})
+	}
+
+	for key, repo := range last.Repos {
+		repoSamples := []Sample{}
+		for _, sample := range s.samples {
+			if _, ok := sample.Repos[key]; ok {
+				repoSamples = append(repoSamples, sample)
+			}
+		}
+		rg := RepoGrowth{
+			Key:        key,
+			UsedSpace:  repo.UsedSpace,
+			DailyBytes: slope(repoSamples, func(x Sample) float64 { return float64(x.Repos[key].UsedSpace) }) * daySecs,
+			DailyFiles: slope(repoSamples, func(x Sample) float64 { return float64(x.Repos[key].FilesCount) }) * daySecs,
+		}
+		if rg.DailyBytes == 0 && rg.DailyFiles == 0 {
+			continue
+		}
+		for _, days := range s.cfg.ProjectionDays {
+			rg.ProjectedSpace = append(rg.ProjectedSpace, repo.UsedSpace+int64(rg.DailyBytes*float64(days)))
+		}
+		p.Repos = append(p.Repos, rg)
+	}
+	sort.Slice(p.Repos, func(i, j int) bool { return p.Repos[i].DailyBytes > p.Repos[j].DailyBytes })
+	return p, nil
+}
+
+// LogProjection logs the capacity plan of a DUT
+func LogProjection(p *Projection) {
+	jflog.Info(fmt.Sprintf("Capacity dut=%s samples=%d duration=%.0fs daily: binaries=%.0f binariesBytes=%.0f artifactsBytes=%.0f files=%.0f dbBytes=%.0f",
+		p.Dut, p.Samples, p.DurationSecs, p.Daily.BinariesCount, p.Daily.BinariesSize, p.Daily.ArtifactsSize, p.Daily.FilesCount, p.Daily.DbSize))
+	for _, u := range append([]Usage{p.Current}, p.Projected...) {
+		jflog.Info(fmt.Sprintf("Capacity dut=%s days=%d binaries=%d files=%d diskBytes=%d dbBytes=%d",
+			p.Dut, u.Days, u.BinariesCount, u.FilesCount, u.DiskBytes, u.DbBytes))
+	}
+	for _, r := range p.Repos {
+		jflog.Info(fmt.Sprintf("Capacity dut=%s repo=%s usedBytes=%d daily: bytes=%.0f files=%.0f projectedBytes=%v",
+			p.Dut, r.Key, r.UsedSpace, r.DailyBytes, r.DailyFiles, r.ProjectedSpace))
+	}
+}
+
+// WriteProjections writes the capacity plans as JSON
+func WriteProjections(w io.Writer, projections []*Projection) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(projections)
+}
@@ -0,0 +1,179 @@
+package capacity
+
+import (
+	"io/ioutil"
+	"math"
+	"testing"
+	"time"
+
+	jflog "github.com/jfrog/jfrog-client-go/utils/log"
+)
+
+var start = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// samplesAt returns samples of the files count at the given seconds
+func samplesAt(points ...[2]float64) []Sample {
+	samples := []Sample{}
+	for _, p := range points {
+		samples = append(samples, Sample{Time: start.Add(time.Duration(p[0]) * time.Second), FilesCount: int64(p[1])})
+	}
+	return samples
+}
+
+func TestSlope(t *testing.T) {
+	files := func(s Sample) float64 { return float64(s.FilesCount) }
+	tests := []struct {
+		name    string
+		samples []Sample
+		want    float64
+	}{
+		{"single sample", samplesAt([2]float64{0, 10}), 0},
+		{"same time", samplesAt([2]float64{0, 10}, [2]float64{0, 20}), 0},
+		{"constant", samplesAt([2]float64{0, 10}, [2]float64{60, 10}, [2]float64{120, 10}), 0},
+		{"linear", samplesAt([2]float64{0, 0}, [2]float64{10, 100}, [2]float64{20, 200}), 10},
+		{"shrinking", samplesAt([2]float64{0, 100}, [2]float64{50, 0}), -2},
+		{"least squares", samplesAt([2]float64{0, 0}, [2]float64{1, 3}, [2]float64{2, 2}, [2]float64{3, 5}), 1.4},
+		{"uneven intervals", samplesAt([2]float64{0, 0}, [2]float64{1, 2}, [2]float64{10, 20}), 2},
+	}
+	for _, tt := range tests {
+		if got := slope(tt.samples, files); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s: slope() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// hourSamples are samples one hour apart, growing by 3600 files, 1000
+// binaries and 1MB of binaries an hour, with a growing and a static repo
+func hourSamples() []Sample {
+	samples := []Sample{}
+	for h := int64(0); h <= 2; h++ {
+		samples = append(samples, Sample{
+			Time:          start.Add(time.Duration(h) * time.Hour),
+			BinariesCount: 10000 + 1000*h,
+			BinariesSize:  1<<30 + h<<20,
+			ArtifactsSize: 2<<30 + 2*h<<20,
+			FilesCount:    20000 + 3600*h,
+			Repos: map[string]RepoSample{
+				"growing": {UsedSpace: h << 20, FilesCount: 3600 * h},
+				"static":  {UsedSpace: 1 << 20, FilesCount: 20000},
+			},
+		})
+	}
+	return samples
+}
+
+// identicalHourSamples are samples one hour apart repeating the same summary
+func identicalHourSamples() []Sample {
+	samples := []Sample{}
+	for h := 0; h <= 2; h++ {
+		sample := hourSamples()[1]
+		sample.Time = start.Add(time.Duration(h) * time.Hour)
+		samples = append(samples, sample)
+	}
+	return samples
+}
+
+func TestProject(t *testing.T) {
+	jflog.SetLogger(jflog.NewLogger(jflog.ERROR, ioutil.Discard))
+	tests := []struct {
+		name           string
+		cfg            Config
+		samples        []Sample
+		wantErr        bool
+		wantDailyFiles float64
+		wantDailyBytes float64
+		// wantDisk is the projected disk usage in 30 days
+		wantDisk int64
+	}{
+		{
+			name:    "too few samples",
+			samples: hourSamples()[:1],
+			wantErr: true,
+		},
+		{
+			name:           "sustained all day",
+			cfg:            Config{ProjectionDays: []int{30}},
+			samples:        hourSamples(),
+			wantDailyFiles: 3600 * 24,
+			wantDailyBytes: 24 << 20,
+			wantDisk:       1<<30 + 2<<20 + 30*24<<20,
+		},
+		{
+			name:           "sustained 8 hours a day",
+			cfg:            Config{ProjectionDays: []int{30}, WorkloadHoursPerDay: 8},
+			samples:        hourSamples(),
+			wantDailyFiles: 3600 * 8,
+			wantDailyBytes: 8 << 20,
+			wantDisk:       1<<30 + 2<<20 + 30*8<<20,
+		},
+		{
+			name:           "scaled to the daily files",
+			cfg:            Config{ProjectionDays: []int{30}, DailyFiles: 36000},
+			samples:        hourSamples(),
+			wantDailyFiles: 36000,
+			wantDailyBytes: 10 << 20,
+			wantDisk:       1<<30 + 2<<20 + 30*10<<20,
+		},
+		{
+			name:           "identical samples",
+			cfg:            Config{ProjectionDays: []int{30}},
+			samples:        identicalHourSamples(),
+			wantDailyFiles: 0,
+			wantDailyBytes: 0,
+			wantDisk:       1<<30 + 1<<20,
+		},
+	}
+	for _, tt := range tests {
+		s := &Sampler{dut: "test", cfg: tt.cfg.withDefaults(), samples: tt.samples}
+		p, err := s.project()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: project() error = %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr {
+			continue
+		}
+		if math.Abs(p.Daily.FilesCount-tt.wantDailyFiles) > 1e-6 || math.Abs(p.Daily.BinariesSize-tt.wantDailyBytes) > 1e-3 {
+			t.Errorf("%s: daily files %v and bytes %v, want %v and %v", tt.name, p.Daily.FilesCount, p.Daily.BinariesSize, tt.wantDailyFiles, tt.wantDailyBytes)
+		}
+		if len(p.Projected) != 1 || p.Projected[0].Days != 30 || p.Projected[0].DiskBytes != tt.wantDisk {
+			t.Errorf("%s: projected %+v, want %d disk bytes in 30 days", tt.name, p.Projected, tt.wantDisk)
+		}
+		wantDb := p.Daily.FilesCount*DefaultDbBytesPerFile + p.Daily.BinariesCount*DefaultDbBytesPerBinary
+		if math.Abs(p.Daily.DbSize-wantDb) > 1e-3 {
+			t.Errorf("%s: daily DB growth %v, want %v", tt.name, p.Daily.DbSize, wantDb)
+		}
+		// Only the growing repo is projected
+		wantRepos := 1
+		if tt.wantDailyFiles == 0 {
+			wantRepos = 0
+		}
+		if len(p.Repos) != wantRepos || (wantRepos == 1 && p.Repos[0].Key != "growing") {
+			t.Errorf("%s: projected repos %+v, want only the growing one", tt.name, p.Repos)
+		}
+	}
+}
+
+func TestIdenticalSamples(t *testing.T) {
+	samples := hourSamples()
+	if identicalSamples(samples) {
+		t.Error("identicalSamples() = true for growing samples")
+	}
+	if !identicalSamples([]Sample{samples[0], samples[0]}) {
+		t.Error("identicalSamples() = false for identical samples")
+	}
+}
+
+func TestConfigDefaults(t *testing.T) {
+	c := Config{}.withDefaults()
+	if c.Calculate == nil || !*c.Calculate {
+		t.Error("calculate does not default to true")
+	}
+	calculate := false
+	if c := (Config{Calculate: &calculate}).withDefaults(); *c.Calculate {
+		t.Error("calculate set to false is overridden")
+	}
+	if d := (Config{}).Duration(); d != DefaultDurationSecs*time.Second {
+		t.Errorf("Duration() = %v, want %ds", d, DefaultDurationSecs)
+	}
+}
@@ -4,14 +4,19 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"os"
 
 	"github.com/jfrog/jfrog-client-go/artifactory"
-	"github.com/jfrog/jfrog-client-go/artifactory/auth"
 	jfauth "github.com/jfrog/jfrog-client-go/auth"
 	"github.com/jfrog/jfrog-client-go/config"
 	jflog "github.com/jfrog/jfrog-client-go/utils/log"
 	"gopkg.in/yaml.v2"
+	"jfrog.com/datasim/capacity"
+	"jfrog.com/datasim/httpclient"
+	"jfrog.com/datasim/remoteartifacts"
+	"jfrog.com/datasim/simulator"
+	"jfrog.com/datasim/target"
 )
 
 // ValidateConfigPath just makes sure, that the path provided is a file,
@@ -31,20 +36,15 @@ func ValidateConfigPath(path string) error {
 type RtConfig struct {
 	CredentialsPath string
 	SimConfigPath   string
-	RtCredentials   RtUrlCreds
-	SimulationCfg   SimConfig
+	// Command is the subcommand run instead of the simulations, if any
+	Command       string
+	RtCredentials RtUrlCreds
+	SimulationCfg SimConfig
 }
 type RtUrlCreds struct {
-	RefArtiServer struct {
-		ArtiURL      string `yaml:"artiurl"`
-		ArtiUsername string `yaml:"artiusername"`
-		ArtiApikey   string `yaml:"artiapikey"`
-	} `yaml:"refartiserver"`
-	DutArtiServer struct {
-		ArtiURL      string `yaml:"artiurl"`
-		ArtiUsername string `yaml:"artiusername"`
-		ArtiApikey   string `yaml:"artiapikey"`
-	} `yaml:"dutartiserver"`
+	RefArtiServer  ArtiServer   `yaml:"refartiserver"`
+	DutArtiServer  *ArtiServer  `yaml:"dutartiserver"`
+	DutArtiServers []ArtiServer `yaml:"dutartiservers"`
 }
 type GenericSimConfig struct {
 	MetricPoll struct {
@@ -52,24 +52,50 @@ type GenericSimConfig struct {
 		Xray           bool `yaml:"xray"`
 		MetricPollFreq int  `yaml:"metricpollfreq"`
 	} `yaml:"metricpoll"`
+	HttpRetry  *remoteartifacts.RetryPolicy `yaml:"httpretry"`
+	ReportFile string                       `yaml:"reportfile"`
+	Capacity   capacity.Config              `yaml:"capacity"`
 }
 type RemoteHttpConn struct {
-	RemoteRepos []string `yaml:"remoterepos"`
-	TargetDir   string   `yaml:"targetdir"`
-	Repeat      bool     `yaml:"repeat"`
-	RepeatCount int      `yaml:"repeatcount"`
-	RepeatFreq  int      `yaml:"repeatfreq"`
+	TargetCfg   target.Cfg                    `yaml:",inline"`
+	RemoteRepos []string                      `yaml:"remoterepos"`
+	AutoSelect  remoteartifacts.RepoSelection `yaml:"autoselect"`
+	TargetDir   string                        `yaml:"targetdir"`
+	Repeat      bool                          `yaml:"repeat"`
+	RepeatCount int                           `yaml:"repeatcount"`
+	RepeatFreq  int                           `yaml:"repeatfreq"`
 }
 type DbConn struct {
-	NumWorkers       int `yaml:"numworkers"`
-	NumItersByWorker int `yaml:"numitersbyworker"`
+	TargetCfg        target.Cfg `yaml:",inline"`
+	NumWorkers       int        `yaml:"numworkers"`
+	NumItersByWorker int        `yaml:"numitersbyworker"`
 }
 type SimConfig struct {
-	GenericSimCfg     GenericSimConfig `yaml:"genericconfig"`
-	RemoteHttpConnCfg RemoteHttpConn   `yaml:"remotehttpconn"`
-	DbConnCfg         DbConn           `yaml:"dbconn"`
+	GenericSimCfg     GenericSimConfig           `yaml:"genericconfig"`
+	RemoteHttpConnCfg RemoteHttpConn             `yaml:"remotehttpconn"`
+	DbConnCfg         DbConn                     `yaml:"dbconn"`
+	UploadCfg         simulator.UploadCfg        `yaml:"upload"`
+	ChurnCfg          simulator.ChurnCfg         `yaml:"churn"`
+	RepoLifecycleCfg  simulator.RepoLifecycleCfg `yaml:"repolifecycle"`
+	VirtualCfg        simulator.VirtualCfg       `yaml:"virtual"`
+	XrayCfg           simulator.XrayCfg          `yaml:"xray"`
+	BuildInfoCfg      simulator.BuildInfoCfg     `yaml:"buildinfo"`
+	PropertiesCfg     simulator.PropertiesCfg    `yaml:"properties"`
+	DockerCfg         simulator.DockerCfg        `yaml:"docker"`
+	NativeCfg         simulator.NativeCfg        `yaml:"native"`
+	ReplayCfg         simulator.ReplayCfg        `yaml:"replay"`
+	SecurityCfg       simulator.SecurityCfg      `yaml:"security"`
+	TokensCfg         simulator.TokensCfg        `yaml:"tokens"`
+	ReplicationCfg    simulator.ReplicationCfg   `yaml:"replication"`
+	ContentionCfg     simulator.ContentionCfg    `yaml:"contention"`
+	LargeFileCfg      simulator.LargeFileCfg     `yaml:"largefile"`
+	DedupCfg          simulator.DedupCfg         `yaml:"dedup"`
 }
 
+// CommandCapacity samples the DUTs and projects their growth without running
+// the simulations
+const CommandCapacity = "capacity"
+
 // NewRtConfig returns a new decoded RtConfig struct
 func NewRtConfig() (*RtConfig, error) {
 	// Create RT config structure
@@ -80,10 +106,19 @@ func NewRtConfig() (*RtConfig, error) {
 
 	// Actually parse the flags
 	flag.Parse()
+	config.Command = flag.Arg(0)
+	if config.Command != "" && config.Command != CommandCapacity {
+		return config, fmt.Errorf("unknown command %s, expecting %s or none", config.Command, CommandCapacity)
+	}
 
-	// Validate the credentials config path
+	// Validate the credentials config path, a missing file is allowed when
+	// credentials are provided through the environment or the JFrog CLI config
 	if err := ValidateConfigPath(config.CredentialsPath); err != nil {
-		return config, err
+		if !os.IsNotExist(err) {
+			return config, err
+		}
+		jflog.Info(fmt.Sprintf("Credentials file %s not found, resolving credentials from environment", config.CredentialsPath))
+		config.CredentialsPath = ""
 	}
 	// Validate the simulation config path
 	if err := ValidateConfigPath(config.SimConfigPath); err != nil {
@@ -93,23 +128,50 @@ func NewRtConfig() (*RtConfig, error) {
 	return config, nil
 }
 
+// readConfigFile reads a yaml config file, expanding ${VAR} environment references
+func readConfigFile(path string) ([]byte, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return interpolateEnv(data)
+}
+
 // InitConfigs initializes RT credentials from config file
 func (rc *RtConfig) InitConfigs() error {
-	fileCreds, err := os.Open(rc.CredentialsPath)
-	if err != nil {
+	if rc.CredentialsPath != "" {
+		dataCreds, err := readConfigFile(rc.CredentialsPath)
+		if err != nil {
+			jflog.Error(fmt.Sprintf("Failed reading %s : %v", rc.CredentialsPath, err))
+			return err
+		}
+		if err := yaml.Unmarshal(dataCreds, &rc.RtCredentials); err != nil {
+			return err
+		}
+	}
+	if err := rc.RtCredentials.RefArtiServer.resolve(RefEnvPrefix); err != nil {
+		jflog.Error(fmt.Sprintf("Failed resolving refartiserver credentials : %v", err))
 		return err
 	}
-	defer fileCreds.Close()
-	fileSimCfg, err := os.Open(rc.SimConfigPath)
-	if err != nil {
+	if err := rc.resolveDutArtiServers(); err != nil {
+		jflog.Error(fmt.Sprintf("Failed resolving DUT credentials : %v", err))
+		return err
+	}
+	jflog.Info(fmt.Sprintf("Ref RT server = %s", rc.RtCredentials.RefArtiServer))
+	for _, as := range rc.RtCredentials.DutArtiServers {
+		jflog.Info(fmt.Sprintf("DUT RT server %s = %s", as.Name, as))
+	}
+	if err := rc.initHttpClients(); err != nil {
+		jflog.Error(fmt.Sprintf("Failed creating http clients : %v", err))
 		return err
 	}
-	defer fileSimCfg.Close()
 
-	if err := yaml.NewDecoder(fileCreds).Decode(&rc.RtCredentials); err != nil {
+	dataSimCfg, err := readConfigFile(rc.SimConfigPath)
+	if err != nil {
+		jflog.Error(fmt.Sprintf("Failed reading %s : %v", rc.SimConfigPath, err))
 		return err
 	}
-	if err := yaml.NewDecoder(fileSimCfg).Decode(&rc.SimulationCfg); err != nil {
+	if err := yaml.Unmarshal(dataSimCfg, &rc.SimulationCfg); err != nil {
 		jflog.Error("yaml decode failure SimulationCfg")
 		return err
 	}
@@ -119,27 +181,109 @@ func (rc *RtConfig) InitConfigs() error {
 
 // GetRefRtDetails gets the RT credential details
 func (rc *RtConfig) GetRefRtDetails() jfauth.ServiceDetails {
-	refRtDetails := auth.NewArtifactoryDetails()
-	refRtDetails.SetUrl(rc.RtCredentials.RefArtiServer.ArtiURL)
-	refRtDetails.SetApiKey(rc.RtCredentials.RefArtiServer.ArtiApikey)
-	refRtDetails.SetUser(rc.RtCredentials.RefArtiServer.ArtiUsername)
-	return refRtDetails
+	return rc.RtCredentials.RefArtiServer.NewRtDetails()
+}
+
+// resolveDutArtiServers resolves the credentials of the DUTs, either the list of
+// named dutartiservers or the single dutartiserver, which is named "dut"
+func (rc *RtConfig) resolveDutArtiServers() error {
+	if len(rc.RtCredentials.DutArtiServers) == 0 {
+		dut := ArtiServer{}
+		if rc.RtCredentials.DutArtiServer != nil {
+			dut = *rc.RtCredentials.DutArtiServer
+		}
+		if dut.Name == "" {
+			dut.Name = DefaultDutName
+		}
+		if err := dut.resolve(DutEnvPrefix); err != nil {
+			return err
+		}
+		rc.RtCredentials.DutArtiServers = []ArtiServer{dut}
+		rc.RtCredentials.DutArtiServer = nil
+		return nil
+	}
+	if rc.RtCredentials.DutArtiServer != nil {
+		return fmt.Errorf("dutartiserver and dutartiservers are mutually exclusive")
+	}
+
+	names := map[string]bool{}
+	for i := range rc.RtCredentials.DutArtiServers {
+		as := &rc.RtCredentials.DutArtiServers[i]
+		if as.Name == "" {
+			return fmt.Errorf("dutartiservers entry %d has no name", i)
+		}
+		if names[as.Name] || as.Name == target.All {
+			return fmt.Errorf("invalid or duplicate DUT name %s", as.Name)
+		}
+		names[as.Name] = true
+		if err := as.resolve(DutEnvPrefix + envName(as.Name) + "_"); err != nil {
+			return fmt.Errorf("DUT %s: %v", as.Name, err)
+		}
+	}
+	return nil
+}
+
+// GetDutNames gets the names of the DUTs, in configuration order
+func (rc *RtConfig) GetDutNames() []string {
+	names := []string{}
+	for _, as := range rc.RtCredentials.DutArtiServers {
+		names = append(names, as.Name)
+	}
+	return names
+}
+
+// GetDutRtDetails gets the RT credential details of the named DUT
+func (rc *RtConfig) GetDutRtDetails(name string) (jfauth.ServiceDetails, error) {
+	for i := range rc.RtCredentials.DutArtiServers {
+		if rc.RtCredentials.DutArtiServers[i].Name == name {
+			return rc.RtCredentials.DutArtiServers[i].NewRtDetails(), nil
+		}
+	}
+	return nil, fmt.Errorf("unknown DUT %s", name)
 }
 
-// GetDutRtDetails gets the RT credential details
-func (rc *RtConfig) GetDutRtDetails() jfauth.ServiceDetails {
-	dutRtDetails := auth.NewArtifactoryDetails()
-	dutRtDetails.SetUrl(rc.RtCredentials.DutArtiServer.ArtiURL)
-	dutRtDetails.SetApiKey(rc.RtCredentials.DutArtiServer.ArtiApikey)
-	dutRtDetails.SetUser(rc.RtCredentials.DutArtiServer.ArtiUsername)
-	return dutRtDetails
+// artiServers gets the reference and all DUT servers
+func (rc *RtConfig) artiServers() []*ArtiServer {
+	servers := []*ArtiServer{&rc.RtCredentials.RefArtiServer}
+	for i := range rc.RtCredentials.DutArtiServers {
+		servers = append(servers, &rc.RtCredentials.DutArtiServers[i])
+	}
+	return servers
+}
+
+// getArtiServer gets the configured server with the given URL
+func (rc *RtConfig) getArtiServer(url string) *ArtiServer {
+	for _, as := range rc.artiServers() {
+		if as.ArtiURL == url {
+			return as
+		}
+	}
+	return &ArtiServer{ArtiURL: url}
+}
+
+// initHttpClients creates the http client of each server used by the direct REST calls
+func (rc *RtConfig) initHttpClients() error {
+	for _, as := range rc.artiServers() {
+		client, err := httpclient.New(as.HttpClientCfg)
+		if err != nil {
+			return fmt.Errorf("%s: %v", as.ArtiURL, err)
+		}
+		httpclient.Register(as.ArtiURL, client)
+	}
+	return nil
 }
 
 // GetRtMgr gets the reference RT manager
 func (rc *RtConfig) GetRtMgr(refRtDetails jfauth.ServiceDetails) (artifactory.ArtifactoryServicesManager, error) {
+	httpCfg := rc.getArtiServer(refRtDetails.GetUrl()).HttpClientCfg
+	// jfrog-client-go v0.19.1 builds the manager's http client itself and
+	// offers no way to pass a client, transport or timeout: only the TLS
+	// settings of the factory config reach it
 	ctx := context.Background()
 	svcConfig, err := config.NewConfigBuilder().
 		SetServiceDetails(refRtDetails).
+		SetCertificatesPath(httpCfg.CaCertsDir).
+		SetInsecureTls(httpCfg.InsecureSkipVerify).
 		SetThreads(1).
 		SetDryRun(false).
 		SetContext(ctx).
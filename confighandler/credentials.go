@@ -0,0 +1,308 @@
+package confighandler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/jfrog/jfrog-client-go/artifactory/auth"
+	jfauth "github.com/jfrog/jfrog-client-go/auth"
+	jflog "github.com/jfrog/jfrog-client-go/utils/log"
+	"jfrog.com/datasim/httpclient"
+	"jfrog.com/datasim/redact"
+)
+
+// Environment variable prefixes overriding the credentials of each server
+const (
+	RefEnvPrefix = "DATASIM_REF_"
+	DutEnvPrefix = "DATASIM_DUT_"
+)
+
+// DefaultDutName names the DUT configured with the single dutartiserver
+const DefaultDutName = "dut"
+
+// Authentication types supported for an Artifactory instance
+const (
+	AuthApiKey      = "apikey"
+	AuthAccessToken = "accesstoken"
+	AuthPassword    = "password"
+	AuthAnonymous   = "anonymous"
+)
+
+// ArtiServer holds the URL and credentials of one Artifactory instance
+type ArtiServer struct {
+	Name                string `yaml:"name"`
+	ArtiURL             string `yaml:"artiurl"`
+	ArtiAuthType        string `yaml:"artiauthtype"`
+	ArtiUsername        string `yaml:"artiusername"`
+	ArtiApikey          string `yaml:"artiapikey"`
+	ArtiApikeyFile      string `yaml:"artiapikeyfile"`
+	ArtiPassword        string `yaml:"artipassword"`
+	ArtiPasswordFile    string `yaml:"artipasswordfile"`
+	ArtiAccessToken     string `yaml:"artiaccesstoken"`
+	ArtiAccessTokenFile string `yaml:"artiaccesstokenfile"`
+	JfrogCliServerID    string `yaml:"jfrogcliserverid"`
+
+	HttpClientCfg httpclient.Config `yaml:"httpclient"`
+}
+
+// String formats the server details with secrets masked
+func (as ArtiServer) String() string {
+	return fmt.Sprintf("{url: %s, authtype: %s, user: %s, apikey: %s, password: %s, accesstoken: %s, jfrogcliserverid: %s}",
+		as.ArtiURL, as.ArtiAuthType, as.ArtiUsername, redact.Value(as.ArtiApikey), redact.Value(as.ArtiPassword),
+		redact.Value(as.ArtiAccessToken), as.JfrogCliServerID)
+}
+
+// envFields maps the environment variable suffix to the field it overrides
+func (as *ArtiServer) envFields() map[string]*string {
+	return map[string]*string{
+		"ARTIURL":             &as.ArtiURL,
+		"ARTIAUTHTYPE":        &as.ArtiAuthType,
+		"ARTIUSERNAME":        &as.ArtiUsername,
+		"ARTIAPIKEY":          &as.ArtiApikey,
+		"ARTIAPIKEYFILE":      &as.ArtiApikeyFile,
+		"ARTIPASSWORD":        &as.ArtiPassword,
+		"ARTIPASSWORDFILE":    &as.ArtiPasswordFile,
+		"ARTIACCESSTOKEN":     &as.ArtiAccessToken,
+		"ARTIACCESSTOKENFILE": &as.ArtiAccessTokenFile,
+		"JFROGCLISERVERID":    &as.JfrogCliServerID,
+	}
+}
+
+// resolve fills the server credentials from, in order of precedence, environment
+// variables, secret files, the credentials file and the JFrog CLI configuration
+func (as *ArtiServer) resolve(envPrefix string) error {
+	fromEnv := map[*string]bool{}
+	for suffix, field := range as.envFields() {
+		if v, ok := os.LookupEnv(envPrefix + suffix); ok {
+			*field = v
+			fromEnv[field] = true
+		}
+	}
+
+	secretFiles := []struct {
+		path   string
+		secret *string
+	}{
+		{as.ArtiApikeyFile, &as.ArtiApikey},
+		{as.ArtiPasswordFile, &as.ArtiPassword},
+		{as.ArtiAccessTokenFile, &as.ArtiAccessToken},
+	}
+	for _, sf := range secretFiles {
+		if sf.path == "" || fromEnv[sf.secret] {
+			continue
+		}
+		secret, err := readSecretFile(sf.path)
+		if err != nil {
+			return err
+		}
+		*sf.secret = secret
+	}
+
+	if as.JfrogCliServerID != "" {
+		cliServer, err := getJfrogCliServer(as.JfrogCliServerID)
+		if err != nil {
+			return err
+		}
+		cliFields := []struct {
+			field *string
+			value string
+		}{
+			{&as.ArtiURL, cliServer.ArtifactoryURL},
+			{&as.ArtiUsername, cliServer.User},
+			{&as.ArtiApikey, cliServer.ApiKey},
+			{&as.ArtiPassword, cliServer.Password},
+			{&as.ArtiAccessToken, cliServer.AccessToken},
+		}
+		for _, cf := range cliFields {
+			if *cf.field == "" {
+				*cf.field = cf.value
+			}
+		}
+	}
+
+	if as.ArtiURL == "" {
+		return fmt.Errorf("no Artifactory URL configured, set artiurl, %sARTIURL or jfrogcliserverid", envPrefix)
+	}
+	if !strings.HasSuffix(as.ArtiURL, "/") {
+		as.ArtiURL += "/"
+	}
+	if err := as.resolveAuthType(); err != nil {
+		return fmt.Errorf("%s: %v", as.ArtiURL, err)
+	}
+	redact.Register(as.ArtiApikey)
+	redact.Register(as.ArtiPassword)
+	redact.Register(as.ArtiAccessToken)
+	return nil
+}
+
+// resolveAuthType picks the authentication type from the configured credentials
+// when not given explicitly, preferring access tokens since API keys are deprecated
+func (as *ArtiServer) resolveAuthType() error {
+	switch as.ArtiAuthType {
+	case "":
+		switch {
+		case as.ArtiAccessToken != "":
+			as.ArtiAuthType = AuthAccessToken
+		case as.ArtiApikey != "":
+			as.ArtiAuthType = AuthApiKey
+		case as.ArtiPassword != "":
+			as.ArtiAuthType = AuthPassword
+		default:
+			as.ArtiAuthType = AuthAnonymous
+		}
+	case AuthAccessToken:
+		if as.ArtiAccessToken == "" {
+			return fmt.Errorf("artiauthtype %s requires artiaccesstoken", as.ArtiAuthType)
+		}
+	case AuthApiKey:
+		if as.ArtiApikey == "" {
+			return fmt.Errorf("artiauthtype %s requires artiapikey", as.ArtiAuthType)
+		}
+	case AuthPassword:
+		if as.ArtiUsername == "" || as.ArtiPassword == "" {
+			return fmt.Errorf("artiauthtype %s requires artiusername and artipassword", as.ArtiAuthType)
+		}
+	case AuthAnonymous:
+	default:
+		return fmt.Errorf("unsupported artiauthtype %s", as.ArtiAuthType)
+	}
+	return nil
+}
+
+// SetAuth applies the credentials of the resolved authentication type to the
+// service details, leaving the others unset so that only one is ever sent
+func (as *ArtiServer) SetAuth(details jfauth.ServiceDetails) {
+	switch as.ArtiAuthType {
+	case AuthAccessToken:
+		// Without a user the access token is sent as a bearer token
+		details.SetAccessToken(as.ArtiAccessToken)
+	case AuthApiKey:
+		details.SetUser(as.ArtiUsername)
+		details.SetApiKey(as.ArtiApikey)
+	case AuthPassword:
+		details.SetUser(as.ArtiUsername)
+		details.SetPassword(as.ArtiPassword)
+	}
+}
+
+// NewRtDetails creates the service details of the server with its URL,
+// credentials and TLS client certificate
+func (as *ArtiServer) NewRtDetails() jfauth.ServiceDetails {
+	rtDetails := auth.NewArtifactoryDetails()
+	rtDetails.SetUrl(as.ArtiURL)
+	as.SetAuth(rtDetails)
+	rtDetails.SetClientCertPath(as.HttpClientCfg.ClientCertPath)
+	rtDetails.SetClientCertKeyPath(as.HttpClientCfg.ClientCertKeyPath)
+	return rtDetails
+}
+
+var envNameRegex = regexp.MustCompile(`[^A-Z0-9]`)
+
+// envName converts a DUT name to its environment variable prefix part
+func envName(name string) string {
+	return envNameRegex.ReplaceAllString(strings.ToUpper(name), "_")
+}
+
+// readSecretFile reads a secret mounted as a file, e.g. a Kubernetes secret
+func readSecretFile(path string) (string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("unable to read secret file '%s': %v", path, err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+var envRefRegex = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// interpolateEnv replaces ${VAR} references with the value of the environment variable
+func interpolateEnv(data []byte) ([]byte, error) {
+	missing := []string{}
+	out := envRefRegex.ReplaceAllFunc(data, func(ref []byte) []byte {
+		name := string(envRefRegex.FindSubmatch(ref)[1])
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			missing = append(missing, name)
+		}
+		return []byte(v)
+	})
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("undefined environment variables referenced: %s", strings.Join(missing, ", "))
+	}
+	return out, nil
+}
+
+// jfrogCliServer is a server entry of the JFrog CLI configuration
+type jfrogCliServer struct {
+	ServerID       string `json:"serverId"`
+	URL            string `json:"url"`
+	ArtifactoryURL string `json:"artifactoryUrl"`
+	User           string `json:"user"`
+	Password       string `json:"password"`
+	ApiKey         string `json:"apiKey"`
+	AccessToken    string `json:"accessToken"`
+	IsDefault      bool   `json:"isDefault"`
+}
+
+// jfrogCliConfig covers both the v1 ("artifactory") and v2 ("servers") layouts
+type jfrogCliConfig struct {
+	Artifactory []jfrogCliServer `json:"artifactory"`
+	Servers     []jfrogCliServer `json:"servers"`
+	Enc         bool             `json:"enc"`
+}
+
+// jfrogCliConfigFiles lists the CLI config file names, newest layout first
+var jfrogCliConfigFiles = []string{"jfrog-cli.conf.v6", "jfrog-cli.conf.v5", "jfrog-cli.conf.v4", "jfrog-cli.conf"}
+
+// jfrogCliHomeDir returns the JFrog CLI home directory
+func jfrogCliHomeDir() (string, error) {
+	if dir := os.Getenv("JFROG_CLI_HOME_DIR"); dir != "" {
+		return dir, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".jfrog"), nil
+}
+
+// getJfrogCliServer looks up a server configured with 'jfrog config add'
+func getJfrogCliServer(serverID string) (*jfrogCliServer, error) {
+	homeDir, err := jfrogCliHomeDir()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range jfrogCliConfigFiles {
+		path := filepath.Join(homeDir, name)
+		data, err := ioutil.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		cliCfg := &jfrogCliConfig{}
+		if err := json.Unmarshal(data, cliCfg); err != nil {
+			return nil, fmt.Errorf("unable to parse JFrog CLI config '%s': %v", path, err)
+		}
+		if cliCfg.Enc {
+			return nil, fmt.Errorf("JFrog CLI config '%s' is encrypted with a master key, which is not supported", path)
+		}
+		for _, s := range append(cliCfg.Servers, cliCfg.Artifactory...) {
+			if s.ServerID != serverID {
+				continue
+			}
+			if s.ArtifactoryURL == "" {
+				s.ArtifactoryURL = s.URL
+			}
+			jflog.Info(fmt.Sprintf("Using JFrog CLI server '%s' from %s", serverID, path))
+			return &s, nil
+		}
+		return nil, fmt.Errorf("server '%s' not found in JFrog CLI config '%s'", serverID, path)
+	}
+	return nil, fmt.Errorf("no JFrog CLI config found in '%s'", homeDir)
+}
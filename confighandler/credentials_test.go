@@ -0,0 +1,128 @@
+package confighandler
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	jflog "github.com/jfrog/jfrog-client-go/utils/log"
+)
+
+// setEnv sets the environment variables for the duration of a test
+func setEnv(t *testing.T, vars map[string]string) {
+	for k, v := range vars {
+		old, had := os.LookupEnv(k)
+		os.Setenv(k, v)
+		t.Cleanup(func() {
+			if had {
+				os.Setenv(k, old)
+			} else {
+				os.Unsetenv(k)
+			}
+		})
+	}
+}
+
+func TestResolvePrecedence(t *testing.T) {
+	jflog.SetLogger(jflog.NewLogger(jflog.ERROR, ioutil.Discard))
+	dir, err := ioutil.TempDir("", "credentials")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	secretFile := filepath.Join(dir, "apikey")
+	if err := ioutil.WriteFile(secretFile, []byte("file-key\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cliConfig := `{"servers": [{"serverId": "cli", "url": "https://cli.example.com/", "artifactoryUrl": "https://cli.example.com/artifactory/",
+		"user": "cli-user", "apiKey": "cli-key", "accessToken": "cli-token"}]}`
+	if err := ioutil.WriteFile(filepath.Join(dir, "jfrog-cli.conf.v5"), []byte(cliConfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+	setEnv(t, map[string]string{"JFROG_CLI_HOME_DIR": dir})
+
+	tests := []struct {
+		name      string
+		server    ArtiServer
+		env       map[string]string
+		wantURL   string
+		wantKey   string
+		wantUser  string
+		wantToken string
+	}{
+		{
+			name:    "env over secret file",
+			server:  ArtiServer{ArtiURL: "https://yaml.example.com", ArtiApikey: "yaml-key", ArtiApikeyFile: secretFile},
+			env:     map[string]string{"DATASIM_TEST_ARTIAPIKEY": "env-key"},
+			wantURL: "https://yaml.example.com/", wantKey: "env-key",
+		},
+		{
+			name:    "env naming the secret file",
+			server:  ArtiServer{ArtiURL: "https://yaml.example.com", ArtiApikey: "yaml-key"},
+			env:     map[string]string{"DATASIM_TEST_ARTIAPIKEYFILE": secretFile},
+			wantURL: "https://yaml.example.com/", wantKey: "file-key",
+		},
+		{
+			name:    "secret file over yaml",
+			server:  ArtiServer{ArtiURL: "https://yaml.example.com/", ArtiApikey: "yaml-key", ArtiApikeyFile: secretFile},
+			wantURL: "https://yaml.example.com/", wantKey: "file-key",
+		},
+		{
+			name:    "yaml over CLI config",
+			server:  ArtiServer{ArtiApikey: "yaml-key", JfrogCliServerID: "cli"},
+			wantURL: "https://cli.example.com/artifactory/", wantKey: "yaml-key", wantUser: "cli-user", wantToken: "cli-token",
+		},
+		{
+			name:    "env over CLI config",
+			server:  ArtiServer{JfrogCliServerID: "cli"},
+			env:     map[string]string{"DATASIM_TEST_ARTIURL": "https://env.example.com"},
+			wantURL: "https://env.example.com/", wantKey: "cli-key", wantUser: "cli-user", wantToken: "cli-token",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setEnv(t, tt.env)
+			as := tt.server
+			if err := as.resolve("DATASIM_TEST_"); err != nil {
+				t.Fatal(err)
+			}
+			if as.ArtiURL != tt.wantURL || as.ArtiApikey != tt.wantKey || as.ArtiUsername != tt.wantUser || as.ArtiAccessToken != tt.wantToken {
+				t.Errorf("resolved url %s, apikey %s, user %s, token %s, want %s, %s, %s, %s", as.ArtiURL, as.ArtiApikey,
+					as.ArtiUsername, as.ArtiAccessToken, tt.wantURL, tt.wantKey, tt.wantUser, tt.wantToken)
+			}
+		})
+	}
+}
+
+func TestResolveMissingSecretFile(t *testing.T) {
+	as := ArtiServer{ArtiURL: "https://yaml.example.com/", ArtiApikeyFile: filepath.Join(os.TempDir(), "datasim-no-such-secret")}
+	if err := as.resolve("DATASIM_TEST_"); err == nil {
+		t.Error("resolve() succeeded with a missing secret file")
+	}
+}
+
+func TestInterpolateEnv(t *testing.T) {
+	setEnv(t, map[string]string{"DATASIM_TEST_HOST": "arti.example.com", "DATASIM_TEST_EMPTY": ""})
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"artiurl: https://${DATASIM_TEST_HOST}/artifactory", "artiurl: https://arti.example.com/artifactory", false},
+		{"a: ${DATASIM_TEST_HOST} b: ${DATASIM_TEST_HOST}", "a: arti.example.com b: arti.example.com", false},
+		{"empty: '${DATASIM_TEST_EMPTY}'", "empty: ''", false},
+		{"literal: $DATASIM_TEST_HOST", "literal: $DATASIM_TEST_HOST", false},
+		{"missing: ${DATASIM_TEST_UNDEFINED}", "", true},
+	}
+	for _, tt := range tests {
+		got, err := interpolateEnv([]byte(tt.in))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("interpolateEnv(%q) error = %v, want error %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && string(got) != tt.want {
+			t.Errorf("interpolateEnv(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package generator
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"path"
+)
+
+// Size distributions of the generated files
+const (
+	SizeDistFixed     = "fixed"
+	SizeDistUniform   = "uniform"
+	SizeDistLogNormal = "lognormal"
+)
+
+// SizeDist describes the distribution of the generated file sizes in bytes.
+// A fixed distribution uses Size, a uniform one draws from [Min, Max] and a
+// log-normal one has median Size and shape Sigma, clamped to [Min, Max] when set.
+type SizeDist struct {
+	Type  string  `yaml:"type"`
+	Size  int64   `yaml:"size"`
+	Min   int64   `yaml:"min"`
+	Max   int64   `yaml:"max"`
+	Sigma float64 `yaml:"sigma"`
+}
+
+// Validate checks the distribution parameters
+func (sd SizeDist) Validate() error {
+	switch sd.Type {
+	case "", SizeDistFixed:
+		if sd.Size < 0 {
+			return fmt.Errorf("fixed size distribution requires size >= 0")
+		}
+	case SizeDistUniform:
+		if sd.Min < 0 || sd.Max < sd.Min {
+			return fmt.Errorf("uniform size distribution requires 0 <= min <= max")
+		}
+	case SizeDistLogNormal:
+		if sd.Size <= 0 || sd.Sigma <= 0 {
+			return fmt.Errorf("lognormal size distribution requires size > 0 and sigma > 0")
+		}
+	default:
+		return fmt.Errorf("unsupported size distribution %s", sd.Type)
+	}
+	return nil
+}
+
+// Sample draws a file size from the distribution
+func (sd SizeDist) Sample(rng *rand.Rand) int64 {
+	switch sd.Type {
+	case SizeDistUniform:
+		return sd.Min + rng.Int63n(sd.Max-sd.Min+1)
+	case SizeDistLogNormal:
+		size := int64(float64(sd.Size) * math.Exp(sd.Sigma*rng.NormFloat64()))
+		if sd.Min > 0 && size < sd.Min {
+			size = sd.Min
+		}
+		if sd.Max > 0 && size > sd.Max {
+			size = sd.Max
+		}
+		return size
+	default:
+		return sd.Size
+	}
+}
+
+// NewRand creates a random source that is deterministic for a seed and stream,
+// so that concurrent workers generate reproducible yet distinct data
+func NewRand(seed int64, stream int) *rand.Rand {
+	return rand.New(rand.NewSource(seed*7919 + int64(stream)))
+}
+
+// RandomBytes generates n random bytes
+func RandomBytes(rng *rand.Rand, n int64) []byte {
+	data := make([]byte, n)
+	rng.Read(data)
+	return data
+}
+
+// FilePath returns the path of the i-th generated file, spread over depth levels
+// of directories with fanOut sub directories each
+func FilePath(i int, depth int, fanOut int, ext string) string {
+	dirs := []string{}
+	n := i
+	for l := 0; l < depth; l++ {
+		if fanOut > 0 {
+			dirs = append(dirs, fmt.Sprintf("d%d-%d", l, n%fanOut))
+			n /= fanOut
+		}
+	}
+	return path.Join(append(dirs, fmt.Sprintf("file-%06d%s", i, ext))...)
+}
@@ -0,0 +1,391 @@
+package generator
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"path"
+	"strings"
+	"time"
+)
+
+// Package formats the generator produces, named after the Artifactory package types
+const (
+	FormatGeneric = "generic"
+	FormatMaven   = "maven"
+	FormatNpm     = "npm"
+	FormatPypi    = "pypi"
+	FormatDebian  = "debian"
+	FormatHelm    = "helm"
+	FormatDocker  = "docker"
+)
+
+// Formats lists the supported package formats
+var Formats = []string{FormatGeneric, FormatMaven, FormatNpm, FormatPypi, FormatDebian, FormatHelm, FormatDocker}
+
+// File is a generated file and the repo relative path it is deployed to
+type File struct {
+	Path string
+	// MatrixParams are appended to the deploy path, e.g. the debian coordinates
+	MatrixParams string
+	Data         []byte
+}
+
+// Package is a generated package made of one or more files
+type Package struct {
+	Format  string
+	Name    string
+	Version string
+	Files   []File
+}
+
+// modTime is fixed so that archives are reproducible for a seed
+var modTime = time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+var nameWords = []string{
+	"alpha", "bravo", "cedar", "delta", "ember", "falcon", "granite", "harbor",
+	"indigo", "juniper", "kestrel", "lumen", "maple", "nimbus", "onyx", "pioneer",
+	"quartz", "raven", "summit", "tundra", "umber", "vertex", "willow", "xenon",
+	"yarrow", "zephyr",
+}
+
+// packageName returns a name unique for index, with a random but seeded prefix
+func packageName(rng *rand.Rand, index int, sep string) string {
+	return fmt.Sprintf("%s%s%s%s%d", nameWords[rng.Intn(len(nameWords))], sep,
+		nameWords[rng.Intn(len(nameWords))], sep, index)
+}
+
+// packageVersion returns a random semantic version
+func packageVersion(rng *rand.Rand) string {
+	return fmt.Sprintf("%d.%d.%d", rng.Intn(10), rng.Intn(20), rng.Intn(50))
+}
+
+// NewPackage generates the index-th package of the format, with a payload of
+// payloadSize random bytes. The same rng seed and index give the same package.
+func NewPackage(format string, rng *rand.Rand, index int, payloadSize int64, depth int, fanOut int) (*Package, error) {
+	payload := RandomBytes(rng, payloadSize)
+	switch format {
+	case "", FormatGeneric:
+		return &Package{Format: FormatGeneric, Name: fmt.Sprintf("file-%06d", index), Files: []File{
+			{Path: FilePath(index, depth, fanOut, ".bin"), Data: payload},
+		}}, nil
+	case FormatMaven:
+		return newMavenPackage(rng, index, payload)
+	case FormatNpm:
+		return newNpmPackage(rng, index, payload)
+	case FormatPypi:
+		return newPypiPackage(rng, index, payload)
+	case FormatDebian:
+		return newDebianPackage(rng, index, payload)
+	case FormatHelm:
+		return newHelmPackage(rng, index, payload)
+	case FormatDocker:
+		return newDockerImage(rng, index, payload)
+	default:
+		return nil, fmt.Errorf("unsupported package format %s", format)
+	}
+}
+
+// archiveEntry is a file added to a generated archive
+type archiveEntry struct {
+	name string
+	data []byte
+}
+
+// zipArchive creates a zip archive of the entries
+func zipArchive(entries []archiveEntry) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+	for _, e := range entries {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: e.name, Method: zip.Deflate, Modified: modTime})
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(e.data); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// tarArchive creates a tar archive of the entries, gzip compressed if gz is set
+func tarArchive(entries []archiveEntry, gz bool) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	var tw *tar.Writer
+	var gw *gzip.Writer
+	if gz {
+		gw = gzip.NewWriter(buf)
+		gw.ModTime = modTime
+		tw = tar.NewWriter(gw)
+	} else {
+		tw = tar.NewWriter(buf)
+	}
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Mode: 0644, Size: int64(len(e.data)), ModTime: modTime, Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write(e.data); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if gz {
+		if err := gw.Close(); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// newMavenPackage generates a jar with its pom
+func newMavenPackage(rng *rand.Rand, index int, payload []byte) (*Package, error) {
+	groupID := "com.datasim." + nameWords[rng.Intn(len(nameWords))]
+	artifactID := packageName(rng, index, "-")
+	version := packageVersion(rng)
+	pom := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<project xmlns="http://maven.apache.org/POM/4.0.0" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance"
+    xsi:schemaLocation="http://maven.apache.org/POM/4.0.0 http://maven.apache.org/xsd/maven-4.0.0.xsd">
+  <modelVersion>4.0.0</modelVersion>
+  <groupId>%s</groupId>
+  <artifactId>%s</artifactId>
+  <version>%s</version>
+  <packaging>jar</packaging>
+  <description>Generated by the data simulator</description>
+</project>
+`, groupID, artifactID, version)
+	pomProps := fmt.Sprintf("groupId=%s\nartifactId=%s\nversion=%s\n", groupID, artifactID, version)
+	jar, err := zipArchive([]archiveEntry{
+		{"META-INF/MANIFEST.MF", []byte("Manifest-Version: 1.0\r\nCreated-By: datasim\r\n\r\n")},
+		{path.Join("META-INF/maven", groupID, artifactID, "pom.xml"), []byte(pom)},
+		{path.Join("META-INF/maven", groupID, artifactID, "pom.properties"), []byte(pomProps)},
+		{path.Join(strings.Replace(groupID, ".", "/", -1), "data.bin"), payload},
+	})
+	if err != nil {
+		return nil, err
+	}
+	dir := path.Join(strings.Replace(groupID, ".", "/", -1), artifactID, version)
+	base := artifactID + "-" + version
+	return &Package{Format: FormatMaven, Name: groupID + ":" + artifactID, Version: version, Files: []File{
+		{Path: path.Join(dir, base+".pom"), Data: []byte(pom)},
+		{Path: path.Join(dir, base+".jar"), Data: jar},
+	}}, nil
+}
+
+// newNpmPackage generates an npm tarball with its package.json
+func newNpmPackage(rng *rand.Rand, index int, payload []byte) (*Package, error) {
+	name := packageName(rng, index, "-")
+	version := packageVersion(rng)
+	pkgJSON, err := json.MarshalIndent(map[string]interface{}{
+		"name":        name,
+		"version":     version,
+		"description": "Generated by the data simulator",
+		"main":        "index.js",
+		"license":     "MIT",
+	}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	tgz, err := tarArchive([]archiveEntry{
+		{"package/package.json", pkgJSON},
+		{"package/index.js", []byte("module.exports = {};\n")},
+		{"package/data.bin", payload},
+	}, true)
+	if err != nil {
+		return nil, err
+	}
+	return &Package{Format: FormatNpm, Name: name, Version: version, Files: []File{
+		{Path: path.Join(name, "-", name+"-"+version+".tgz"), Data: tgz},
+	}}, nil
+}
+
+// newPypiPackage generates a pure python wheel
+func newPypiPackage(rng *rand.Rand, index int, payload []byte) (*Package, error) {
+	name := packageName(rng, index, "_")
+	version := packageVersion(rng)
+	distInfo := name + "-" + version + ".dist-info"
+	entries := []archiveEntry{
+		{name + "/__init__.py", []byte("")},
+		{name + "/data.bin", payload},
+		{distInfo + "/METADATA", []byte(fmt.Sprintf("Metadata-Version: 2.1\nName: %s\nVersion: %s\nSummary: Generated by the data simulator\n", name, version))},
+		{distInfo + "/WHEEL", []byte("Wheel-Version: 1.0\nGenerator: datasim\nRoot-Is-Purelib: true\nTag: py3-none-any\n")},
+	}
+	record := &bytes.Buffer{}
+	for _, e := range entries {
+		sum := sha256.Sum256(e.data)
+		fmt.Fprintf(record, "%s,sha256=%s,%d\n", e.name, base64.RawURLEncoding.EncodeToString(sum[:]), len(e.data))
+	}
+	fmt.Fprintf(record, "%s/RECORD,,\n", distInfo)
+	entries = append(entries, archiveEntry{distInfo + "/RECORD", record.Bytes()})
+	whl, err := zipArchive(entries)
+	if err != nil {
+		return nil, err
+	}
+	return &Package{Format: FormatPypi, Name: name, Version: version, Files: []File{
+		{Path: path.Join(name, version, name+"-"+version+"-py3-none-any.whl"), Data: whl},
+	}}, nil
+}
+
+// arArchive creates an ar archive as used by debian packages
+func arArchive(entries []archiveEntry) []byte {
+	buf := &bytes.Buffer{}
+	buf.WriteString("!<arch>\n")
+	for _, e := range entries {
+		fmt.Fprintf(buf, "%-16s%-12d%-6d%-6d%-8s%-10d`\n", e.name, modTime.Unix(), 0, 0, "100644", len(e.data))
+		buf.Write(e.data)
+		if len(e.data)%2 == 1 {
+			buf.WriteByte('\n')
+		}
+	}
+	return buf.Bytes()
+}
+
+// newDebianPackage generates a .deb with its control metadata
+func newDebianPackage(rng *rand.Rand, index int, payload []byte) (*Package, error) {
+	name := packageName(rng, index, "-")
+	version := packageVersion(rng)
+	control := fmt.Sprintf("Package: %s\nVersion: %s\nArchitecture: amd64\nMaintainer: datasim <datasim@example.com>\nSection: misc\nPriority: optional\nInstalled-Size: %d\nDescription: Generated by the data simulator\n",
+		name, version, (len(payload)+1023)/1024)
+	controlTgz, err := tarArchive([]archiveEntry{{"./control", []byte(control)}}, true)
+	if err != nil {
+		return nil, err
+	}
+	dataTgz, err := tarArchive([]archiveEntry{{"./usr/share/" + name + "/data.bin", payload}}, true)
+	if err != nil {
+		return nil, err
+	}
+	deb := arArchive([]archiveEntry{
+		{"debian-binary", []byte("2.0\n")},
+		{"control.tar.gz", controlTgz},
+		{"data.tar.gz", dataTgz},
+	})
+	return &Package{Format: FormatDebian, Name: name, Version: version, Files: []File{
+		{
+			Path:         path.Join("pool", name, name+"_"+version+"_amd64.deb"),
+			MatrixParams: ";deb.distribution=focal;deb.component=main;deb.architecture=amd64",
+			Data:         deb,
+		},
+	}}, nil
+}
+
+// newHelmPackage generates a helm chart archive
+func newHelmPackage(rng *rand.Rand, index int, payload []byte) (*Package, error) {
+	name := packageName(rng, index, "-")
+	version := packageVersion(rng)
+	chart := fmt.Sprintf("apiVersion: v2\nname: %s\nversion: %s\nappVersion: \"%s\"\ndescription: Generated by the data simulator\ntype: application\n", name, version, version)
+	tgz, err := tarArchive([]archiveEntry{
+		{name + "/Chart.yaml", []byte(chart)},
+		{name + "/values.yaml", []byte("replicaCount: 1\n")},
+		{name + "/templates/configmap.yaml", []byte("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: {{ .Release.Name }}\n")},
+		{name + "/files/data.bin", payload},
+	}, true)
+	if err != nil {
+		return nil, err
+	}
+	return &Package{Format: FormatHelm, Name: name, Version: version, Files: []File{
+		{Path: name + "-" + version + ".tgz", Data: tgz},
+	}}, nil
+}
+
+// Media types of the generated docker images
+const (
+	MediaTypeManifest = "application/vnd.docker.distribution.manifest.v2+json"
+	MediaTypeConfig   = "application/vnd.docker.container.image.v1+json"
+	MediaTypeLayer    = "application/vnd.docker.image.rootfs.diff.tar.gzip"
+)
+
+// Digest returns the sha256 digest of data in the docker notation
+func Digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// Descriptor references a blob in a docker manifest
+type Descriptor struct {
+	MediaType string `json:"mediaType"`
+	Size      int    `json:"size"`
+	Digest    string `json:"digest"`
+}
+
+// Manifest is a docker image manifest, schema 2
+type Manifest struct {
+	SchemaVersion int          `json:"schemaVersion"`
+	MediaType     string       `json:"mediaType"`
+	Config        Descriptor   `json:"config"`
+	Layers        []Descriptor `json:"layers"`
+}
+
+// Image is a generated docker image with its blobs and manifest
+type Image struct {
+	Name     string
+	Tag      string
+	Config   []byte
+	Layers   [][]byte
+	Manifest []byte
+}
+
+// NewImage generates the index-th docker image with a single layer holding payload
+func NewImage(rng *rand.Rand, index int, payload []byte) (*Image, error) {
+	name := "datasim/" + packageName(rng, index, "-")
+	tag := packageVersion(rng)
+	layer, err := tarArchive([]archiveEntry{{"data/data.bin", payload}}, true)
+	if err != nil {
+		return nil, err
+	}
+	layerTar, err := tarArchive([]archiveEntry{{"data/data.bin", payload}}, false)
+	if err != nil {
+		return nil, err
+	}
+	config, err := json.Marshal(map[string]interface{}{
+		"architecture": "amd64",
+		"os":           "linux",
+		"created":      modTime.Format(time.RFC3339),
+		"config":       map[string]interface{}{"Cmd": []string{"/bin/true"}},
+		"rootfs":       map[string]interface{}{"type": "layers", "diff_ids": []string{Digest(layerTar)}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := json.MarshalIndent(Manifest{
+		SchemaVersion: 2,
+		MediaType:     MediaTypeManifest,
+		Config:        Descriptor{MediaTypeConfig, len(config), Digest(config)},
+		Layers:        []Descriptor{{MediaTypeLayer, len(layer), Digest(layer)}},
+	}, "", "   ")
+	if err != nil {
+		return nil, err
+	}
+	return &Image{Name: name, Tag: tag, Config: config, Layers: [][]byte{layer}, Manifest: manifest}, nil
+}
+
+// newDockerImage generates a docker image laid out as Artifactory stores it,
+// blobs named after their digest next to the manifest.json of the tag
+func newDockerImage(rng *rand.Rand, index int, payload []byte) (*Package, error) {
+	img, err := NewImage(rng, index, payload)
+	if err != nil {
+		return nil, err
+	}
+	dir := path.Join(img.Name, img.Tag)
+	blobPath := func(data []byte) string {
+		return path.Join(dir, strings.Replace(Digest(data), ":", "__", 1))
+	}
+	files := []File{{Path: blobPath(img.Config), Data: img.Config}}
+	for _, l := range img.Layers {
+		files = append(files, File{Path: blobPath(l), Data: l})
+	}
+	// The manifest goes last, once the blobs it references are deployed
+	files = append(files, File{Path: path.Join(dir, "manifest.json"), Data: img.Manifest})
+	return &Package{Format: FormatDocker, Name: img.Name, Version: img.Tag, Files: files}, nil
+}
@@ -0,0 +1,331 @@
+package generator
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"path"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// newTestPackage generates the index-th package of the format from a fixed seed
+func newTestPackage(t *testing.T, format string, seed int64, index int) *Package {
+	pkg, err := NewPackage(format, NewRand(seed, index), index, 1000+int64(index), 2, 4)
+	if err != nil {
+		t.Fatalf("NewPackage(%s) failed: %v", format, err)
+	}
+	return pkg
+}
+
+func TestNewPackageDeterministic(t *testing.T) {
+	for _, format := range Formats {
+		a := newTestPackage(t, format, 42, 3)
+		b := newTestPackage(t, format, 42, 3)
+		if a.Name != b.Name || a.Version != b.Version || len(a.Files) != len(b.Files) {
+			t.Errorf("%s: regenerated %s %s with %d files, want %s %s with %d files",
+				format, b.Name, b.Version, len(b.Files), a.Name, a.Version, len(a.Files))
+			continue
+		}
+		for i := range a.Files {
+			if a.Files[i].Path != b.Files[i].Path || a.Files[i].MatrixParams != b.Files[i].MatrixParams ||
+				!bytes.Equal(a.Files[i].Data, b.Files[i].Data) {
+				t.Errorf("%s: file %d differs when regenerated with the same seed", format, i)
+			}
+		}
+		c := newTestPackage(t, format, 43, 3)
+		if bytes.Equal(a.Files[len(a.Files)-1].Data, c.Files[len(c.Files)-1].Data) {
+			t.Errorf("%s: another seed generated the same content", format)
+		}
+	}
+	if _, err := NewPackage("conan", NewRand(1, 0), 0, 10, 0, 0); err == nil {
+		t.Errorf("NewPackage(conan) succeeded")
+	}
+}
+
+// zipEntries returns the content of each entry of a zip archive
+func zipEntries(t *testing.T, data []byte) map[string][]byte {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("invalid zip: %v", err)
+	}
+	entries := map[string][]byte{}
+	for _, f := range zr.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatalf("zip entry %s: %v", f.Name, err)
+		}
+		content, err := ioutil.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatalf("zip entry %s: %v", f.Name, err)
+		}
+		entries[f.Name] = content
+	}
+	return entries
+}
+
+// tarEntries returns the content of each entry of a tar archive, gzip
+// compressed if gz is set
+func tarEntries(t *testing.T, data []byte, gz bool) map[string][]byte {
+	var r io.Reader = bytes.NewReader(data)
+	if gz {
+		gr, err := gzip.NewReader(r)
+		if err != nil {
+			t.Fatalf("invalid gzip: %v", err)
+		}
+		r = gr
+	}
+	tr := tar.NewReader(r)
+	entries := map[string][]byte{}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return entries
+		}
+		if err != nil {
+			t.Fatalf("invalid tar: %v", err)
+		}
+		content, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatalf("tar entry %s: %v", hdr.Name, err)
+		}
+		entries[hdr.Name] = content
+	}
+}
+
+// arEntries returns the content of each member of an ar archive, in order
+func arEntries(t *testing.T, data []byte) ([]string, map[string][]byte) {
+	if !bytes.HasPrefix(data, []byte("!<arch>\n")) {
+		t.Fatalf("missing ar magic")
+	}
+	names := []string{}
+	entries := map[string][]byte{}
+	data = data[8:]
+	for len(data) > 0 {
+		if len(data) < 60 || string(data[58:60]) != "`\n" {
+			t.Fatalf("invalid ar header %q", data[:60])
+		}
+		name := strings.TrimSpace(string(data[0:16]))
+		if _, err := strconv.ParseInt(strings.TrimSpace(string(data[16:28])), 10, 64); err != nil {
+			t.Fatalf("ar member %s: invalid mtime: %v", name, err)
+		}
+		if _, err := strconv.ParseInt(strings.TrimSpace(string(data[40:48])), 8, 64); err != nil {
+			t.Fatalf("ar member %s: invalid mode: %v", name, err)
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(string(data[48:58])))
+		if err != nil || 60+size > len(data) {
+			t.Fatalf("ar member %s: invalid size %q", name, data[48:58])
+		}
+		names = append(names, name)
+		entries[name] = data[60 : 60+size]
+		data = data[60+size:]
+		if size%2 == 1 {
+			if data[0] != '\n' {
+				t.Fatalf("ar member %s: missing padding", name)
+			}
+			data = data[1:]
+		}
+	}
+	return names, entries
+}
+
+// fileOf returns the data of the package file whose path has the suffix
+func fileOf(t *testing.T, pkg *Package, suffix string) []byte {
+	for _, f := range pkg.Files {
+		if strings.HasSuffix(f.Path, suffix) {
+			return f.Data
+		}
+	}
+	t.Fatalf("%s: no file ending with %s in %+v", pkg.Format, suffix, pkg.Files)
+	return nil
+}
+
+func TestGenericPackage(t *testing.T) {
+	pkg := newTestPackage(t, FormatGeneric, 42, 5)
+	if len(pkg.Files) != 1 || pkg.Files[0].Path != "d0-1/d1-1/file-000005.bin" || len(pkg.Files[0].Data) != 1005 {
+		t.Errorf("generic package = %s with %d bytes", pkg.Files[0].Path, len(pkg.Files[0].Data))
+	}
+}
+
+func TestMavenPackage(t *testing.T) {
+	pkg := newTestPackage(t, FormatMaven, 42, 1)
+	pom := fileOf(t, pkg, ".pom")
+	var project struct {
+		GroupID    string `xml:"groupId"`
+		ArtifactID string `xml:"artifactId"`
+		Version    string `xml:"version"`
+		Packaging  string `xml:"packaging"`
+	}
+	if err := xml.Unmarshal(pom, &project); err != nil {
+		t.Fatalf("invalid pom: %v", err)
+	}
+	if project.GroupID+":"+project.ArtifactID != pkg.Name || project.Version != pkg.Version || project.Packaging != "jar" {
+		t.Errorf("pom coordinates %+v, want %s:%s", project, pkg.Name, pkg.Version)
+	}
+	dir := path.Join(strings.Replace(project.GroupID, ".", "/", -1), project.ArtifactID, project.Version)
+	base := project.ArtifactID + "-" + project.Version
+	if pkg.Files[0].Path != path.Join(dir, base+".pom") || pkg.Files[1].Path != path.Join(dir, base+".jar") {
+		t.Errorf("maven paths %s and %s, want them in %s", pkg.Files[0].Path, pkg.Files[1].Path, dir)
+	}
+	entries := zipEntries(t, fileOf(t, pkg, ".jar"))
+	if !strings.HasPrefix(string(entries["META-INF/MANIFEST.MF"]), "Manifest-Version: 1.0") {
+		t.Errorf("jar manifest = %q", entries["META-INF/MANIFEST.MF"])
+	}
+	if !bytes.Equal(entries[path.Join("META-INF/maven", project.GroupID, project.ArtifactID, "pom.xml")], pom) {
+		t.Errorf("jar does not embed the pom")
+	}
+}
+
+func TestNpmPackage(t *testing.T) {
+	pkg := newTestPackage(t, FormatNpm, 42, 1)
+	tgz := fileOf(t, pkg, ".tgz")
+	if pkg.Files[0].Path != path.Join(pkg.Name, "-", pkg.Name+"-"+pkg.Version+".tgz") {
+		t.Errorf("npm path = %s", pkg.Files[0].Path)
+	}
+	entries := tarEntries(t, tgz, true)
+	var pkgJSON struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	}
+	if err := json.Unmarshal(entries["package/package.json"], &pkgJSON); err != nil {
+		t.Fatalf("invalid package.json: %v", err)
+	}
+	if pkgJSON.Name != pkg.Name || pkgJSON.Version != pkg.Version {
+		t.Errorf("package.json = %+v, want %s@%s", pkgJSON, pkg.Name, pkg.Version)
+	}
+	if len(entries["package/data.bin"]) != 1001 {
+		t.Errorf("payload of %d bytes, want 1001", len(entries["package/data.bin"]))
+	}
+}
+
+func TestPypiPackage(t *testing.T) {
+	pkg := newTestPackage(t, FormatPypi, 42, 1)
+	if !strings.HasSuffix(pkg.Files[0].Path, "/"+pkg.Name+"-"+pkg.Version+"-py3-none-any.whl") {
+		t.Errorf("wheel path = %s", pkg.Files[0].Path)
+	}
+	entries := zipEntries(t, pkg.Files[0].Data)
+	distInfo := pkg.Name + "-" + pkg.Version + ".dist-info/"
+	if !strings.Contains(string(entries[distInfo+"METADATA"]), "\nName: "+pkg.Name+"\nVersion: "+pkg.Version+"\n") {
+		t.Errorf("METADATA = %q", entries[distInfo+"METADATA"])
+	}
+	if !strings.Contains(string(entries[distInfo+"WHEEL"]), "Tag: py3-none-any") {
+		t.Errorf("WHEEL = %q", entries[distInfo+"WHEEL"])
+	}
+	// Every entry but the RECORD itself is listed with its hash and size
+	record := strings.Split(strings.TrimSpace(string(entries[distInfo+"RECORD"])), "\n")
+	if len(record) != len(entries) {
+		t.Errorf("RECORD lists %d files, the wheel has %d", len(record), len(entries))
+	}
+	for _, line := range record {
+		fields := strings.Split(line, ",")
+		if len(fields) != 3 {
+			t.Errorf("invalid RECORD line %q", line)
+			continue
+		}
+		if fields[0] == distInfo+"RECORD" {
+			continue
+		}
+		data, ok := entries[fields[0]]
+		sum := sha256.Sum256(data)
+		if !ok || fields[1] != "sha256="+base64.RawURLEncoding.EncodeToString(sum[:]) || fields[2] != strconv.Itoa(len(data)) {
+			t.Errorf("RECORD line %q does not match the entry", line)
+		}
+	}
+}
+
+func TestDebianPackage(t *testing.T) {
+	pkg := newTestPackage(t, FormatDebian, 42, 1)
+	if pkg.Files[0].Path != path.Join("pool", pkg.Name, pkg.Name+"_"+pkg.Version+"_amd64.deb") ||
+		!strings.Contains(pkg.Files[0].MatrixParams, "deb.distribution=") {
+		t.Errorf("deb path = %s%s", pkg.Files[0].Path, pkg.Files[0].MatrixParams)
+	}
+	names, members := arEntries(t, pkg.Files[0].Data)
+	if strings.Join(names, ",") != "debian-binary,control.tar.gz,data.tar.gz" {
+		t.Fatalf("deb members = %v", names)
+	}
+	if string(members["debian-binary"]) != "2.0\n" {
+		t.Errorf("debian-binary = %q", members["debian-binary"])
+	}
+	control := string(tarEntries(t, members["control.tar.gz"], true)["./control"])
+	if !strings.HasPrefix(control, "Package: "+pkg.Name+"\nVersion: "+pkg.Version+"\n") {
+		t.Errorf("control = %q", control)
+	}
+	if len(tarEntries(t, members["data.tar.gz"], true)["./usr/share/"+pkg.Name+"/data.bin"]) != 1001 {
+		t.Errorf("data.tar.gz does not hold the payload")
+	}
+}
+
+func TestHelmPackage(t *testing.T) {
+	pkg := newTestPackage(t, FormatHelm, 42, 1)
+	if pkg.Files[0].Path != pkg.Name+"-"+pkg.Version+".tgz" {
+		t.Errorf("chart path = %s", pkg.Files[0].Path)
+	}
+	entries := tarEntries(t, pkg.Files[0].Data, true)
+	chart := string(entries[pkg.Name+"/Chart.yaml"])
+	if !strings.HasPrefix(chart, "apiVersion: v2\nname: "+pkg.Name+"\nversion: "+pkg.Version+"\n") {
+		t.Errorf("Chart.yaml = %q", chart)
+	}
+	if _, ok := entries[pkg.Name+"/values.yaml"]; !ok {
+		t.Errorf("chart without values.yaml")
+	}
+}
+
+func TestDockerPackage(t *testing.T) {
+	pkg := newTestPackage(t, FormatDocker, 42, 1)
+	dir := path.Join(pkg.Name, pkg.Version)
+	last := pkg.Files[len(pkg.Files)-1]
+	if last.Path != path.Join(dir, "manifest.json") {
+		t.Fatalf("last file = %s, want the manifest", last.Path)
+	}
+	manifest := Manifest{}
+	if err := json.Unmarshal(last.Data, &manifest); err != nil {
+		t.Fatalf("invalid manifest: %v", err)
+	}
+	if manifest.SchemaVersion != 2 || manifest.MediaType != MediaTypeManifest || len(manifest.Layers) != 1 {
+		t.Fatalf("manifest = %+v", manifest)
+	}
+	blobs := map[string][]byte{}
+	for _, f := range pkg.Files[:len(pkg.Files)-1] {
+		blobs[path.Base(f.Path)] = f.Data
+	}
+	for _, desc := range append([]Descriptor{manifest.Config}, manifest.Layers...) {
+		data, ok := blobs[strings.Replace(desc.Digest, ":", "__", 1)]
+		if !ok || Digest(data) != desc.Digest || len(data) != desc.Size {
+			t.Errorf("blob %s of %d bytes is missing or does not match", desc.Digest, desc.Size)
+		}
+	}
+
+	// The config lists the digest of the uncompressed layer
+	layer := blobs[strings.Replace(manifest.Layers[0].Digest, ":", "__", 1)]
+	gr, err := gzip.NewReader(bytes.NewReader(layer))
+	if err != nil {
+		t.Fatalf("invalid layer: %v", err)
+	}
+	layerTar, err := ioutil.ReadAll(gr)
+	if err != nil {
+		t.Fatalf("invalid layer: %v", err)
+	}
+	if len(tarEntries(t, layerTar, false)["data/data.bin"]) != 1001 {
+		t.Errorf("layer does not hold the payload")
+	}
+	var config struct {
+		Rootfs struct {
+			DiffIds []string `json:"diff_ids"`
+		} `json:"rootfs"`
+	}
+	if err := json.Unmarshal(blobs[strings.Replace(manifest.Config.Digest, ":", "__", 1)], &config); err != nil {
+		t.Fatalf("invalid config: %v", err)
+	}
+	if len(config.Rootfs.DiffIds) != 1 || config.Rootfs.DiffIds[0] != Digest(layerTar) {
+		t.Errorf("diff_ids = %v, want %s", config.Rootfs.DiffIds, Digest(layerTar))
+	}
+}
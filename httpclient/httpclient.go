@@ -0,0 +1,202 @@
+package httpclient
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults used for the settings left unset in Config
+const (
+	DefaultConnectTimeoutSecs  = 30
+	DefaultReadTimeoutSecs     = 120
+	DefaultMaxIdleConns        = 100
+	DefaultMaxIdleConnsPerHost = 64
+)
+
+// Config of the http client used to talk to one Artifactory instance
+type Config struct {
+	CaCertsDir          string `yaml:"cacertsdir"`
+	InsecureSkipVerify  bool   `yaml:"insecureskipverify"`
+	ClientCertPath      string `yaml:"clientcertpath"`
+	ClientCertKeyPath   string `yaml:"clientcertkeypath"`
+	Proxy               string `yaml:"proxy"`
+	ConnectTimeoutSecs  int    `yaml:"connecttimeoutsecs"`
+	ReadTimeoutSecs     int    `yaml:"readtimeoutsecs"`
+	RequestTimeoutSecs  int    `yaml:"requesttimeoutsecs"`
+	MaxIdleConns        int    `yaml:"maxidleconns"`
+	MaxIdleConnsPerHost int    `yaml:"maxidleconnsperhost"`
+	MaxConnsPerHost     int    `yaml:"maxconnsperhost"`
+}
+
+// withDefaults returns a copy of the config with unset values defaulted
+func (c Config) withDefaults() Config {
+	if c.ConnectTimeoutSecs == 0 {
+		c.ConnectTimeoutSecs = DefaultConnectTimeoutSecs
+	}
+	if c.ReadTimeoutSecs == 0 {
+		c.ReadTimeoutSecs = DefaultReadTimeoutSecs
+	}
+	if c.MaxIdleConns == 0 {
+		c.MaxIdleConns = DefaultMaxIdleConns
+	}
+	if c.MaxIdleConnsPerHost == 0 {
+		c.MaxIdleConnsPerHost = DefaultMaxIdleConnsPerHost
+	}
+	return c
+}
+
+// loadCaCerts returns the system cert pool extended with every PEM file of dir
+func loadCaCerts(dir string) (*x509.CertPool, error) {
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read CA certs dir '%s': %v", dir, err)
+	}
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		pem, err := ioutil.ReadFile(filepath.Join(dir, f.Name()))
+		if err != nil {
+			return nil, err
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no PEM certificate found in '%s'", filepath.Join(dir, f.Name()))
+		}
+	}
+	return pool, nil
+}
+
+// idleTimeoutConn fails a read or a write once the connection made no
+// progress for timeout, so a transfer stalled mid-body does not hang forever
+// while a long but flowing one is not cut. Writes push the read deadline too:
+// net/http starts reading as soon as the connection exists, so without that
+// an upload taking longer than timeout would be cut while still sending
+type idleTimeoutConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func (c *idleTimeoutConn) Read(b []byte) (int, error) {
+	if err := c.Conn.SetReadDeadline(time.Now().Add(c.timeout)); err != nil {
+		return 0, err
+	}
+	return c.Conn.Read(b)
+}
+
+func (c *idleTimeoutConn) Write(b []byte) (int, error) {
+	if err := c.Conn.SetDeadline(time.Now().Add(c.timeout)); err != nil {
+		return 0, err
+	}
+	return c.Conn.Write(b)
+}
+
+// New creates an http client from the config
+func New(cfg Config) (*http.Client, error) {
+	c := cfg.withDefaults()
+
+	tlsCfg := &tls.Config{InsecureSkipVerify: c.InsecureSkipVerify}
+	if c.CaCertsDir != "" {
+		pool, err := loadCaCerts(c.CaCertsDir)
+		if err != nil {
+			return nil, err
+		}
+		tlsCfg.RootCAs = pool
+	}
+	if c.ClientCertPath != "" {
+		cert, err := tls.LoadX509KeyPair(c.ClientCertPath, c.ClientCertKeyPath)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load client cert '%s': %v", c.ClientCertPath, err)
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+
+	proxy := http.ProxyFromEnvironment
+	if c.Proxy != "" {
+		proxyURL, err := url.Parse(c.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy '%s': %v", c.Proxy, err)
+		}
+		proxy = http.ProxyURL(proxyURL)
+	}
+
+	connectTimeout := time.Duration(c.ConnectTimeoutSecs) * time.Second
+	readTimeout := time.Duration(c.ReadTimeoutSecs) * time.Second
+	dialer := &net.Dialer{
+		Timeout:   connectTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+	transport := &http.Transport{
+		Proxy: proxy,
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			conn, err := dialer.DialContext(ctx, network, addr)
+			if err != nil {
+				return nil, err
+			}
+			return &idleTimeoutConn{Conn: conn, timeout: readTimeout}, nil
+		},
+		TLSClientConfig:       tlsCfg,
+		TLSHandshakeTimeout:   connectTimeout,
+		ResponseHeaderTimeout: readTimeout,
+		ExpectContinueTimeout: 1 * time.Second,
+		IdleConnTimeout:       90 * time.Second,
+		MaxIdleConns:          c.MaxIdleConns,
+		MaxIdleConnsPerHost:   c.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       c.MaxConnsPerHost,
+	}
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   time.Duration(c.RequestTimeoutSecs) * time.Second,
+	}, nil
+}
+
+var (
+	mu            sync.RWMutex
+	clients       = map[string]*http.Client{}
+	defaultClient *http.Client
+)
+
+// normalizeURL makes the registry key independent of a trailing slash
+func normalizeURL(baseURL string) string {
+	return strings.TrimSuffix(baseURL, "/")
+}
+
+// Register makes the client the one used for requests to baseURL
+func Register(baseURL string, client *http.Client) {
+	mu.Lock()
+	defer mu.Unlock()
+	clients[normalizeURL(baseURL)] = client
+}
+
+// Get returns the client registered for baseURL, or a client with default
+// settings when none is registered
+func Get(baseURL string) *http.Client {
+	mu.RLock()
+	client, ok := clients[normalizeURL(baseURL)]
+	mu.RUnlock()
+	if ok {
+		return client
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if defaultClient == nil {
+		// The default config has no files to load, so it cannot fail
+		defaultClient, _ = New(Config{})
+	}
+	return defaultClient
+}
@@ -0,0 +1,95 @@
+package httpclient
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// slowReader hands out one chunk per interval until total is reached
+type slowReader struct {
+	chunk    int
+	left     int
+	interval time.Duration
+}
+
+func (r *slowReader) Read(b []byte) (int, error) {
+	if r.left <= 0 {
+		return 0, io.EOF
+	}
+	time.Sleep(r.interval)
+	n := r.chunk
+	if n > r.left {
+		n = r.left
+	}
+	if n > len(b) {
+		n = len(b)
+	}
+	for i := 0; i < n; i++ {
+		b[i] = 'x'
+	}
+	r.left -= n
+	return n, nil
+}
+
+func TestSlowUploadOutlivesReadTimeout(t *testing.T) {
+	const chunk, chunks = 1024, 15
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := ioutil.ReadAll(r.Body)
+		if err != nil || len(b) != chunk*chunks {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer srv.Close()
+
+	client, err := New(Config{ReadTimeoutSecs: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 15 chunks 200ms apart take 3s, well past the 1s idle read timeout
+	body := &slowReader{chunk: chunk, left: chunk * chunks, interval: 200 * time.Millisecond}
+	req, err := http.NewRequest(http.MethodPut, srv.URL, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.ContentLength = chunk * chunks
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("upload failed after %v: %v", time.Since(start), err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("status %d, want %d", resp.StatusCode, http.StatusCreated)
+	}
+}
+
+func TestStalledResponseTimesOut(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("partial"))
+		w.(http.Flusher).Flush()
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	client, err := New(Config{ReadTimeoutSecs: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if _, err := ioutil.ReadAll(resp.Body); err == nil {
+		t.Fatal("expected the stalled body read to time out")
+	}
+}
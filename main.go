@@ -6,11 +6,58 @@ import (
 	"time"
 
 	jflog "github.com/jfrog/jfrog-client-go/utils/log"
+	"jfrog.com/datasim/capacity"
 	"jfrog.com/datasim/confighandler"
+	"jfrog.com/datasim/redact"
 	"jfrog.com/datasim/remoteartifacts"
 	"jfrog.com/datasim/simulator"
+	"jfrog.com/datasim/stats"
 )
 
+// writeReport logs the per DUT report and writes it as JSON to reportFile if set
+func writeReport(reportFile string) {
+	stats.LogReport()
+	if reportFile == "" {
+		return
+	}
+	f, err := os.Create(reportFile)
+	if err != nil {
+		jflog.Error(fmt.Sprintf("Unable to create report file %s", reportFile))
+		return
+	}
+	defer f.Close()
+	if err := stats.WriteReport(redact.NewWriter(f)); err != nil {
+		jflog.Error(fmt.Sprintf("Failed writing report file %s : %v", reportFile, err))
+	}
+}
+
+// writeCapacityPlan stops the storage samplers, logs the capacity plan of each
+// DUT and writes them as JSON to reportFile if set
+func writeCapacityPlan(samplers []*capacity.Sampler, reportFile string) {
+	projections := []*capacity.Projection{}
+	results, errs := capacity.StopAll(samplers)
+	for i, p := range results {
+		if errs[i] != nil {
+			jflog.Error(fmt.Sprintf("Failed capacity planning : %v", errs[i]))
+			continue
+		}
+		capacity.LogProjection(p)
+		projections = append(projections, p)
+	}
+	if reportFile == "" {
+		return
+	}
+	f, err := os.Create(reportFile)
+	if err != nil {
+		jflog.Error(fmt.Sprintf("Unable to create capacity report file %s", reportFile))
+		return
+	}
+	defer f.Close()
+	if err := capacity.WriteProjections(f, projections); err != nil {
+		jflog.Error(fmt.Sprintf("Failed writing capacity report file %s : %v", reportFile, err))
+	}
+}
+
 func main() {
 
 	f, err := os.OpenFile("./datasim.log", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
@@ -21,12 +68,13 @@ func main() {
 	}
 	defer f.Close()
 
-	jflog.SetLogger(jflog.NewLogger(jflog.INFO, f))
+	// Secrets resolved from the credentials are masked in everything logged
+	jflog.SetLogger(jflog.NewLogger(jflog.INFO, redact.NewWriter(f)))
 	jflog.Info("Started data simulator")
 
 	cfg, err := confighandler.NewRtConfig()
 	if err != nil {
-		jflog.Error("Cli parse failure")
+		jflog.Error(fmt.Sprintf("Cli parse failure : %v", err))
 		os.Exit(-1)
 	}
 	if err := cfg.InitConfigs(); err != nil {
@@ -34,6 +82,10 @@ func main() {
 		os.Exit(-1)
 	}
 
+	if cfg.SimulationCfg.GenericSimCfg.HttpRetry != nil {
+		remoteartifacts.SetRetryPolicy(*cfg.SimulationCfg.GenericSimCfg.HttpRetry)
+	}
+
 	refRtDetails := cfg.GetRefRtDetails()
 	refRtMgr, err := cfg.GetRtMgr(refRtDetails)
 	refRtVer, err := refRtMgr.GetVersion()
@@ -45,29 +97,60 @@ func main() {
 	refRtSvcID, err := refRtMgr.GetServiceId()
 	jflog.Info("Ref RT ServiceId = ", refRtSvcID)
 
-	dutRtDetails := cfg.GetDutRtDetails()
-	dutRtMgr, err := cfg.GetRtMgr(dutRtDetails)
-	if err != nil {
-		jflog.Error("Failure in getting DUT RT Manager")
-		os.Exit(-1)
-	}
-	dutRtVer, err := dutRtMgr.GetVersion()
-	if err != nil {
-		jflog.Error("Failure in getting DUT RT Version")
-		os.Exit(-1)
+	duts := []*simulator.Dut{}
+	for _, name := range cfg.GetDutNames() {
+		dutRtDetails, err := cfg.GetDutRtDetails(name)
+		if err != nil {
+			jflog.Error(fmt.Sprintf("Failure in getting DUT %s RT Details", name))
+			os.Exit(-1)
+		}
+		dutRtMgr, err := cfg.GetRtMgr(dutRtDetails)
+		if err != nil {
+			jflog.Error(fmt.Sprintf("Failure in getting DUT %s RT Manager", name))
+			os.Exit(-1)
+		}
+		dutRtVer, err := dutRtMgr.GetVersion()
+		if err != nil {
+			jflog.Error(fmt.Sprintf("Failure in getting DUT %s RT Version", name))
+			os.Exit(-1)
+		}
+		jflog.Info(fmt.Sprintf("DUT %s RT Version = %s", name, dutRtVer))
+		dutRtSvcID, err := dutRtMgr.GetServiceId()
+		jflog.Info(fmt.Sprintf("DUT %s RT ServiceId = %s", name, dutRtSvcID))
+		duts = append(duts, simulator.NewDut(name, &dutRtDetails, &dutRtMgr))
 	}
-	jflog.Info("DUT RT Version = ", dutRtVer)
-	dutRtSvcID, err := refRtMgr.GetServiceId()
-	jflog.Info("DUT RT ServiceId = ", dutRtSvcID)
 
 	jflog.Info(fmt.Sprintf("RemoteHttpConnCfg-RemoteRepos = %+v", cfg.SimulationCfg.RemoteHttpConnCfg.RemoteRepos))
+	jflog.Info(fmt.Sprintf("RemoteHttpConnCfg-AutoSelect = %+v", cfg.SimulationCfg.RemoteHttpConnCfg.AutoSelect))
 	jflog.Info(fmt.Sprintf("GenericSimCfg = %+v", cfg.SimulationCfg.GenericSimCfg.MetricPoll))
 
 	if cfg.SimulationCfg.GenericSimCfg.MetricPoll.Artifactory == true {
-		go remoteartifacts.PollArtiMetricsRestEndpoint(&dutRtDetails, cfg.SimulationCfg.GenericSimCfg.MetricPoll.MetricPollFreq)
+		for _, d := range duts {
+			go remoteartifacts.PollArtiMetricsRestEndpoint(d.RtDetail, cfg.SimulationCfg.GenericSimCfg.MetricPoll.MetricPollFreq)
+		}
 	}
 
-	dataSim := simulator.NewSimulator(&refRtDetails, &dutRtDetails, &refRtMgr, &dutRtMgr)
+	dataSim := simulator.NewSimulator(&refRtDetails, &refRtMgr, duts)
+
+	// Capacity planning samples the storage of the DUTs across the simulations
+	capacityCfg := cfg.SimulationCfg.GenericSimCfg.Capacity
+	samplers := []*capacity.Sampler{}
+	if capacityCfg.Enabled || cfg.Command == confighandler.CommandCapacity {
+		for _, d := range duts {
+			samplers = append(samplers, capacity.NewSampler(d.Name, d.RtDetail, capacityCfg))
+		}
+		capacity.StartAll(samplers)
+	}
+
+	// The capacity command samples the DUTs under their current workload,
+	// without running any simulation
+	if cfg.Command == confighandler.CommandCapacity {
+		jflog.Info(fmt.Sprintf("Sampling the storage of the DUTs for %v", capacityCfg.Duration()))
+		time.Sleep(capacityCfg.Duration())
+		writeCapacityPlan(samplers, capacityCfg.ReportFile)
+		jflog.Info("Ending data simulator")
+		return
+	}
 
 	// RemoteHttpConns Simulation
 	repeatCount := 1
@@ -77,7 +160,7 @@ func main() {
 		repeatFreq = cfg.SimulationCfg.RemoteHttpConnCfg.RepeatFreq
 	}
 	for i := 0; i < repeatCount; i++ {
-		err = dataSim.SimRemoteHttpConns(&cfg.SimulationCfg.RemoteHttpConnCfg.RemoteRepos, cfg.SimulationCfg.RemoteHttpConnCfg.TargetDir)
+		err = dataSim.SimRemoteHttpConns(cfg.SimulationCfg.RemoteHttpConnCfg.TargetCfg, &cfg.SimulationCfg.RemoteHttpConnCfg.RemoteRepos, cfg.SimulationCfg.RemoteHttpConnCfg.AutoSelect, cfg.SimulationCfg.RemoteHttpConnCfg.TargetDir)
 		if err != nil {
 			jflog.Error(fmt.Sprintf("Failed simulation of RemoteHttpConns"))
 		}
@@ -86,7 +169,123 @@ func main() {
 	}
 
 	// DbConns Simulation
-	err = dataSim.SimDbConns(cfg.SimulationCfg.DbConnCfg.NumWorkers, cfg.SimulationCfg.DbConnCfg.NumItersByWorker)
+	err = dataSim.SimDbConns(cfg.SimulationCfg.DbConnCfg.TargetCfg, cfg.SimulationCfg.DbConnCfg.NumWorkers, cfg.SimulationCfg.DbConnCfg.NumItersByWorker)
+
+	// Upload Simulation
+	if cfg.SimulationCfg.UploadCfg.Enabled {
+		if err := dataSim.SimUpload(cfg.SimulationCfg.UploadCfg); err != nil {
+			jflog.Error(fmt.Sprintf("Failed simulation of Upload"))
+		}
+	}
+
+	// Churn Simulation
+	if cfg.SimulationCfg.ChurnCfg.Enabled {
+		if err := dataSim.SimChurn(cfg.SimulationCfg.ChurnCfg); err != nil {
+			jflog.Error(fmt.Sprintf("Failed simulation of Churn"))
+		}
+	}
+
+	// Repo Lifecycle Simulation
+	if cfg.SimulationCfg.RepoLifecycleCfg.Enabled {
+		if err := dataSim.SimRepoLifecycle(cfg.SimulationCfg.RepoLifecycleCfg); err != nil {
+			jflog.Error(fmt.Sprintf("Failed simulation of Repo Lifecycle"))
+		}
+	}
+
+	// Virtual Repo Simulation
+	if cfg.SimulationCfg.VirtualCfg.Enabled {
+		if err := dataSim.SimVirtual(cfg.SimulationCfg.VirtualCfg); err != nil {
+			jflog.Error(fmt.Sprintf("Failed simulation of Virtual Repo"))
+		}
+	}
+
+	// Xray Simulation
+	if cfg.SimulationCfg.XrayCfg.Enabled {
+		if err := dataSim.SimXray(cfg.SimulationCfg.XrayCfg); err != nil {
+			jflog.Error(fmt.Sprintf("Failed simulation of Xray"))
+		}
+	}
+
+	// Build Info Simulation
+	if cfg.SimulationCfg.BuildInfoCfg.Enabled {
+		if err := dataSim.SimBuildInfo(cfg.SimulationCfg.BuildInfoCfg); err != nil {
+			jflog.Error(fmt.Sprintf("Failed simulation of Build Info"))
+		}
+	}
+
+	// Properties Simulation
+	if cfg.SimulationCfg.PropertiesCfg.Enabled {
+		if err := dataSim.SimProperties(cfg.SimulationCfg.PropertiesCfg); err != nil {
+			jflog.Error(fmt.Sprintf("Failed simulation of Properties"))
+		}
+	}
+
+	// Docker Simulation
+	if cfg.SimulationCfg.DockerCfg.Enabled {
+		if err := dataSim.SimDocker(cfg.SimulationCfg.DockerCfg); err != nil {
+			jflog.Error(fmt.Sprintf("Failed simulation of Docker"))
+		}
+	}
+
+	// Native Clients Simulation
+	if cfg.SimulationCfg.NativeCfg.Enabled {
+		if err := dataSim.SimNative(cfg.SimulationCfg.NativeCfg); err != nil {
+			jflog.Error(fmt.Sprintf("Failed simulation of Native Clients"))
+		}
+	}
+
+	// Access Log Replay Simulation
+	if cfg.SimulationCfg.ReplayCfg.Enabled {
+		if err := dataSim.SimReplay(cfg.SimulationCfg.ReplayCfg); err != nil {
+			jflog.Error(fmt.Sprintf("Failed simulation of Replay"))
+		}
+	}
+
+	// Security Simulation
+	if cfg.SimulationCfg.SecurityCfg.Enabled {
+		if err := dataSim.SimSecurity(cfg.SimulationCfg.SecurityCfg); err != nil {
+			jflog.Error(fmt.Sprintf("Failed simulation of Security"))
+		}
+	}
+
+	// Access Tokens Simulation
+	if cfg.SimulationCfg.TokensCfg.Enabled {
+		if err := dataSim.SimTokens(cfg.SimulationCfg.TokensCfg); err != nil {
+			jflog.Error(fmt.Sprintf("Failed simulation of Tokens"))
+		}
+	}
+
+	// Replication Simulation
+	if cfg.SimulationCfg.ReplicationCfg.Enabled {
+		if err := dataSim.SimReplication(cfg.SimulationCfg.ReplicationCfg); err != nil {
+			jflog.Error(fmt.Sprintf("Failed simulation of Replication"))
+		}
+	}
 
+	// Contention Simulation
+	if cfg.SimulationCfg.ContentionCfg.Enabled {
+		if err := dataSim.SimContention(cfg.SimulationCfg.ContentionCfg); err != nil {
+			jflog.Error(fmt.Sprintf("Failed simulation of Contention"))
+		}
+	}
+
+	// Large File Simulation
+	if cfg.SimulationCfg.LargeFileCfg.Enabled {
+		if err := dataSim.SimLargeFile(cfg.SimulationCfg.LargeFileCfg); err != nil {
+			jflog.Error(fmt.Sprintf("Failed simulation of Large File"))
+		}
+	}
+
+	// Deduplication Simulation
+	if cfg.SimulationCfg.DedupCfg.Enabled {
+		if err := dataSim.SimDedup(cfg.SimulationCfg.DedupCfg); err != nil {
+			jflog.Error(fmt.Sprintf("Failed simulation of Dedup"))
+		}
+	}
+
+	if capacityCfg.Enabled {
+		writeCapacityPlan(samplers, capacityCfg.ReportFile)
+	}
+	writeReport(cfg.SimulationCfg.GenericSimCfg.ReportFile)
 	jflog.Info("Ending data simulator")
 }
@@ -0,0 +1,77 @@
+package redact
+
+import (
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Mask is the text that replaces a registered secret
+const Mask = "****"
+
+// minSecretLen avoids masking short values that would garble unrelated text
+const minSecretLen = 4
+
+var (
+	mu       sync.RWMutex
+	secrets  []string
+	replacer *strings.Replacer
+)
+
+// Register adds a secret value that must never appear in logs or reports
+func Register(secret string) {
+	if len(secret) < minSecretLen {
+		return
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for _, s := range secrets {
+		if s == secret {
+			return
+		}
+	}
+	secrets = append(secrets, secret)
+
+	// Replace longer secrets first so a secret containing another is fully masked
+	sort.Slice(secrets, func(i, j int) bool { return len(secrets[i]) > len(secrets[j]) })
+	pairs := make([]string, 0, 2*len(secrets))
+	for _, s := range secrets {
+		pairs = append(pairs, s, Mask)
+	}
+	replacer = strings.NewReplacer(pairs...)
+}
+
+// String returns s with every registered secret masked
+func String(s string) string {
+	mu.RLock()
+	defer mu.RUnlock()
+	if replacer == nil {
+		return s
+	}
+	return replacer.Replace(s)
+}
+
+// Value masks a single secret for display, keeping only whether it is set
+func Value(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return Mask
+}
+
+type writer struct {
+	w io.Writer
+}
+
+// NewWriter wraps w so that registered secrets are masked before being written
+func NewWriter(w io.Writer) io.Writer {
+	return &writer{w: w}
+}
+
+func (rw *writer) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(rw.w, String(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
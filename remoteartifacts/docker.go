@@ -0,0 +1,312 @@
+package remoteartifacts
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+
+	jfauth "github.com/jfrog/jfrog-client-go/auth"
+	"jfrog.com/datasim/httpclient"
+)
+
+// authParamRe matches the key="value" parameters of a WWW-Authenticate challenge
+var authParamRe = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// DockerRegistry is a client of the Docker Registry v2 API of an Artifactory
+// docker repo, authenticating with bearer tokens like the docker client does
+type DockerRegistry struct {
+	artDetails *jfauth.ServiceDetails
+	baseURL    string
+	mu         sync.Mutex
+	challenge  map[string]string
+	tokens     map[string]string
+	fetches    map[string]*tokenFetch
+}
+
+// tokenFetch is a token request in flight, shared by the callers needing the
+// token of its scope meanwhile
+type tokenFetch struct {
+	done  chan struct{}
+	token string
+	err   error
+}
+
+// NewDockerRegistry returns a registry client of the docker repo, reached with
+// the repo path method at api/docker/<repo>/v2/
+func NewDockerRegistry(artDetails *jfauth.ServiceDetails, repo string) *DockerRegistry {
+	return &DockerRegistry{
+		artDetails: artDetails,
+		baseURL:    (*artDetails).GetUrl() + "api/docker/" + repo + "/v2/",
+		tokens:     map[string]string{},
+		fetches:    map[string]*tokenFetch{},
+	}
+}
+
+// PullScope returns the token scope to pull the image name
+func PullScope(name string) string {
+	return "repository:" + name + ":pull"
+}
+
+// PushScope returns the token scope to push the image name
+func PushScope(name string) string {
+	return "repository:" + name + ":pull,push"
+}
+
+// Ping checks the API version endpoint, reading the authentication challenge
+func (r *DockerRegistry) Ping() error {
+	req, err := http.NewRequest("GET", r.baseURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := httpclient.Get((*r.artDetails).GetUrl()).Do(req)
+	if err != nil {
+		return &HttpError{Method: "GET", URL: r.baseURL, Attempts: 1, Err: err}
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized:
+		challenge := resp.Header.Get("WWW-Authenticate")
+		if !strings.HasPrefix(strings.ToLower(challenge), "bearer ") {
+			// Basic authentication only
+			r.challenge = nil
+			return nil
+		}
+		r.challenge = map[string]string{}
+		for _, m := range authParamRe.FindAllStringSubmatch(challenge, -1) {
+			r.challenge[strings.ToLower(m[1])] = m[2]
+		}
+		if r.challenge["realm"] == "" {
+			return fmt.Errorf("no realm in the challenge %q of %s", challenge, r.baseURL)
+		}
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		r.challenge = nil
+	default:
+		return &HttpError{Method: "GET", URL: r.baseURL, StatusCode: resp.StatusCode, Attempts: 1}
+	}
+	return nil
+}
+
+// token returns the bearer token of scope, requesting it from the realm of the
+// challenge with the Artifactory credentials, "" when tokens are not used. The
+// request is made without holding r.mu, and once for concurrent callers.
+func (r *DockerRegistry) token(scope string) (string, error) {
+	r.mu.Lock()
+	if r.challenge == nil {
+		r.mu.Unlock()
+		return "", nil
+	}
+	if t, ok := r.tokens[scope]; ok {
+		r.mu.Unlock()
+		return t, nil
+	}
+	if f, ok := r.fetches[scope]; ok {
+		r.mu.Unlock()
+		<-f.done
+		return f.token, f.err
+	}
+	f := &tokenFetch{done: make(chan struct{})}
+	r.fetches[scope] = f
+	params := url.Values{"scope": {scope}}
+	if service := r.challenge["service"]; service != "" {
+		params.Set("service", service)
+	}
+	realm := r.challenge["realm"]
+	r.mu.Unlock()
+
+	f.token, f.err = r.fetchToken(realm + "?" + params.Encode())
+	r.mu.Lock()
+	if f.err == nil {
+		r.tokens[scope] = f.token
+	}
+	delete(r.fetches, scope)
+	r.mu.Unlock()
+	close(f.done)
+	return f.token, f.err
+}
+
+// fetchToken requests a token from the realm URL
+func (r *DockerRegistry) fetchToken(tokenURL string) (string, error) {
+	data, err := ReadUrl(r.artDetails, tokenURL, nil)
+	if err != nil {
+		return "", err
+	}
+	body := struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}{}
+	if err := json.Unmarshal(data, &body); err != nil {
+		return "", fmt.Errorf("invalid token response of %s: %v", tokenURL, err)
+	}
+	if body.Token == "" {
+		body.Token = body.AccessToken
+	}
+	return body.Token, nil
+}
+
+// dropToken forgets the token of scope, e.g. once expired
+func (r *DockerRegistry) dropToken(scope string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.tokens, scope)
+}
+
+// Do issues a request to the registry with the token of scope. uri is relative
+// to the v2 endpoint unless absolute, like the upload locations. An expired
+// token is renewed once.
+func (r *DockerRegistry) Do(method string, uri string, scope string, body []byte, headers map[string]string) (*http.Response, error) {
+	reqURL := uri
+	if !strings.HasPrefix(uri, "http://") && !strings.HasPrefix(uri, "https://") {
+		base, _ := url.Parse(r.baseURL)
+		ref, err := url.Parse(uri)
+		if err != nil {
+			return nil, err
+		}
+		reqURL = base.ResolveReference(ref).String()
+	}
+	for attempt := 0; ; attempt++ {
+		token, err := r.token(scope)
+		if err != nil {
+			return nil, err
+		}
+		reqHeaders := map[string]string{}
+		for k, v := range headers {
+			reqHeaders[k] = v
+		}
+		if token != "" {
+			reqHeaders["Authorization"] = "Bearer " + token
+		}
+		resp, err := doHttpReqURL(r.artDetails, method, reqURL, body, reqHeaders)
+		if StatusCode(err) == http.StatusUnauthorized && token != "" && attempt == 0 {
+			r.dropToken(scope)
+			continue
+		}
+		return resp, err
+	}
+}
+
+// GetManifest returns the manifest of the image tag or digest
+func (r *DockerRegistry) GetManifest(name string, reference string, mediaType string) ([]byte, error) {
+	resp, err := r.Do("GET", name+"/manifests/"+reference, PullScope(name), nil, map[string]string{"Accept": mediaType})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return ioutil.ReadAll(resp.Body)
+}
+
+// HeadManifest checks the manifest of the image tag or digest and returns its digest
+func (r *DockerRegistry) HeadManifest(name string, reference string, mediaType string) (string, error) {
+	resp, err := r.Do("HEAD", name+"/manifests/"+reference, PullScope(name), nil, map[string]string{"Accept": mediaType})
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	return resp.Header.Get("Docker-Content-Digest"), nil
+}
+
+// PutManifest pushes the manifest of the image tag
+func (r *DockerRegistry) PutManifest(name string, tag string, mediaType string, manifest []byte) error {
+	resp, err := r.Do("PUT", name+"/manifests/"+tag, PushScope(name), manifest, map[string]string{"Content-Type": mediaType})
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// GetBlob downloads the blob, or the byte range [from, to] of it when to is
+// not negative, and returns the number of bytes read
+func (r *DockerRegistry) GetBlob(name string, digest string, from int64, to int64) (int64, error) {
+	headers := map[string]string{}
+	if to >= 0 {
+		headers["Range"] = fmt.Sprintf("bytes=%d-%d", from, to)
+	}
+	resp, err := r.Do("GET", name+"/blobs/"+digest, PullScope(name), nil, headers)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	return io.Copy(ioutil.Discard, resp.Body)
+}
+
+// BlobExists reports whether the blob is already in the registry
+func (r *DockerRegistry) BlobExists(name string, digest string) (bool, error) {
+	resp, err := r.Do("HEAD", name+"/blobs/"+digest, PullScope(name), nil, nil)
+	if IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	return true, nil
+}
+
+// UploadBlob uploads the blob in chunks of chunkSize bytes, the whole blob
+// at once when chunkSize is not positive
+func (r *DockerRegistry) UploadBlob(name string, digest string, data []byte, chunkSize int) error {
+	resp, err := r.Do("POST", name+"/blobs/uploads/", PushScope(name), nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	location := resp.Header.Get("Location")
+	if location == "" {
+		return fmt.Errorf("no upload location for blob %s of %s", digest, name)
+	}
+	if chunkSize <= 0 {
+		chunkSize = len(data)
+	}
+	for offset := 0; offset < len(data); offset += chunkSize {
+		end := offset + chunkSize
+		if end > len(data) {
+			end = len(data)
+		}
+		resp, err := r.Do("PATCH", location, PushScope(name), data[offset:end], map[string]string{
+			"Content-Type":  "application/octet-stream",
+			"Content-Range": fmt.Sprintf("%d-%d", offset, end-1),
+		})
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if l := resp.Header.Get("Location"); l != "" {
+			location = l
+		}
+	}
+	sep := "?"
+	if strings.Contains(location, "?") {
+		sep = "&"
+	}
+	resp, err = r.Do("PUT", location+sep+"digest="+url.QueryEscape(digest), PushScope(name), nil, map[string]string{"Content-Type": "application/octet-stream"})
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// ListTags returns the tags of the image name
+func (r *DockerRegistry) ListTags(name string) ([]string, error) {
+	resp, err := r.Do("GET", name+"/tags/list", PullScope(name), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body := struct {
+		Tags []string `json:"tags"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+	return body.Tags, nil
+}
@@ -0,0 +1,57 @@
+package remoteartifacts
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jfrog/jfrog-client-go/artifactory/auth"
+)
+
+func TestDockerRegistryToken(t *testing.T) {
+	var tokenRequests int32
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/artifactory/api/docker/docker/v2/":
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+server.URL+`/token",service="rt"`)
+			w.WriteHeader(http.StatusUnauthorized)
+		case "/token":
+			atomic.AddInt32(&tokenRequests, 1)
+			// Slow enough for the callers to overlap
+			time.Sleep(50 * time.Millisecond)
+			w.Write([]byte(`{"token":"tok-` + r.URL.Query().Get("scope") + `"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	details := auth.NewArtifactoryDetails()
+	details.SetUrl(server.URL + "/artifactory/")
+	r := NewDockerRegistry(&details, "docker")
+	if err := r.Ping(); err != nil {
+		t.Fatalf("Ping() failed: %v", err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if token, err := r.token(PullScope("img")); err != nil || token != "tok-"+PullScope("img") {
+				t.Errorf("token() = %q, %v", token, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if tokenRequests != 1 {
+		t.Errorf("%d token requests for concurrent callers, want 1", tokenRequests)
+	}
+	r.dropToken(PullScope("img"))
+	if _, err := r.token(PullScope("img")); err != nil || tokenRequests != 2 {
+		t.Errorf("token() after dropToken() = %v with %d requests, want 2", err, tokenRequests)
+	}
+}
@@ -0,0 +1,143 @@
+package remoteartifacts
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// maxBodyExcerpt limits how much of an error response body is kept
+const maxBodyExcerpt = 512
+
+// HttpError is returned when a request fails in transport or with a non 2xx status
+type HttpError struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Body       string
+	Attempts   int
+	Err        error
+}
+
+func (e *HttpError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s %s failed after %d attempt(s): %v", e.Method, e.URL, e.Attempts, e.Err)
+	}
+	return fmt.Sprintf("%s %s failed after %d attempt(s): status %d, body: %s", e.Method, e.URL, e.Attempts, e.StatusCode, e.Body)
+}
+
+// Unwrap returns the transport error, if any
+func (e *HttpError) Unwrap() error {
+	return e.Err
+}
+
+// managerStatusRe matches the status the jfrog-client-go services manager
+// starts its errors with, e.g. "Artifactory response: 409 Conflict"
+var managerStatusRe = regexp.MustCompile(`^(?:Artifactory response: )?([1-5][0-9]{2}) [A-Z]`)
+
+// StatusCode returns the http status of err, an HttpError or an error of the
+// services manager, possibly wrapped, or 0 when it has none
+func StatusCode(err error) int {
+	var httpErr *HttpError
+	if errors.As(err, &httpErr) {
+		return httpErr.StatusCode
+	}
+	for ; err != nil; err = errors.Unwrap(err) {
+		if m := managerStatusRe.FindStringSubmatch(err.Error()); m != nil {
+			code, _ := strconv.Atoi(m[1])
+			return code
+		}
+	}
+	return 0
+}
+
+// IsNotFound reports whether err failed with status 404
+func IsNotFound(err error) bool {
+	return StatusCode(err) == http.StatusNotFound
+}
+
+// IsConflict reports whether err failed with status 409
+func IsConflict(err error) bool {
+	return StatusCode(err) == http.StatusConflict
+}
+
+// IsForbidden reports whether err failed with status 401 or 403
+func IsForbidden(err error) bool {
+	code := StatusCode(err)
+	return code == http.StatusUnauthorized || code == http.StatusForbidden
+}
+
+// bodyExcerpt shortens a response body for error messages
+func bodyExcerpt(body []byte) string {
+	if len(body) > maxBodyExcerpt {
+		return string(body[:maxBodyExcerpt]) + "..."
+	}
+	return string(body)
+}
+
+// RetryPolicy controls the retries of failed requests
+type RetryPolicy struct {
+	// MaxRetries is defaulted when 0, a negative value disables the retries
+	MaxRetries     int `yaml:"maxretries"`
+	InitialDelayMs int `yaml:"initialdelayms"`
+	MaxDelayMs     int `yaml:"maxdelayms"`
+}
+
+// DefaultRetryPolicy is used unless SetRetryPolicy is called
+var DefaultRetryPolicy = RetryPolicy{MaxRetries: 5, InitialDelayMs: 500, MaxDelayMs: 30000}
+
+var retryPolicy = DefaultRetryPolicy
+
+// SetRetryPolicy sets the retry policy of the REST calls, unset values keep their default
+func SetRetryPolicy(rp RetryPolicy) {
+	if rp.MaxRetries == 0 {
+		rp.MaxRetries = DefaultRetryPolicy.MaxRetries
+	} else if rp.MaxRetries < 0 {
+		rp.MaxRetries = 0
+	}
+	if rp.InitialDelayMs == 0 {
+		rp.InitialDelayMs = DefaultRetryPolicy.InitialDelayMs
+	}
+	if rp.MaxDelayMs == 0 {
+		rp.MaxDelayMs = DefaultRetryPolicy.MaxDelayMs
+	}
+	retryPolicy = rp
+}
+
+// isIdempotent reports whether repeating a request of the method has the same
+// effect as sending it once, so that it can be retried
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// isRetryableStatus reports whether a response status is worth retrying
+func isRetryableStatus(status int) bool {
+	return status == http.StatusTooManyRequests || status >= 500
+}
+
+// retryDelay returns the exponential backoff with full jitter for the attempt,
+// honouring a Retry-After header in seconds when the server sends one
+func retryDelay(attempt int, resp *http.Response) time.Duration {
+	maxDelay := time.Duration(retryPolicy.MaxDelayMs) * time.Millisecond
+	if resp != nil {
+		if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && secs > 0 {
+			if d := time.Duration(secs) * time.Second; d < maxDelay {
+				return d
+			}
+			return maxDelay
+		}
+	}
+	backoff := time.Duration(retryPolicy.InitialDelayMs) * time.Millisecond << uint(attempt)
+	if backoff <= 0 || backoff > maxDelay {
+		backoff = maxDelay
+	}
+	return time.Duration(rand.Int63n(int64(backoff) + 1))
+}
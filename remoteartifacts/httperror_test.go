@@ -0,0 +1,148 @@
+package remoteartifacts
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	"github.com/jfrog/jfrog-client-go/artifactory/auth"
+	jflog "github.com/jfrog/jfrog-client-go/utils/log"
+)
+
+func TestStatusCode(t *testing.T) {
+	httpErr := &HttpError{Method: "GET", URL: "http://rt/api/x", StatusCode: 404, Attempts: 1}
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{nil, 0},
+		{httpErr, 404},
+		{fmt.Errorf("download: %w", httpErr), 404},
+		{errors.New("Artifactory response: 409 Conflict\n{}"), 409},
+		{fmt.Errorf("permission: %w", errors.New("Artifactory response: 403 Forbidden\n{}")), 403},
+		{errors.New("401 Unauthorized {\"errors\":[]}"), 401},
+		{errors.New("repo datasim-409 not found"), 0},
+		{errors.New("Artifactory response: user-409 exists"), 0},
+		{errors.New("dial tcp: connection refused"), 0},
+	}
+	for _, tt := range tests {
+		if got := StatusCode(tt.err); got != tt.want {
+			t.Errorf("StatusCode(%v) = %d, want %d", tt.err, got, tt.want)
+		}
+	}
+	if !IsConflict(errors.New("Artifactory response: 409 Conflict")) || IsConflict(errors.New("group-409 exists")) {
+		t.Errorf("IsConflict() misclassified a services manager error")
+	}
+	if !IsForbidden(fmt.Errorf("x: %w", &HttpError{StatusCode: 401})) || !IsNotFound(fmt.Errorf("x: %w", httpErr)) {
+		t.Errorf("wrapped HttpError not classified")
+	}
+}
+
+// truncatingServer serves body, cutting the first failures responses short
+func truncatingServer(t *testing.T, body string, failures int) (*httptest.Server, *int32) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&requests, 1)
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		if int(n) > failures {
+			w.Write([]byte(body))
+			return
+		}
+		w.Write([]byte(body[:len(body)/2]))
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.Close()
+	}))
+	return server, &requests
+}
+
+func TestReadUrlRetriesBodyErrors(t *testing.T) {
+	jflog.SetLogger(jflog.NewLogger(jflog.ERROR, ioutil.Discard))
+	defer SetRetryPolicy(retryPolicy)
+	SetRetryPolicy(RetryPolicy{MaxRetries: 2, InitialDelayMs: 1, MaxDelayMs: 1})
+	const body = "0123456789abcdef"
+
+	server, requests := truncatingServer(t, body, 2)
+	defer server.Close()
+	details := auth.NewArtifactoryDetails()
+	details.SetUrl(server.URL + "/artifactory/")
+	got, err := ReadUrl(&details, server.URL+"/artifactory/a/b", nil)
+	if err != nil || string(got) != body || *requests != 3 {
+		t.Errorf("ReadUrl() = %q, %v after %d requests, want %q after 3", got, err, *requests, body)
+	}
+
+	failing, requests := truncatingServer(t, body, 10)
+	defer failing.Close()
+	details.SetUrl(failing.URL + "/artifactory/")
+	_, err = FetchUrl(&details, failing.URL+"/artifactory/a/b")
+	var httpErr *HttpError
+	if !errors.As(err, &httpErr) || httpErr.Attempts != 3 || httpErr.StatusCode != http.StatusOK || *requests != 3 {
+		t.Errorf("FetchUrl() = %v after %d requests, want a failure after 3 attempts", err, *requests)
+	}
+}
+
+func TestSetRetryPolicy(t *testing.T) {
+	defer SetRetryPolicy(retryPolicy)
+	tests := []struct {
+		set  RetryPolicy
+		want RetryPolicy
+	}{
+		{RetryPolicy{}, DefaultRetryPolicy},
+		{RetryPolicy{InitialDelayMs: 10, MaxDelayMs: 100}, RetryPolicy{MaxRetries: DefaultRetryPolicy.MaxRetries, InitialDelayMs: 10, MaxDelayMs: 100}},
+		{RetryPolicy{MaxRetries: 2}, RetryPolicy{MaxRetries: 2, InitialDelayMs: DefaultRetryPolicy.InitialDelayMs, MaxDelayMs: DefaultRetryPolicy.MaxDelayMs}},
+		{RetryPolicy{MaxRetries: -1}, RetryPolicy{MaxRetries: 0, InitialDelayMs: DefaultRetryPolicy.InitialDelayMs, MaxDelayMs: DefaultRetryPolicy.MaxDelayMs}},
+	}
+	for _, tt := range tests {
+		SetRetryPolicy(tt.set)
+		if retryPolicy != tt.want {
+			t.Errorf("SetRetryPolicy(%+v) set %+v, want %+v", tt.set, retryPolicy, tt.want)
+		}
+	}
+}
+
+func TestRetriesIdempotentMethods(t *testing.T) {
+	jflog.SetLogger(jflog.NewLogger(jflog.ERROR, ioutil.Discard))
+	defer SetRetryPolicy(retryPolicy)
+	SetRetryPolicy(RetryPolicy{MaxRetries: 2, InitialDelayMs: 1, MaxDelayMs: 1})
+
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	details := auth.NewArtifactoryDetails()
+	details.SetUrl(server.URL + "/artifactory/")
+
+	tests := []struct {
+		method string
+		optIn  bool
+		want   int32
+	}{
+		{"GET", false, 3},
+		{"PUT", false, 3},
+		{"DELETE", false, 3},
+		{"POST", false, 1},
+		{"PATCH", false, 1},
+		{"POST", true, 3},
+	}
+	for _, tt := range tests {
+		atomic.StoreInt32(&requests, 0)
+		var err error
+		if tt.optIn {
+			_, err = doHttpReqRetry(&details, tt.method, server.URL+"/artifactory/api/x", nil, 0, nil, nil, true)
+		} else {
+			_, err = doHttpReq(&details, tt.method, "api/x", nil, nil)
+		}
+		if StatusCode(err) != http.StatusServiceUnavailable || atomic.LoadInt32(&requests) != tt.want {
+			t.Errorf("%s (opt-in %v) = %v after %d requests, want a 503 after %d", tt.method, tt.optIn, err, atomic.LoadInt32(&requests), tt.want)
+		}
+	}
+}
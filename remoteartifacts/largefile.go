@@ -0,0 +1,62 @@
+package remoteartifacts
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+
+	jfauth "github.com/jfrog/jfrog-client-go/auth"
+)
+
+// UploadStream deploys size bytes read from the readers newBody returns to
+// repoPath, given as <repo>/<path>, without holding them in memory. The body is
+// sent with the chunked transfer encoding when size is negative.
+func UploadStream(artDetails *jfauth.ServiceDetails, repoPath string, newBody func() io.Reader, size int64, headers map[string]string) error {
+	resp, err := doHttpReqBody(artDetails, "PUT", (*artDetails).GetUrl()+repoPath, newBody, size, headers)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// ChecksumDeploy deploys to repoPath the binary of the checksums already
+// stored in Artifactory, without sending it. It fails with a 404 status when
+// no such binary is stored.
+func ChecksumDeploy(artDetails *jfauth.ServiceDetails, repoPath string, sha1 string, sha256 string) error {
+	headers := map[string]string{
+		"X-Checksum-Deploy": "true",
+		"X-Checksum-Sha1":   sha1,
+		"X-Checksum-Sha256": sha256,
+	}
+	resp, err := doHttpReq(artDetails, "PUT", repoPath, nil, headers)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// DownloadRange downloads the bytes from to to of repoPath, the whole file
+// when to is negative, into w and returns their count
+func DownloadRange(artDetails *jfauth.ServiceDetails, repoPath string, from int64, to int64, w io.Writer) (int64, error) {
+	headers := map[string]string{}
+	if to >= 0 {
+		headers["Range"] = fmt.Sprintf("bytes=%d-%d", from, to)
+	}
+	rtURL := (*artDetails).GetUrl() + repoPath
+	var n int64
+	_, err := doHttpReqRead(artDetails, "GET", rtURL, nil, 0, headers, func(resp *http.Response) error {
+		if to >= 0 && resp.StatusCode != http.StatusPartialContent {
+			return &noRetryError{fmt.Errorf("range request not honoured")}
+		}
+		var err error
+		n, err = io.Copy(w, resp.Body)
+		// What was written to w cannot be taken back
+		if err != nil && n > 0 {
+			return &noRetryError{err}
+		}
+		return err
+	})
+	return n, err
+}
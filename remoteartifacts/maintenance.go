@@ -0,0 +1,35 @@
+package remoteartifacts
+
+import (
+	jfauth "github.com/jfrog/jfrog-client-go/auth"
+)
+
+// DeleteItem deletes the file or folder at repoPath, given as <repo>/<path>
+func DeleteItem(artDetails *jfauth.ServiceDetails, repoPath string) error {
+	resp, err := doHttpReq(artDetails, "DELETE", repoPath, nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// EmptyTrashCan permanently deletes the content of the trash can
+func EmptyTrashCan(artDetails *jfauth.ServiceDetails) error {
+	resp, err := doHttpReq(artDetails, "POST", "api/trash/empty", nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// RunGarbageCollection triggers the binaries garbage collection
+func RunGarbageCollection(artDetails *jfauth.ServiceDetails) error {
+	resp, err := doHttpReq(artDetails, "POST", "api/system/storage/gc", nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
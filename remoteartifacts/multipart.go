@@ -0,0 +1,180 @@
+package remoteartifacts
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jfrog/jfrog-client-go/artifactory/auth"
+	jfauth "github.com/jfrog/jfrog-client-go/auth"
+	jflog "github.com/jfrog/jfrog-client-go/utils/log"
+)
+
+// multipartApi is the multipart upload API of Artifactory, available when its
+// filestore is a cloud object storage
+const multipartApi = "api/v1/uploads/"
+
+// Statuses of the completion of a multipart upload
+const (
+	multipartFinished = "FINISHED"
+	multipartAborted  = "ABORTED"
+)
+
+// multipartPollInterval is the delay between two checks of the completion
+var multipartPollInterval = time.Second
+
+type multipartToken struct {
+	Token string `json:"token"`
+}
+
+type multipartPartURL struct {
+	URL string `json:"url"`
+}
+
+type multipartStatus struct {
+	Status string `json:"status"`
+	Error  string `json:"error"`
+}
+
+// multipartPart is a part of the content, numbered from 1
+type multipartPart struct {
+	num  int
+	data []byte
+}
+
+// multipartCall POSTs to uri of the multipart upload API, authenticated with
+// the upload token once there is one, and decodes the response into v when
+// not nil. The call is retried when retry is set, for the calls that can be
+// repeated.
+func multipartCall(artDetails *jfauth.ServiceDetails, token string, uri string, v interface{}, retry bool) error {
+	headers := map[string]string{}
+	if token != "" {
+		headers["Authorization"] = "Bearer " + token
+	}
+	_, err := doHttpReqRetry(artDetails, "POST", (*artDetails).GetUrl()+multipartApi+uri, nil, 0, headers, func(resp *http.Response) error {
+		if v == nil {
+			return nil
+		}
+		return json.NewDecoder(resp.Body).Decode(v)
+	}, retry)
+	return err
+}
+
+// MultipartUpload deploys the content read from r to repoPath, given as
+// <repo>/<path>, through the multipart upload API of Artifactory: the content
+// is split in parts of partSizeMB MiB, each uploaded by one of workers to the
+// storage URL Artifactory presigns for it, then Artifactory assembles them and
+// verifies their sha1. Only the parts being uploaded are held in memory.
+func MultipartUpload(artDetails *jfauth.ServiceDetails, repoPath string, r io.Reader, partSizeMB int, workers int, sha1 string) error {
+	i := strings.Index(repoPath, "/")
+	if i < 0 {
+		return fmt.Errorf("no path in repo path '%s'", repoPath)
+	}
+	query := url.Values{}
+	query.Set("repoKey", repoPath[:i])
+	query.Set("repoPath", repoPath[i+1:])
+	query.Set("partSizeMB", fmt.Sprintf("%d", partSizeMB))
+	token := &multipartToken{}
+	if err := multipartCall(artDetails, "", "create?"+query.Encode(), token, false); err != nil {
+		return err
+	}
+
+	if err := multipartUploadParts(artDetails, token.Token, r, int64(partSizeMB)<<20, workers); err != nil {
+		if abortErr := multipartCall(artDetails, token.Token, "abort", nil, false); abortErr != nil {
+			jflog.Warn(fmt.Sprintf("Failed to abort the multipart upload of %s : %v", repoPath, abortErr))
+		}
+		return err
+	}
+
+	if err := multipartCall(artDetails, token.Token, "complete?sha1="+url.QueryEscape(sha1), nil, false); err != nil {
+		return err
+	}
+	for {
+		status := &multipartStatus{}
+		if err := multipartCall(artDetails, token.Token, "status", status, true); err != nil {
+			return err
+		}
+		switch status.Status {
+		case multipartFinished:
+			return nil
+		case multipartAborted:
+			return fmt.Errorf("multipart upload of %s aborted: %s", repoPath, status.Error)
+		}
+		time.Sleep(multipartPollInterval)
+	}
+}
+
+// multipartUploadParts reads the parts from r and uploads them concurrently,
+// stopping at the first failure
+func multipartUploadParts(artDetails *jfauth.ServiceDetails, token string, r io.Reader, partSize int64, workers int) error {
+	// The presigned URLs carry their own authorization
+	anonymous := auth.NewArtifactoryDetails()
+	anonymous.SetUrl((*artDetails).GetUrl())
+
+	var failed error
+	var mu sync.Mutex
+	failure := func() error {
+		mu.Lock()
+		defer mu.Unlock()
+		return failed
+	}
+	parts := make(chan multipartPart)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for p := range parts {
+				err := multipartUploadPart(artDetails, &anonymous, token, p)
+				if err != nil {
+					mu.Lock()
+					if failed == nil {
+						failed = err
+					}
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+	var readErr error
+	for num := 1; failure() == nil; num++ {
+		data := make([]byte, partSize)
+		n, err := io.ReadFull(r, data)
+		if n > 0 {
+			parts <- multipartPart{num: num, data: data[:n]}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			readErr = err
+			break
+		}
+	}
+	close(parts)
+	wg.Wait()
+	if readErr != nil {
+		return readErr
+	}
+	return failed
+}
+
+// multipartUploadPart uploads one part to the URL Artifactory presigns for it
+func multipartUploadPart(artDetails *jfauth.ServiceDetails, anonymous *jfauth.ServiceDetails, token string, p multipartPart) error {
+	partURL := &multipartPartURL{}
+	if err := multipartCall(artDetails, token, fmt.Sprintf("urlPart?partNumber=%d", p.num), partURL, true); err != nil {
+		return err
+	}
+	resp, err := doHttpReqURL(anonymous, "PUT", partURL.URL, p.data, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
@@ -0,0 +1,49 @@
+package remoteartifacts
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+
+	jfauth "github.com/jfrog/jfrog-client-go/auth"
+)
+
+// SetItemProperties sets the properties of the item at repoPath, given as
+// <repo>/<path>, replacing the values of the keys already set
+func SetItemProperties(artDetails *jfauth.ServiceDetails, repoPath string, props map[string]string) error {
+	keys := make([]string, 0, len(props))
+	for k := range props {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := []string{}
+	for _, k := range keys {
+		pairs = append(pairs, url.QueryEscape(k)+"="+url.QueryEscape(props[k]))
+	}
+	resp, err := doHttpReq(artDetails, "PUT", "api/storage/"+repoPath+"?recursive=0&properties="+strings.Join(pairs, ";"), nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// DeleteItemProperties deletes the properties of keys from the item at repoPath
+func DeleteItemProperties(artDetails *jfauth.ServiceDetails, repoPath string, keys []string) error {
+	escaped := []string{}
+	for _, k := range keys {
+		escaped = append(escaped, url.QueryEscape(k))
+	}
+	resp, err := doHttpReq(artDetails, "DELETE", "api/storage/"+repoPath+"?recursive=0&properties="+strings.Join(escaped, ","), nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// SearchUri returns the URI of the search API of kind, e.g. prop, gavc,
+// checksum or artifact, with the query parameters
+func SearchUri(kind string, params url.Values) string {
+	return "api/search/" + kind + "?" + params.Encode()
+}
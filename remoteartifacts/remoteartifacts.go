@@ -1,6 +1,7 @@
 package remoteartifacts
 
 import (
+	"bytes"
 	"container/list"
 	"encoding/json"
 	"fmt"
@@ -11,111 +12,255 @@ import (
 	"path/filepath"
 	"regexp"
 	"sort"
-	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	jfauth "github.com/jfrog/jfrog-client-go/auth"
 	jflog "github.com/jfrog/jfrog-client-go/utils/log"
+	"jfrog.com/datasim/httpclient"
+	"jfrog.com/datasim/stats"
 )
 
-// getHttpResp issues a GET request and returns response body
-func getHttpResp(artDetails *jfauth.ServiceDetails, uri string) ([]byte, error) {
-	rtURL := (*artDetails).GetUrl() + uri
-	jflog.Debug("Getting '" + rtURL + "' details ...")
-	//fmt.Printf("Fetching : %s\n", rtURL)
-	req, err := http.NewRequest("GET", rtURL, nil)
-	if err != nil {
-		jflog.Error("http.NewRequest failed")
+// setAuth sets the request authentication the same way the jfrog-client-go
+// http client does, so raw calls and the services manager behave alike
+func setAuth(req *http.Request, artDetails *jfauth.ServiceDetails) {
+	user := (*artDetails).GetUser()
+	if apiKey := (*artDetails).GetApiKey(); apiKey != "" {
+		if user != "" {
+			req.SetBasicAuth(user, apiKey)
+		} else {
+			req.Header.Set("X-JFrog-Art-Api", apiKey)
+		}
+		return
+	}
+	if accessToken := (*artDetails).GetAccessToken(); accessToken != "" {
+		if user != "" {
+			req.SetBasicAuth(user, accessToken)
+		} else {
+			req.Header.Set("Authorization", "Bearer "+accessToken)
+		}
+		return
+	}
+	if password := (*artDetails).GetPassword(); password != "" {
+		req.SetBasicAuth(user, password)
 	}
-	req.SetBasicAuth((*artDetails).GetUser(), (*artDetails).GetApiKey())
+	// Anonymous access otherwise
+}
 
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		jflog.Error("http.DefaultClient.Do failed")
+// doHttpReq issues a request, retrying transport errors and 429/5xx responses with
+// exponential backoff when its method is idempotent, and returns the response
+// once it has a 2xx status. The caller closes the response body.
+func doHttpReq(artDetails *jfauth.ServiceDetails, method string, uri string, body []byte, headers map[string]string) (*http.Response, error) {
+	return doHttpReqURL(artDetails, method, (*artDetails).GetUrl()+uri, body, headers)
+}
+
+// doHttpReqURL is doHttpReq for a full URL, e.g. of another JFrog service of the
+// platform, authenticated with the Artifactory credentials
+func doHttpReqURL(artDetails *jfauth.ServiceDetails, method string, rtURL string, body []byte, headers map[string]string) (*http.Response, error) {
+	if body == nil {
+		return doHttpReqBody(artDetails, method, rtURL, nil, 0, headers)
 	}
-	defer resp.Body.Close()
+	return doHttpReqBody(artDetails, method, rtURL, func() io.Reader { return bytes.NewReader(body) }, int64(len(body)), headers)
+}
 
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		jflog.Error("ioutil.ReadAll call failed")
+// doHttpReqBody is doHttpReqURL for a body streamed from the readers newBody
+// returns, a new one for each attempt, of contentLength bytes, or sent with
+// the chunked transfer encoding when contentLength is negative
+func doHttpReqBody(artDetails *jfauth.ServiceDetails, method string, rtURL string, newBody func() io.Reader, contentLength int64, headers map[string]string) (*http.Response, error) {
+	return doHttpReqRead(artDetails, method, rtURL, newBody, contentLength, headers, nil)
+}
+
+// noRetryError is returned by a response reader whose failure must not be
+// retried, e.g. once it wrote to a destination it cannot rewind
+type noRetryError struct {
+	err error
+}
+
+func (e *noRetryError) Error() string {
+	return e.err.Error()
+}
+
+// doHttpReqRead is doHttpReqBody reading the 2xx response with read, when
+// set, within the retries: a failed read is retried like a transport error,
+// unless read returns a noRetryError. The response body is then closed.
+func doHttpReqRead(artDetails *jfauth.ServiceDetails, method string, rtURL string, newBody func() io.Reader, contentLength int64, headers map[string]string, read func(resp *http.Response) error) (*http.Response, error) {
+	return doHttpReqRetry(artDetails, method, rtURL, newBody, contentLength, headers, read, isIdempotent(method))
+}
+
+// doHttpReqRetry is doHttpReqRead retrying the failures only when retry is
+// set, which callers of a non idempotent method set when repeating the request
+// is harmless
+func doHttpReqRetry(artDetails *jfauth.ServiceDetails, method string, rtURL string, newBody func() io.Reader, contentLength int64, headers map[string]string, read func(resp *http.Response) error, retry bool) (*http.Response, error) {
+	client := httpclient.Get((*artDetails).GetUrl())
+	httpErr := &HttpError{Method: method, URL: rtURL}
+	for attempt := 0; ; attempt++ {
+		httpErr.Attempts = attempt + 1
+		var reqBody io.Reader
+		if newBody != nil {
+			reqBody = newBody()
+		}
+		req, err := http.NewRequest(method, rtURL, reqBody)
+		if err != nil {
+			httpErr.Err = err
+			return nil, httpErr
+		}
+		if newBody != nil {
+			req.ContentLength = contentLength
+			if contentLength < 0 {
+				req.TransferEncoding = []string{"chunked"}
+			}
+		}
+		setAuth(req, artDetails)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+
+		resp, err := client.Do(req)
+		retryable := true
+		httpErr.Err = err
+		if err == nil && resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			if read == nil {
+				return resp, nil
+			}
+			err = read(resp)
+			resp.Body.Close()
+			if err == nil {
+				return resp, nil
+			}
+			httpErr.StatusCode = resp.StatusCode
+			httpErr.Err = err
+			if noRetry, ok := err.(*noRetryError); ok {
+				httpErr.Err = noRetry.err
+				retryable = false
+			}
+		} else if err == nil {
+			respBody, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxBodyExcerpt+1))
+			resp.Body.Close()
+			httpErr.StatusCode = resp.StatusCode
+			httpErr.Body = bodyExcerpt(respBody)
+			retryable = isRetryableStatus(resp.StatusCode)
+		}
+		if !retry || !retryable || attempt >= retryPolicy.MaxRetries {
+			return nil, httpErr
+		}
+		delay := retryDelay(attempt, resp)
+		jflog.Warn(fmt.Sprintf("%v, retrying in %v", httpErr, delay))
+		time.Sleep(delay)
 	}
-	//fmt.Printf("Fetching completed : %s\n", rtURL)
-	return body, err
 }
 
-type FileStorageInfo struct {
-	StorageType      string `json:"storageType"`
-	StorageDirectory string `json:"storageDirectory"`
-	TotalSpace       string `json:"totalSpace"`
-	UsedSpace        string `json:"usedSpace"`
-	FreeSpace        string `json:"freeSpace"`
+// getHttpResp issues a GET request and returns response body
+func getHttpResp(artDetails *jfauth.ServiceDetails, uri string) ([]byte, error) {
+	jflog.Debug("Getting '" + (*artDetails).GetUrl() + uri + "' details ...")
+	return ReadUrl(artDetails, (*artDetails).GetUrl()+uri, nil)
 }
-type BinariesInfo struct {
-	BinariesCount string `json:"binariesCount"`
-	BinariesSize  string `json:"binariesSize"`
-	ArtifactsSize string `json:"artifactsSize"`
-	Optimization  string `json:"optimization"`
+
+// FetchUri issues a GET request, discards the response body and returns its size
+func FetchUri(artDetails *jfauth.ServiceDetails, uri string) (int64, error) {
+	return FetchUrl(artDetails, (*artDetails).GetUrl()+uri)
 }
-type RepoStorageInfo struct {
-	Key          string `json:"repoKey"`
-	RepoType     string `json:"repoType"`
-	FoldersCount int    `json:"foldersCount"`
-	FilesCount   int    `json:"filesCount"`
-	UsedSpace    string `json:"usedSpace"`
-	PackageType  string `json:"packageType"`
+
+// FetchUrl is FetchUri for a full URL, e.g. a download link of package metadata
+func FetchUrl(artDetails *jfauth.ServiceDetails, rtURL string) (int64, error) {
+	var n int64
+	_, err := doHttpReqRead(artDetails, "GET", rtURL, nil, 0, nil, func(resp *http.Response) error {
+		var err error
+		n, err = io.Copy(ioutil.Discard, resp.Body)
+		return err
+	})
+	return n, err
 }
-type RepoStorageUsedSpaceInfo struct {
-	Key          string  `json:"repoKey"`
-	RepoType     string  `json:"repoType"`
-	FoldersCount int     `json:"foldersCount"`
-	FilesCount   int     `json:"filesCount"`
-	UsedSpaceGB  float64 `json:"usedSpaceGB"`
-	PackageType  string  `json:"packageType"`
+
+// ReadUrl issues a GET request to the full URL and returns the response body
+func ReadUrl(artDetails *jfauth.ServiceDetails, rtURL string, headers map[string]string) ([]byte, error) {
+	var body []byte
+	_, err := doHttpReqRead(artDetails, "GET", rtURL, nil, 0, headers, func(resp *http.Response) error {
+		var err error
+		body, err = ioutil.ReadAll(resp.Body)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return body, nil
 }
-type StorageInfo struct {
-	FileStorage     FileStorageInfo   `json:"fileStoreSummary"`
-	BinariesStorage BinariesInfo      `json:"binariesSummary"`
-	RepoStorage     []RepoStorageInfo `json:"repositoriesSummaryList"`
+
+// RepoSelection selects remote repos by the storage of their caches
+type RepoSelection struct {
+	Enabled bool `yaml:"enabled"`
+	// TopCaches keeps the remote repos of the largest caches, all when 0
+	TopCaches int `yaml:"topcaches"`
+	// MinUsedSpace is the least used space of a cache, like "1 GB"
+	MinUsedSpace string   `yaml:"minusedspace"`
+	PackageTypes []string `yaml:"packagetypes"`
+	NameRegex    string   `yaml:"nameregex"`
+	Exclude      []string `yaml:"exclude"`
 }
 
-// GetCachedRemoteRepos fetches storage info of repositories
-func GetCachedRemoteRepos(artDetails *jfauth.ServiceDetails) (*[]string, error) {
+// GetCachedRemoteRepos returns the remote repos whose caches match the
+// selection, the largest caches first
+func GetCachedRemoteRepos(artDetails *jfauth.ServiceDetails, sel RepoSelection) (*[]string, error) {
 	remoteRepos := []string{}
-	storageInfoGB := []RepoStorageUsedSpaceInfo{}
-	resp, err := getHttpResp(artDetails, "api/storageinfo")
-	if err != nil {
-		jflog.Error("Failed to get http resp for api/storageinfo")
+	var minUsedSpace int64
+	if sel.MinUsedSpace != "" {
+		var err error
+		if minUsedSpace, err = ParseSize(sel.MinUsedSpace); err != nil {
+			return &remoteRepos, err
+		}
 	}
-	StorageInfo := &StorageInfo{}
-	if err := json.Unmarshal(resp, &StorageInfo); err != nil {
+	var nameRe *regexp.Regexp
+	if sel.NameRegex != "" {
+		var err error
+		if nameRe, err = regexp.Compile(sel.NameRegex); err != nil {
+			return &remoteRepos, err
+		}
+	}
+	summary, err := GetStorageSummary(artDetails)
+	if err != nil {
+		jflog.Error(fmt.Sprintf("Failed to get the storage summary : %v", err))
 		return &remoteRepos, err
 	}
 
-	// Gather repoType CACHE that has storage space > 1 GB
-	for _, r := range *&StorageInfo.RepoStorage {
-		if r.RepoType == "CACHE" && strings.Contains(r.UsedSpace, "GB") {
-			re := regexp.MustCompile(`[-]?\d[\d,]*[\.]?[\d{2}]*`)
-			usedSpaceGB, err := strconv.ParseFloat(re.FindString(r.UsedSpace), 64)
-			if err != nil {
-				jflog.Error("Failed used space to float for repo %s", r.Key)
-			}
-			storageInfoGB = append(storageInfoGB, RepoStorageUsedSpaceInfo{r.Key, r.RepoType, r.FoldersCount, r.FilesCount, usedSpaceGB, r.PackageType})
-
+	caches := []RepoStorage{}
+	for _, r := range summary.Repos {
+		if r.RepoType != "CACHE" || r.UsedSpace < minUsedSpace {
+			continue
+		}
+		key := strings.TrimSuffix(r.Key, "-cache")
+		if len(sel.PackageTypes) > 0 && !containsFold(sel.PackageTypes, r.PackageType) {
+			continue
+		}
+		if nameRe != nil && !nameRe.MatchString(key) {
+			continue
+		}
+		if containsFold(sel.Exclude, key) {
+			continue
 		}
+		r.Key = key
+		caches = append(caches, r)
+	}
+	sort.SliceStable(caches, func(i, j int) bool { return caches[i].UsedSpace > caches[j].UsedSpace })
+	if sel.TopCaches > 0 && len(caches) > sel.TopCaches {
+		caches = caches[:sel.TopCaches]
+	}
+	for _, r := range caches {
+		jflog.Info(fmt.Sprintf("Selected remote repo %s of %s with a cache of %d files and %d bytes", r.Key, r.PackageType, r.FilesCount, r.UsedSpace))
+		remoteRepos = append(remoteRepos, r.Key)
 	}
-
-	sort.Slice(storageInfoGB, func(i, j int) bool { return storageInfoGB[i].UsedSpaceGB > storageInfoGB[j].UsedSpaceGB })
-
-	//for _, r := range storageInfoGB {
-	//	remoteRepos = append(remoteRepos, strings.ReplaceAll(r.Key, "-cache", ""))
-	//}
-	remoteRepos = append([]string{"atlassian"}, remoteRepos...)
-	remoteRepos = append([]string{"docker-bintray-io"}, remoteRepos...)
 	return &remoteRepos, nil
 }
 
+// containsFold tells whether values contains value, ignoring the case
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
 // RepoInfo to unmarshall from json response
 type RepoInfo struct {
 	Key           string `json:"key"`
@@ -133,7 +278,8 @@ func GetRepoInfo(artDetails *jfauth.ServiceDetails, repoNames *[]string) (*[]Rep
 		repoPath := "api/repositories/" + r
 		resp, err := getHttpResp(artDetails, repoPath)
 		if err != nil {
-			jflog.Error("Failed to get http resp for %s", repoPath)
+			jflog.Error(fmt.Sprintf("Failed to get http resp for %s : %v", repoPath, err))
+			return &repoList, err
 		}
 		repoInfo := &RepoInfo{}
 		if err := json.Unmarshal(resp, &repoInfo); err != nil {
@@ -174,13 +320,14 @@ func getRemoteArtifactWorker(artDetails *jfauth.ServiceDetails, chFolder chan st
 		resp, err := getHttpResp(artDetails, rmtURL)
 		if err != nil {
 			fmt.Printf("GET HTTP failed for url : %s\n", rmtURL)
-			jflog.Error(fmt.Sprintf("GET HTTP failed for url : %s", rmtURL))
+			jflog.Error(fmt.Sprintf("GET HTTP failed for url : %s : %v", rmtURL, err))
+			continue
 		}
 		//fmt.Printf("getHttpResp() done : %s\n", f)
 		ArtiInfo := &ArtifactInfo{}
 		if err := json.Unmarshal(resp, &ArtiInfo); err != nil {
-			fmt.Printf("Unable to fetch file and folders for url : %s\n", rmtURL)
-			jflog.Error(fmt.Sprintf("Unable to fetch file and folders for url : %s", rmtURL))
+			fmt.Printf("Unable to parse file and folders for url : %s\n", rmtURL)
+			jflog.Error(fmt.Sprintf("Unable to parse file and folders for url : %s : %v", rmtURL, err))
 			continue
 		}
 		//fmt.Printf("json.Unmarshal done, count of items in folder : %d\n", len(ArtiInfo.Children))
@@ -252,22 +399,15 @@ func GetRemoteArtifactFiles(artDetails *jfauth.ServiceDetails, repos *[]string)
 }
 
 // downloadRemoteArtifactWorker that receives artifact path and downloads it in tgtDir location
-func downloadRemoteArtifactWorker(artDetails *jfauth.ServiceDetails, chFiles <-chan string, tgtDir string) {
-	rtBase := (*artDetails).GetUrl()
+func downloadRemoteArtifactWorker(artDetails *jfauth.ServiceDetails, chFiles <-chan string, tgtDir string, rec *stats.Recorder) {
 	dlcount := 0
 	for f := range chFiles {
-		rtURL := rtBase + f
-		jflog.Debug("Getting '" + rtURL + "' details ...")
-		// fmt.Printf("Fetching : %s\n", rtURL)
-		req, err := http.NewRequest("GET", rtURL, nil)
-		if err != nil {
-			jflog.Error("http.NewRequest failed")
-		}
-		req.SetBasicAuth((*artDetails).GetUser(), (*artDetails).GetApiKey())
-
-		resp, err := http.DefaultClient.Do(req)
+		jflog.Debug("Getting '" + (*artDetails).GetUrl() + f + "' details ...")
+		start := time.Now()
+		resp, err := doHttpReq(artDetails, "GET", f, nil, nil)
 		if err != nil {
-			jflog.Error("http.DefaultClient.Do failed")
+			rec.Record("download", start, err)
+			jflog.Error(fmt.Sprintf("Failed to download : %v", err))
 			continue
 		}
 
@@ -280,13 +420,15 @@ func downloadRemoteArtifactWorker(artDetails *jfauth.ServiceDetails, chFiles <-c
 		// Create the file
 		out, err := os.Create(fpath)
 		if err != nil {
+			rec.Record("download", start, err)
 			jflog.Error("Failed to create file : %s", fpath)
 			resp.Body.Close()
 			continue
 		}
 
 		// Write the body to file
-		_, err = io.Copy(out, resp.Body)
+		n, err := io.Copy(out, resp.Body)
+		rec.RecordBytes("download", start, n, err)
 		if err != nil {
 			jflog.Error("Failed to copy download to file : %s", fpath)
 		}
@@ -299,8 +441,8 @@ func downloadRemoteArtifactWorker(artDetails *jfauth.ServiceDetails, chFiles <-c
 	jflog.Info(fmt.Sprintf("downloadRemoteArtifactWorker() complete, downloaded %d files", dlcount))
 }
 
-// DownloadArtifacts and write to a target directory
-func DownloadRemoteArtifacts(artDetails *jfauth.ServiceDetails, rtfacts *list.List, tgtDir string) error {
+// DownloadArtifacts and write to a target directory, recording each download with rec
+func DownloadRemoteArtifacts(artDetails *jfauth.ServiceDetails, rtfacts *list.List, tgtDir string, rec *stats.Recorder) error {
 	files := make(chan string, 1024)
 
 	var workerg sync.WaitGroup
@@ -308,7 +450,7 @@ func DownloadRemoteArtifacts(artDetails *jfauth.ServiceDetails, rtfacts *list.Li
 	workerg.Add(numWorkers)
 	for i := 0; i < numWorkers; i++ {
 		go func() {
-			downloadRemoteArtifactWorker(artDetails, files, tgtDir)
+			downloadRemoteArtifactWorker(artDetails, files, tgtDir, rec)
 			workerg.Done()
 		}()
 	}
@@ -342,10 +484,10 @@ func PollArtiMetricsRestEndpoint(artDetails *jfauth.ServiceDetails, intervalSecs
 	jflog.Info(fmt.Sprintf("Polling api/v1/metrics REST end point"))
 	url := "api/v1/metrics"
 	for {
-		resp, err := getHttpResp(artDetails, url)
+		_, err := getHttpResp(artDetails, url)
 		if err != nil {
-			fmt.Printf("GET HTTP failed for url : %s, resp = %s\n", url, resp)
-			jflog.Error(fmt.Sprintf("GET HTTP failed for url : %s, resp = %s", url, resp))
+			fmt.Printf("GET HTTP failed for url : %s, err = %v\n", url, err)
+			jflog.Error(fmt.Sprintf("GET HTTP failed for url : %s, err = %v", url, err))
 		}
 		time.Sleep(time.Duration(intervalSecs) * time.Second)
 	}
@@ -0,0 +1,114 @@
+package remoteartifacts
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/jfrog/jfrog-client-go/artifactory/auth"
+	jflog "github.com/jfrog/jfrog-client-go/utils/log"
+)
+
+// cachedReposStorageInfo has caches of several package types and sizes, with
+// a local repo and a remote repo without cache to skip
+const cachedReposStorageInfo = `{
+	"binariesSummary": {"binariesCount": "1,000", "binariesSize": "20 GB", "artifactsSize": "25 GB", "optimization": "80%"},
+	"repositoriesSummaryList": [
+		{"repoKey": "libs", "repoType": "LOCAL", "filesCount": "100", "usedSpace": "50 GB", "packageType": "Maven"},
+		{"repoKey": "jcenter-cache", "repoType": "CACHE", "filesCount": "500", "usedSpace": "10 GB", "packageType": "Maven"},
+		{"repoKey": "npmjs-cache", "repoType": "CACHE", "filesCount": "300", "usedSpace": "4 GB", "packageType": "Npm"},
+		{"repoKey": "pypi-cache", "repoType": "CACHE", "filesCount": "200", "usedSpace": "2 GB", "packageType": "Pypi"},
+		{"repoKey": "maven-snapshots-cache", "repoType": "CACHE", "filesCount": "50", "usedSpace": "500 MB", "packageType": "Maven"},
+		{"repoKey": "docker-hub-cache", "repoType": "CACHE", "filesCount": "40", "usedSpace": "7 GB", "packageType": "Docker"},
+		{"repoKey": "empty-remote", "repoType": "REMOTE", "filesCount": "0", "usedSpace": "0 bytes", "packageType": "Generic"},
+		{"repoKey": "TOTAL", "repoType": "NA", "filesCount": "1,190", "usedSpace": "73.5 GB"}
+	]
+}`
+
+func TestGetCachedRemoteRepos(t *testing.T) {
+	jflog.SetLogger(jflog.NewLogger(jflog.ERROR, ioutil.Discard))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/artifactory/api/storageinfo" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(cachedReposStorageInfo))
+	}))
+	defer server.Close()
+	details := auth.NewArtifactoryDetails()
+	details.SetUrl(server.URL + "/artifactory/")
+
+	tests := []struct {
+		name    string
+		sel     RepoSelection
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "all caches, largest first",
+			want: []string{"jcenter", "docker-hub", "npmjs", "pypi", "maven-snapshots"},
+		},
+		{
+			name: "top caches",
+			sel:  RepoSelection{TopCaches: 2},
+			want: []string{"jcenter", "docker-hub"},
+		},
+		{
+			name: "top caches above the count",
+			sel:  RepoSelection{TopCaches: 10},
+			want: []string{"jcenter", "docker-hub", "npmjs", "pypi", "maven-snapshots"},
+		},
+		{
+			name: "package types ignoring the case",
+			sel:  RepoSelection{PackageTypes: []string{"maven", "NPM"}},
+			want: []string{"jcenter", "npmjs", "maven-snapshots"},
+		},
+		{
+			name: "name regex on the remote repo key",
+			sel:  RepoSelection{NameRegex: "^(jcenter|pypi)$"},
+			want: []string{"jcenter", "pypi"},
+		},
+		{
+			name: "exclude",
+			sel:  RepoSelection{Exclude: []string{"docker-hub", "JCENTER"}},
+			want: []string{"npmjs", "pypi", "maven-snapshots"},
+		},
+		{
+			name: "minimum used space",
+			sel:  RepoSelection{MinUsedSpace: "4 GB"},
+			want: []string{"jcenter", "docker-hub", "npmjs"},
+		},
+		{
+			name: "rules combined before the top caches",
+			sel:  RepoSelection{TopCaches: 1, PackageTypes: []string{"Maven"}, Exclude: []string{"jcenter"}, MinUsedSpace: "100 MB"},
+			want: []string{"maven-snapshots"},
+		},
+		{
+			name: "nothing selected",
+			sel:  RepoSelection{PackageTypes: []string{"Helm"}},
+			want: []string{},
+		},
+		{
+			name:    "invalid minimum used space",
+			sel:     RepoSelection{MinUsedSpace: "a lot"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid name regex",
+			sel:     RepoSelection{NameRegex: "("},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		got, err := GetCachedRemoteRepos(&details, tt.sel)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: GetCachedRemoteRepos() error = %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(*got, tt.want) {
+			t.Errorf("%s: GetCachedRemoteRepos() = %v, want %v", tt.name, *got, tt.want)
+		}
+	}
+}
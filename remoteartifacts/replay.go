@@ -0,0 +1,36 @@
+package remoteartifacts
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	jfauth "github.com/jfrog/jfrog-client-go/auth"
+	"jfrog.com/datasim/httpclient"
+)
+
+// SendRequest issues a single request, without retries nor status check, and
+// returns the response status and size, as needed to replay recorded traffic
+func SendRequest(artDetails *jfauth.ServiceDetails, method string, uri string, body []byte) (int, int64, error) {
+	rtURL := (*artDetails).GetUrl() + uri
+	var reqBody io.Reader
+	if body != nil {
+		reqBody = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, rtURL, reqBody)
+	if err != nil {
+		return 0, 0, &HttpError{Method: method, URL: rtURL, Attempts: 1, Err: err}
+	}
+	setAuth(req, artDetails)
+	resp, err := httpclient.Get((*artDetails).GetUrl()).Do(req)
+	if err != nil {
+		return 0, 0, &HttpError{Method: method, URL: rtURL, Attempts: 1, Err: err}
+	}
+	defer resp.Body.Close()
+	n, err := io.Copy(ioutil.Discard, resp.Body)
+	if err != nil {
+		return resp.StatusCode, n, &HttpError{Method: method, URL: rtURL, StatusCode: resp.StatusCode, Attempts: 1, Err: err}
+	}
+	return resp.StatusCode, n, nil
+}
@@ -0,0 +1,87 @@
+package remoteartifacts
+
+import (
+	"encoding/json"
+
+	jfauth "github.com/jfrog/jfrog-client-go/auth"
+)
+
+// FederatedMember is a member of a federated repository
+type FederatedMember struct {
+	Url     string `json:"url"`
+	Enabled bool   `json:"enabled"`
+}
+
+// RepoConfig is the repository configuration sent to api/repositories, covering
+// the repo classes the jfrog-client-go services do not, like federated repos
+type RepoConfig struct {
+	Key          string            `json:"key"`
+	Rclass       string            `json:"rclass"`
+	PackageType  string            `json:"packageType"`
+	Description  string            `json:"description,omitempty"`
+	Notes        string            `json:"notes,omitempty"`
+	Url          string            `json:"url,omitempty"`
+	Username     string            `json:"username,omitempty"`
+	Password     string            `json:"password,omitempty"`
+	Repositories []string          `json:"repositories,omitempty"`
+	Members      []FederatedMember `json:"members,omitempty"`
+	XrayIndex    bool              `json:"xrayIndex"`
+}
+
+// RepoListEntry is a repository of the api/repositories list
+type RepoListEntry struct {
+	Key string `json:"key"`
+	// Type is the repo class, in upper case, like LOCAL or REMOTE
+	Type        string `json:"type"`
+	PackageType string `json:"packageType"`
+	Url         string `json:"url"`
+}
+
+// ListRepositories returns the repositories with their class, which the
+// jfrog-client-go services do not return
+func ListRepositories(artDetails *jfauth.ServiceDetails) ([]RepoListEntry, error) {
+	body, err := getHttpResp(artDetails, "api/repositories")
+	if err != nil {
+		return nil, err
+	}
+	repos := []RepoListEntry{}
+	if err := json.Unmarshal(body, &repos); err != nil {
+		return nil, err
+	}
+	return repos, nil
+}
+
+// sendRepoConfig sends the repo configuration with method, PUT to create and POST to update
+func sendRepoConfig(artDetails *jfauth.ServiceDetails, method string, cfg RepoConfig) error {
+	body, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	resp, err := doHttpReq(artDetails, method, "api/repositories/"+cfg.Key, body, map[string]string{"Content-Type": "application/json"})
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// CreateRepository creates a repository of any class from its configuration
+func CreateRepository(artDetails *jfauth.ServiceDetails, cfg RepoConfig) error {
+	return sendRepoConfig(artDetails, "PUT", cfg)
+}
+
+// UpdateRepository updates the configuration of a repository of any class
+func UpdateRepository(artDetails *jfauth.ServiceDetails, cfg RepoConfig) error {
+	return sendRepoConfig(artDetails, "POST", cfg)
+}
+
+// ExecuteReplication triggers the replications configured on the repo, push
+// replications of a local repo or the pull replication of a remote repo
+func ExecuteReplication(artDetails *jfauth.ServiceDetails, repoKey string) error {
+	resp, err := doHttpReq(artDetails, "POST", "api/replication/execute/"+repoKey, nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
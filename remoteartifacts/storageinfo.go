@@ -0,0 +1,477 @@
+package remoteartifacts
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	jfauth "github.com/jfrog/jfrog-client-go/auth"
+)
+
+// StorageNumber is a number of api/storageinfo, sent as a JSON number or string
+// depending on the Artifactory version, empty when absent
+type StorageNumber string
+
+// UnmarshalJSON accepts a number, a string or null
+func (n *StorageNumber) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*n = StorageNumber(s)
+		return nil
+	}
+	var num json.Number
+	if err := json.Unmarshal(data, &num); err != nil {
+		return err
+	}
+	*n = StorageNumber(num)
+	return nil
+}
+
+// FileStorageInfo is the filestore summary of api/storageinfo. Newer versions
+// of Artifactory add the sizes in bytes to the human readable ones.
+type FileStorageInfo struct {
+	StorageType       string        `json:"storageType"`
+	StorageDirectory  string        `json:"storageDirectory"`
+	TotalSpace        string        `json:"totalSpace"`
+	UsedSpace         string        `json:"usedSpace"`
+	FreeSpace         string        `json:"freeSpace"`
+	TotalSpaceInBytes StorageNumber `json:"totalSpaceInBytes"`
+	UsedSpaceInBytes  StorageNumber `json:"usedSpaceInBytes"`
+	FreeSpaceInBytes  StorageNumber `json:"freeSpaceInBytes"`
+}
+
+// BinariesInfo is the binaries summary of api/storageinfo
+type BinariesInfo struct {
+	BinariesCount  StorageNumber `json:"binariesCount"`
+	BinariesSize   string        `json:"binariesSize"`
+	ArtifactsSize  string        `json:"artifactsSize"`
+	Optimization   string        `json:"optimization"`
+	ItemsCount     StorageNumber `json:"itemsCount"`
+	ArtifactsCount StorageNumber `json:"artifactsCount"`
+}
+
+// RepoStorageInfo is the storage of a repo in api/storageinfo
+type RepoStorageInfo struct {
+	Key              string        `json:"repoKey"`
+	RepoType         string        `json:"repoType"`
+	FoldersCount     StorageNumber `json:"foldersCount"`
+	FilesCount       StorageNumber `json:"filesCount"`
+	ItemsCount       StorageNumber `json:"itemsCount"`
+	UsedSpace        string        `json:"usedSpace"`
+	UsedSpaceInBytes StorageNumber `json:"usedSpaceInBytes"`
+	Percentage       string        `json:"percentage"`
+	PackageType      string        `json:"packageType"`
+}
+
+// StorageInfo is the response of api/storageinfo, as Artifactory formats it
+type StorageInfo struct {
+	FileStorage     FileStorageInfo   `json:"fileStoreSummary"`
+	BinariesStorage BinariesInfo      `json:"binariesSummary"`
+	RepoStorage     []RepoStorageInfo `json:"repositoriesSummaryList"`
+}
+
+// StorageTotalKey is the key of the repositoriesSummaryList entry summing up the repos
+const StorageTotalKey = "TOTAL"
+
+// FileStoreSummary is the parsed filestore summary, sizes in bytes
+type FileStoreSummary struct {
+	Type      string
+	Directory string
+	Total     int64
+	Used      int64
+	Free      int64
+}
+
+// BinariesSummary is the parsed binaries summary, sizes in bytes
+type BinariesSummary struct {
+	Count          int64
+	Size           int64
+	ArtifactsSize  int64
+	ArtifactsCount int64
+	ItemsCount     int64
+	// Optimization is the percentage of the artifacts size saved by deduplication
+	Optimization float64
+	// SizeResolution is the least difference of the sizes their human readable
+	// values can tell, like 10 MB for "1.45 GB"
+	SizeResolution int64
+}
+
+// RepoStorage is the parsed storage of a repo, or of several summed up
+type RepoStorage struct {
+	Key          string
+	RepoType     string
+	PackageType  string
+	FoldersCount int64
+	FilesCount   int64
+	ItemsCount   int64
+	UsedSpace    int64
+	Percentage   float64
+}
+
+// StorageSummary is the parsed storage summary of an Artifactory instance
+type StorageSummary struct {
+	FileStore FileStoreSummary
+	Binaries  BinariesSummary
+	Repos     []RepoStorage
+	// Total sums up the repos
+	Total RepoStorage
+}
+
+// Repo returns the storage of the repo, nil if it is not in the summary
+func (ss *StorageSummary) Repo(key string) *RepoStorage {
+	for i := range ss.Repos {
+		if ss.Repos[i].Key == key {
+			return &ss.Repos[i]
+		}
+	}
+	return nil
+}
+
+// TotalOf sums up the storage of the repos of repoType, like LOCAL or CACHE
+func (ss *StorageSummary) TotalOf(repoType string) RepoStorage {
+	total := RepoStorage{Key: StorageTotalKey, RepoType: repoType}
+	for _, r := range ss.Repos {
+		if r.RepoType == repoType {
+			total.FoldersCount += r.FoldersCount
+			total.FilesCount += r.FilesCount
+			total.ItemsCount += r.ItemsCount
+			total.UsedSpace += r.UsedSpace
+			total.Percentage += r.Percentage
+		}
+	}
+	return total
+}
+
+// storageUnits are the multipliers of the size units of api/storageinfo
+var storageUnits = map[string]float64{
+	"":      1,
+	"B":     1,
+	"BYTE":  1,
+	"BYTES": 1,
+	"KB":    1 << 10,
+	"MB":    1 << 20,
+	"GB":    1 << 30,
+	"TB":    1 << 40,
+	"PB":    1 << 50,
+}
+
+// normalizeNumber rewrites a number written with the separators of either
+// locale, like "1,234.5" or "1.234,5", as "1234.5". When both separators
+// appear the last one is the decimal one, a repeated separator groups the
+// thousands, and a single separator followed by 3 digits, like "1,234", is
+// ambiguous unless integer tells it groups the thousands.
+func normalizeNumber(value string, integer bool) (string, error) {
+	value = strings.TrimSpace(value)
+	var decimalSep, thousandsSep string
+	comma, dot := strings.LastIndex(value, ","), strings.LastIndex(value, ".")
+	switch {
+	case comma >= 0 && dot >= 0:
+		decimalSep, thousandsSep = ".", ","
+		if comma > dot {
+			decimalSep, thousandsSep = ",", "."
+		}
+	case comma >= 0 || dot >= 0:
+		sep, i := ",", comma
+		if dot >= 0 {
+			sep, i = ".", dot
+		}
+		switch {
+		case strings.Count(value, sep) > 1:
+			thousandsSep = sep
+		case len(value)-i-1 != 3 || value[:i] == "0":
+			decimalSep = sep
+		case integer:
+			thousandsSep = sep
+		default:
+			return "", fmt.Errorf("ambiguous separator in '%s'", value)
+		}
+	}
+
+	intPart, fracPart := value, ""
+	if decimalSep != "" {
+		if integer {
+			return "", fmt.Errorf("unexpected decimals in '%s'", value)
+		}
+		if strings.Count(value, decimalSep) > 1 {
+			return "", fmt.Errorf("repeated decimal separator in '%s'", value)
+		}
+		i := strings.Index(value, decimalSep)
+		intPart, fracPart = value[:i], value[i+1:]
+		if !isDigits(fracPart) {
+			return "", fmt.Errorf("invalid decimals in '%s'", value)
+		}
+	}
+	groups := []string{intPart}
+	if thousandsSep != "" {
+		groups = strings.Split(intPart, thousandsSep)
+		if len(groups[0]) > 3 || strings.HasPrefix(groups[0], "0") {
+			return "", fmt.Errorf("invalid thousands grouping in '%s'", value)
+		}
+	}
+	for n, g := range groups {
+		if !isDigits(g) || (n > 0 && len(g) != 3) {
+			return "", fmt.Errorf("invalid number '%s'", value)
+		}
+	}
+	if fracPart == "" {
+		return strings.Join(groups, ""), nil
+	}
+	return strings.Join(groups, "") + "." + fracPart, nil
+}
+
+// isDigits tells whether s is a non empty string of decimal digits
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// splitSize splits a size of api/storageinfo into its number, normalized by
+// normalizeNumber, and the multiplier of its unit
+func splitSize(value string) (string, float64, error) {
+	if i := strings.Index(value, "("); i >= 0 {
+		value = value[:i]
+	}
+	fields := strings.Fields(value)
+	if len(fields) == 1 {
+		// The unit may be stuck to the number, like "12GB"
+		number := strings.TrimRight(fields[0], "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ")
+		if unit := fields[0][len(number):]; unit != "" {
+			fields = []string{number, unit}
+		}
+	}
+	if len(fields) == 0 || len(fields) > 2 {
+		return "", 0, fmt.Errorf("invalid size '%s'", value)
+	}
+	unit := ""
+	if len(fields) == 2 {
+		unit = strings.ToUpper(fields[1])
+	}
+	multiplier, ok := storageUnits[unit]
+	if !ok {
+		return "", 0, fmt.Errorf("unknown unit of size '%s'", value)
+	}
+	// Sizes in bytes are whole, so their separators group the thousands
+	number, err := normalizeNumber(fields[0], multiplier == 1)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid size '%s' : %v", value, err)
+	}
+	return number, multiplier, nil
+}
+
+// ParseSize parses a size of api/storageinfo, like "1,024.5 MB", "12 bytes",
+// "18,6 GB" or "18.6 GB (38.2%)", into bytes
+func ParseSize(value string) (int64, error) {
+	number, multiplier, err := splitSize(value)
+	if err != nil {
+		return 0, err
+	}
+	size, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size '%s'", value)
+	}
+	return int64(size * multiplier), nil
+}
+
+// SizeResolution returns the least difference in bytes a size of
+// api/storageinfo can tell, from its unit and decimals, like 10 MB for "1.45 GB"
+func SizeResolution(value string) (int64, error) {
+	number, multiplier, err := splitSize(value)
+	if err != nil {
+		return 0, err
+	}
+	if i := strings.Index(number, "."); i >= 0 {
+		multiplier /= math.Pow10(len(number) - i - 1)
+	}
+	if multiplier < 1 {
+		return 1, nil
+	}
+	return int64(multiplier), nil
+}
+
+// ParseCount parses a count of api/storageinfo, like "1,234" or "1.234.567"
+func ParseCount(value string) (int64, error) {
+	number, err := normalizeNumber(value, true)
+	if err != nil {
+		return 0, fmt.Errorf("invalid count '%s' : %v", value, err)
+	}
+	count, err := strconv.ParseInt(number, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid count '%s'", value)
+	}
+	return count, nil
+}
+
+// ParsePercent parses a percentage of api/storageinfo, like "45.3%" or "45,3%"
+func ParsePercent(value string) (float64, error) {
+	number, err := normalizeNumber(strings.TrimSuffix(strings.TrimSpace(value), "%"), false)
+	if err != nil {
+		return 0, fmt.Errorf("invalid percentage '%s' : %v", value, err)
+	}
+	percent, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid percentage '%s'", value)
+	}
+	return percent, nil
+}
+
+// summaryParser parses the fields of a storage summary, keeping the first error
+type summaryParser struct {
+	err error
+}
+
+func (sp *summaryParser) count(n StorageNumber) int64 {
+	if n == "" {
+		return 0
+	}
+	count, err := ParseCount(string(n))
+	if err != nil && sp.err == nil {
+		sp.err = err
+	}
+	return count
+}
+
+// size parses the size in bytes when given, the human readable one otherwise
+func (sp *summaryParser) size(inBytes StorageNumber, value string) int64 {
+	if inBytes != "" {
+		return sp.count(inBytes)
+	}
+	if value == "" {
+		return 0
+	}
+	size, err := ParseSize(value)
+	if err != nil && sp.err == nil {
+		sp.err = err
+	}
+	return size
+}
+
+// resolution returns the coarsest resolution of the sizes, 1 byte when none
+// is human readable
+func (sp *summaryParser) resolution(values ...string) int64 {
+	res := int64(1)
+	for _, value := range values {
+		if value == "" {
+			continue
+		}
+		r, err := SizeResolution(value)
+		if err != nil && sp.err == nil {
+			sp.err = err
+		}
+		if r > res {
+			res = r
+		}
+	}
+	return res
+}
+
+func (sp *summaryParser) percent(value string) float64 {
+	if value == "" || value == "N/A" {
+		return 0
+	}
+	percent, err := ParsePercent(value)
+	if err != nil && sp.err == nil {
+		sp.err = err
+	}
+	return percent
+}
+
+// Summary parses the sizes, counts and percentages of the storage info
+func (si *StorageInfo) Summary() (*StorageSummary, error) {
+	sp := &summaryParser{}
+	fs, bs := si.FileStorage, si.BinariesStorage
+	summary := &StorageSummary{
+		FileStore: FileStoreSummary{
+			Type:      fs.StorageType,
+			Directory: fs.StorageDirectory,
+			Total:     sp.size(fs.TotalSpaceInBytes, fs.TotalSpace),
+			Used:      sp.size(fs.UsedSpaceInBytes, fs.UsedSpace),
+			Free:      sp.size(fs.FreeSpaceInBytes, fs.FreeSpace),
+		},
+		Binaries: BinariesSummary{
+			Count:          sp.count(bs.BinariesCount),
+			Size:           sp.size("", bs.BinariesSize),
+			ArtifactsSize:  sp.size("", bs.ArtifactsSize),
+			ArtifactsCount: sp.count(bs.ArtifactsCount),
+			ItemsCount:     sp.count(bs.ItemsCount),
+			Optimization:   sp.percent(bs.Optimization),
+			SizeResolution: sp.resolution(bs.BinariesSize, bs.ArtifactsSize),
+		},
+		Repos: []RepoStorage{},
+	}
+	hasTotal := false
+	for _, r := range si.RepoStorage {
+		repo := RepoStorage{
+			Key:          r.Key,
+			RepoType:     r.RepoType,
+			PackageType:  r.PackageType,
+			FoldersCount: sp.count(r.FoldersCount),
+			FilesCount:   sp.count(r.FilesCount),
+			ItemsCount:   sp.count(r.ItemsCount),
+			UsedSpace:    sp.size(r.UsedSpaceInBytes, r.UsedSpace),
+			Percentage:   sp.percent(r.Percentage),
+		}
+		if r.Key == StorageTotalKey {
+			summary.Total, hasTotal = repo, true
+			continue
+		}
+		summary.Repos = append(summary.Repos, repo)
+	}
+	if sp.err != nil {
+		return nil, sp.err
+	}
+	if !hasTotal {
+		for _, r := range summary.Repos {
+			summary.Total.FoldersCount += r.FoldersCount
+			summary.Total.FilesCount += r.FilesCount
+			summary.Total.ItemsCount += r.ItemsCount
+			summary.Total.UsedSpace += r.UsedSpace
+		}
+		summary.Total.Key, summary.Total.Percentage = StorageTotalKey, 100
+	}
+	return summary, nil
+}
+
+// GetStorageInfo returns the storage summary of api/storageinfo, as last calculated
+func GetStorageInfo(artDetails *jfauth.ServiceDetails) (*StorageInfo, error) {
+	body, err := getHttpResp(artDetails, "api/storageinfo")
+	if err != nil {
+		return nil, err
+	}
+	info := &StorageInfo{}
+	if err := json.Unmarshal(body, info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// GetStorageSummary returns the parsed storage summary of api/storageinfo
+func GetStorageSummary(artDetails *jfauth.ServiceDetails) (*StorageSummary, error) {
+	info, err := GetStorageInfo(artDetails)
+	if err != nil {
+		return nil, err
+	}
+	return info.Summary()
+}
+
+// CalculateStorageInfo schedules the calculation of the storage summary, which
+// Artifactory otherwise refreshes periodically
+func CalculateStorageInfo(artDetails *jfauth.ServiceDetails) error {
+	resp, err := doHttpReq(artDetails, "POST", "api/storageinfo/calculate", nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
@@ -0,0 +1,248 @@
+package remoteartifacts
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		value string
+		want  int64
+		fails bool
+	}{
+		{value: "0", want: 0},
+		{value: "12 bytes", want: 12},
+		{value: "1,234 bytes", want: 1234},
+		{value: "1.234 bytes", want: 1234},
+		{value: "512 B", want: 512},
+		{value: "1 KB", want: 1 << 10},
+		{value: "1.5 MB", want: 3 << 19},
+		{value: "1,5 MB", want: 3 << 19},
+		{value: "1,024.5 MB", want: 2049 << 19},
+		{value: "1.024,5 MB", want: 2049 << 19},
+		{value: "0,125 GB", want: 1 << 27},
+		{value: "0.125 GB", want: 1 << 27},
+		{value: "12GB", want: 12 << 30},
+		{value: "18.5 GB (38.2%)", want: 37 << 29},
+		{value: "18.6 GB (38.2%)", want: 19971597926},
+		{value: "18,6 GB (38,2%)", want: 19971597926},
+		{value: "2 TB", want: 2 << 40},
+		{value: "1 PB", want: 1 << 50},
+		{value: "1,234 KB", fails: true},
+		{value: "1.234 KB", fails: true},
+		{value: "1.2.3 KB", fails: true},
+		{value: "1,2,3 KB", fails: true},
+		{value: "12 XB", fails: true},
+		{value: "", fails: true},
+		{value: "GB", fails: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseSize(tt.value)
+		if tt.fails {
+			if err == nil {
+				t.Errorf("ParseSize(%q) = %d, want an error", tt.value, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ParseSize(%q) = %d, %v, want %d", tt.value, got, err, tt.want)
+		}
+	}
+}
+
+func TestSizeResolution(t *testing.T) {
+	tests := []struct {
+		value string
+		want  int64
+	}{
+		{"12 bytes", 1},
+		{"1,234 bytes", 1},
+		{"3 KB", 1 << 10},
+		{"1.45 TB", (1 << 40) / 100},
+		{"1,45 TB", (1 << 40) / 100},
+		{"18.6 GB (38.2%)", (1 << 30) / 10},
+		{"1,024.5 MB", (1 << 20) / 10},
+		{"0.001 KB", 1},
+	}
+	for _, tt := range tests {
+		if got, err := SizeResolution(tt.value); err != nil || got != tt.want {
+			t.Errorf("SizeResolution(%q) = %d, %v, want %d", tt.value, got, err, tt.want)
+		}
+	}
+	if _, err := SizeResolution("1,234 KB"); err == nil {
+		t.Errorf("SizeResolution(ambiguous) succeeded")
+	}
+}
+
+func TestParseCount(t *testing.T) {
+	tests := []struct {
+		value string
+		want  int64
+		fails bool
+	}{
+		{value: "0", want: 0},
+		{value: "42", want: 42},
+		{value: "1,234", want: 1234},
+		{value: "1.234", want: 1234},
+		{value: "1,234,567", want: 1234567},
+		{value: "1.234.567", want: 1234567},
+		{value: " 7 ", want: 7},
+		{value: "1,5", fails: true},
+		{value: "1.234,5", fails: true},
+		{value: "12,34", fails: true},
+		{value: "0,125", fails: true},
+		{value: "1,2345", fails: true},
+		{value: "abc", fails: true},
+		{value: "", fails: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseCount(tt.value)
+		if tt.fails {
+			if err == nil {
+				t.Errorf("ParseCount(%q) = %d, want an error", tt.value, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ParseCount(%q) = %d, %v, want %d", tt.value, got, err, tt.want)
+		}
+	}
+}
+
+func TestParsePercent(t *testing.T) {
+	tests := []struct {
+		value string
+		want  float64
+		fails bool
+	}{
+		{value: "0%", want: 0},
+		{value: "100%", want: 100},
+		{value: "45.25%", want: 45.25},
+		{value: "45,25%", want: 45.25},
+		{value: "45.5", want: 45.5},
+		{value: "45.255%", fails: true},
+		{value: "N/A", fails: true},
+	}
+	for _, tt := range tests {
+		got, err := ParsePercent(tt.value)
+		if tt.fails {
+			if err == nil {
+				t.Errorf("ParsePercent(%q) = %v, want an error", tt.value, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ParsePercent(%q) = %v, %v, want %v", tt.value, got, err, tt.want)
+		}
+	}
+}
+
+func TestStorageInfoSummary(t *testing.T) {
+	tests := []struct {
+		name  string
+		json  string
+		want  StorageSummary
+		fails bool
+	}{
+		{
+			name: "strings with a total",
+			json: `{
+				"fileStoreSummary": {"storageType": "file-system", "storageDirectory": "/data", "totalSpace": "2 TB", "usedSpace": "1,5 TB", "freeSpace": "512 GB"},
+				"binariesSummary": {"binariesCount": "1,234", "binariesSize": "3 GB", "artifactsSize": "4 GB", "optimization": "75%", "itemsCount": "2,000", "artifactsCount": "1,500"},
+				"repositoriesSummaryList": [
+					{"repoKey": "libs", "repoType": "LOCAL", "foldersCount": "10", "filesCount": "1,000", "itemsCount": "1,010", "usedSpace": "3 GB", "percentage": "75%", "packageType": "Maven"},
+					{"repoKey": "jcenter-cache", "repoType": "CACHE", "foldersCount": "5", "filesCount": "500", "itemsCount": "505", "usedSpace": "1 GB", "percentage": "25%", "packageType": "Maven"},
+					{"repoKey": "TOTAL", "repoType": "NA", "foldersCount": "15", "filesCount": "1,500", "itemsCount": "1,515", "usedSpace": "4 GB", "percentage": "100%"}
+				]
+			}`,
+			want: StorageSummary{
+				FileStore: FileStoreSummary{Type: "file-system", Directory: "/data", Total: 2 << 40, Used: 3 << 39, Free: 1 << 39},
+				Binaries:  BinariesSummary{Count: 1234, Size: 3 << 30, ArtifactsSize: 4 << 30, ArtifactsCount: 1500, ItemsCount: 2000, Optimization: 75, SizeResolution: 1 << 30},
+				Repos: []RepoStorage{
+					{Key: "libs", RepoType: "LOCAL", PackageType: "Maven", FoldersCount: 10, FilesCount: 1000, ItemsCount: 1010, UsedSpace: 3 << 30, Percentage: 75},
+					{Key: "jcenter-cache", RepoType: "CACHE", PackageType: "Maven", FoldersCount: 5, FilesCount: 500, ItemsCount: 505, UsedSpace: 1 << 30, Percentage: 25},
+				},
+				Total: RepoStorage{Key: "TOTAL", RepoType: "NA", FoldersCount: 15, FilesCount: 1500, ItemsCount: 1515, UsedSpace: 4 << 30, Percentage: 100},
+			},
+		},
+		{
+			name: "numbers and bytes without a total",
+			json: `{
+				"fileStoreSummary": {"totalSpace": "2 TB", "totalSpaceInBytes": 2199023255553, "usedSpaceInBytes": "1024", "freeSpaceInBytes": null},
+				"binariesSummary": {"binariesCount": 7, "binariesSize": "7 MB", "artifactsSize": "14 MB", "optimization": "50%"},
+				"repositoriesSummaryList": [
+					{"repoKey": "a", "repoType": "LOCAL", "foldersCount": 1, "filesCount": 2, "usedSpace": "1.5 TB", "usedSpaceInBytes": 1649267441665, "percentage": "N/A"},
+					{"repoKey": "b", "repoType": "LOCAL", "foldersCount": null, "filesCount": 3, "usedSpace": "1 KB"}
+				]
+			}`,
+			want: StorageSummary{
+				FileStore: FileStoreSummary{Total: 2199023255553, Used: 1024},
+				Binaries:  BinariesSummary{Count: 7, Size: 7 << 20, ArtifactsSize: 14 << 20, Optimization: 50, SizeResolution: 1 << 20},
+				Repos: []RepoStorage{
+					{Key: "a", RepoType: "LOCAL", FoldersCount: 1, FilesCount: 2, UsedSpace: 1649267441665},
+					{Key: "b", RepoType: "LOCAL", FilesCount: 3, UsedSpace: 1 << 10},
+				},
+				Total: RepoStorage{Key: "TOTAL", FoldersCount: 1, FilesCount: 5, UsedSpace: 1649267441665 + 1<<10, Percentage: 100},
+			},
+		},
+		{
+			name:  "invalid size",
+			json:  `{"repositoriesSummaryList": [{"repoKey": "a", "usedSpace": "1,234 KB"}]}`,
+			fails: true,
+		},
+	}
+	for _, tt := range tests {
+		info := &StorageInfo{}
+		if err := json.Unmarshal([]byte(tt.json), info); err != nil {
+			t.Fatalf("%s: unmarshal: %v", tt.name, err)
+		}
+		got, err := info.Summary()
+		if tt.fails {
+			if err == nil {
+				t.Errorf("%s: Summary() = %+v, want an error", tt.name, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: Summary() failed: %v", tt.name, err)
+			continue
+		}
+		if got.FileStore != tt.want.FileStore || got.Binaries != tt.want.Binaries || got.Total != tt.want.Total {
+			t.Errorf("%s: Summary() = %+v, want %+v", tt.name, *got, tt.want)
+		}
+		if len(got.Repos) != len(tt.want.Repos) {
+			t.Errorf("%s: Summary() repos = %+v, want %+v", tt.name, got.Repos, tt.want.Repos)
+			continue
+		}
+		for i := range got.Repos {
+			if got.Repos[i] != tt.want.Repos[i] {
+				t.Errorf("%s: Summary() repo %d = %+v, want %+v", tt.name, i, got.Repos[i], tt.want.Repos[i])
+			}
+		}
+		if tt.want.Total.RepoType == "" && got.TotalOf("LOCAL").UsedSpace != got.Total.UsedSpace {
+			t.Errorf("%s: TotalOf(LOCAL) = %+v, want the used space of %+v", tt.name, got.TotalOf("LOCAL"), got.Total)
+		}
+	}
+}
+
+func TestStorageNumberUnmarshal(t *testing.T) {
+	tests := []struct {
+		json string
+		want StorageNumber
+	}{
+		{json: `12`, want: "12"},
+		{json: `"1,234"`, want: "1,234"},
+		{json: `null`, want: ""},
+	}
+	for _, tt := range tests {
+		var n StorageNumber
+		if err := json.Unmarshal([]byte(tt.json), &n); err != nil || n != tt.want {
+			t.Errorf("unmarshal %s = %q, %v, want %q", tt.json, n, err, tt.want)
+		}
+	}
+	var n StorageNumber
+	if err := json.Unmarshal([]byte(`{}`), &n); err == nil {
+		t.Errorf("unmarshal {} = %q, want an error", n)
+	}
+}
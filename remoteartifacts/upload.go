@@ -0,0 +1,32 @@
+package remoteartifacts
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+
+	jfauth "github.com/jfrog/jfrog-client-go/auth"
+)
+
+// checksumHeaders returns the checksum headers Artifactory verifies on deploy
+func checksumHeaders(data []byte) map[string]string {
+	sum1 := sha1.Sum(data)
+	sum256 := sha256.Sum256(data)
+	sumMd5 := md5.Sum(data)
+	return map[string]string{
+		"X-Checksum-Sha1":   hex.EncodeToString(sum1[:]),
+		"X-Checksum-Sha256": hex.EncodeToString(sum256[:]),
+		"X-Checksum-Md5":    hex.EncodeToString(sumMd5[:]),
+	}
+}
+
+// UploadArtifact deploys data to repoPath, given as <repo>/<path>, with a PUT request
+func UploadArtifact(artDetails *jfauth.ServiceDetails, repoPath string, data []byte) error {
+	resp, err := doHttpReq(artDetails, "PUT", repoPath, data, checksumHeaders(data))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
@@ -0,0 +1,116 @@
+package remoteartifacts
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+
+	jfauth "github.com/jfrog/jfrog-client-go/auth"
+)
+
+// Xray artifact scan statuses
+const (
+	XrayScanDone         = "DONE"
+	XrayScanFailed       = "FAILED"
+	XrayScanPending      = "PENDING"
+	XrayScanScanning     = "SCANNING"
+	XrayScanInProgress   = "IN_PROGRESS"
+	XrayScanNotSupported = "NOT_SUPPORTED"
+)
+
+// XrayUrl returns the URL of the Xray service of the platform of the Artifactory
+func XrayUrl(artDetails *jfauth.ServiceDetails) string {
+	return strings.TrimSuffix((*artDetails).GetUrl(), "artifactory/") + "xray/"
+}
+
+// doXrayReq issues a request with a JSON body to the Xray REST API
+func doXrayReq(artDetails *jfauth.ServiceDetails, method string, uri string, body interface{}) ([]byte, error) {
+	var reqBody []byte
+	if body != nil {
+		var err error
+		if reqBody, err = json.Marshal(body); err != nil {
+			return nil, err
+		}
+	}
+	resp, err := doHttpReqURL(artDetails, method, XrayUrl(artDetails)+uri, reqBody, map[string]string{"Content-Type": "application/json"})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return ioutil.ReadAll(resp.Body)
+}
+
+// CreateXrayPolicy creates, or updates when present, a security policy with a
+// single rule matching vulnerabilities of minSeverity and above
+func CreateXrayPolicy(artDetails *jfauth.ServiceDetails, name string, minSeverity string) error {
+	policy := map[string]interface{}{
+		"name":        name,
+		"type":        "security",
+		"description": "A policy created by the data simulator",
+		"rules": []map[string]interface{}{{
+			"name":     name + "-rule",
+			"priority": 1,
+			"criteria": map[string]interface{}{"min_severity": minSeverity},
+			"actions":  map[string]interface{}{"fail_build": false},
+		}},
+	}
+	_, err := doXrayReq(artDetails, "POST", "api/v2/policies", policy)
+	if IsConflict(err) {
+		_, err = doXrayReq(artDetails, "PUT", "api/v2/policies/"+name, policy)
+	}
+	return err
+}
+
+// CreateXrayWatch creates, or updates when present, a watch of the repos
+// applying the policy
+func CreateXrayWatch(artDetails *jfauth.ServiceDetails, name string, policy string, repos []string) error {
+	resources := []map[string]interface{}{}
+	for _, r := range repos {
+		resources = append(resources, map[string]interface{}{"type": "repository", "bin_mgr_id": "default", "name": r})
+	}
+	watch := map[string]interface{}{
+		"general_data":      map[string]interface{}{"name": name, "description": "A watch created by the data simulator", "active": true},
+		"project_resources": map[string]interface{}{"resources": resources},
+		"assigned_policies": []map[string]interface{}{{"name": policy, "type": "security"}},
+	}
+	_, err := doXrayReq(artDetails, "POST", "api/v2/watches", watch)
+	if IsConflict(err) {
+		_, err = doXrayReq(artDetails, "PUT", "api/v2/watches/"+name, watch)
+	}
+	return err
+}
+
+// SetXrayIndex enables the Xray indexing of the repo
+func SetXrayIndex(artDetails *jfauth.ServiceDetails, repoKey string) error {
+	resp, err := doHttpReq(artDetails, "POST", "api/repositories/"+repoKey, []byte(`{"xrayIndex":true}`), map[string]string{"Content-Type": "application/json"})
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// ScanArtifact triggers an on-demand scan of the artifact at path in repo
+func ScanArtifact(artDetails *jfauth.ServiceDetails, repo string, path string) error {
+	_, err := doXrayReq(artDetails, "POST", "api/v1/forceReindex", map[string]interface{}{
+		"artifacts": []map[string]string{{"repository": repo, "path": path}},
+	})
+	return err
+}
+
+// GetArtifactScanStatus returns the overall scan status of the artifact at path in repo
+func GetArtifactScanStatus(artDetails *jfauth.ServiceDetails, repo string, path string) (string, error) {
+	body, err := doXrayReq(artDetails, "POST", "api/v1/artifact/status", map[string]string{"repo": repo, "path": path})
+	if err != nil {
+		return "", err
+	}
+	status := struct {
+		Overall struct {
+			Status string `json:"status"`
+		} `json:"overall"`
+	}{}
+	if err := json.Unmarshal(body, &status); err != nil {
+		return "", err
+	}
+	return status.Overall.Status, nil
+}
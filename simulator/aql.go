@@ -0,0 +1,68 @@
+package simulator
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path"
+)
+
+// AqlItem is an item returned by an AQL items query
+type AqlItem struct {
+	Repo   string `json:"repo"`
+	Path   string `json:"path"`
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Size   int64  `json:"size"`
+	Sha256 string `json:"sha256"`
+	Sha1   string `json:"actual_sha1"`
+	Md5    string `json:"actual_md5"`
+}
+
+// RepoPath returns the <repo>/<path> of the item
+func (ai AqlItem) RepoPath() string {
+	return path.Join(ai.Repo, ai.Path, ai.Name)
+}
+
+// aqlItems runs an AQL items query in the DUT and returns the items found
+func aqlItems(d *Dut, aql string) ([]AqlItem, error) {
+	resp, err := (*d.RtMgr).Aql(aql)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Close()
+	body, err := ioutil.ReadAll(resp)
+	if err != nil {
+		return nil, err
+	}
+	result := struct {
+		Results []AqlItem `json:"results"`
+	}{}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, err
+	}
+	return result.Results, nil
+}
+
+// findItems returns up to limit items of itemType, "file" or "folder", in repo
+func findItems(d *Dut, repo string, itemType string, limit int) ([]AqlItem, error) {
+	aql := fmt.Sprintf(`items.find({"repo":"%s","type":"%s"}).include("repo","path","name","type","size","sha256","actual_sha1","actual_md5").limit(%d)`,
+		repo, itemType, limit)
+	return aqlItems(d, aql)
+}
+
+// findFiles returns up to limit files of the repos, taken in order
+func findFiles(d *Dut, repos []string, limit int) ([]AqlItem, error) {
+	files := []AqlItem{}
+	for _, repo := range repos {
+		if len(files) >= limit {
+			break
+		}
+		found, err := findItems(d, repo, "file", limit-len(files))
+		if err != nil {
+			return nil, fmt.Errorf("repo %s: %v", repo, err)
+		}
+		files = append(files, found...)
+	}
+	return files, nil
+}
@@ -0,0 +1,219 @@
+package simulator
+
+import (
+	"fmt"
+	"math/rand"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jfrog/jfrog-client-go/artifactory/buildinfo"
+	"github.com/jfrog/jfrog-client-go/artifactory/services"
+	jflog "github.com/jfrog/jfrog-client-go/utils/log"
+	"jfrog.com/datasim/stats"
+)
+
+// DefaultBuildPrefix prefixes the build names of the build info simulation
+const DefaultBuildPrefix = "datasim-build"
+
+// buildItemsLimit bounds the uploaded files builds reference
+const buildItemsLimit = 10000
+
+// BuildInfoCfg configures the build info simulation
+type BuildInfoCfg struct {
+	TargetCfg   `yaml:",inline"`
+	Enabled     bool   `yaml:"enabled"`
+	BuildPrefix string `yaml:"buildprefix"`
+	// Builds reference the files of the repos starting with RepoPrefix
+	RepoPrefix      string `yaml:"repoprefix"`
+	NumBuildNames   int    `yaml:"numbuildnames"`
+	NumBuildNumbers int    `yaml:"numbuildnumbers"`
+	NumModules      int    `yaml:"nummodules"`
+	NumArtifacts    int    `yaml:"numartifacts"`
+	NumDependencies int    `yaml:"numdependencies"`
+	NumWorkers      int    `yaml:"numworkers"`
+	// PromotePercent of the builds are promoted with PromoteStatus, their
+	// artifacts being copied to PromoteRepo when set
+	PromotePercent int    `yaml:"promotepercent"`
+	PromoteStatus  string `yaml:"promotestatus"`
+	PromoteRepo    string `yaml:"promoterepo"`
+	// Once published, only the last KeepBuilds builds of each name are kept
+	KeepBuilds int `yaml:"keepbuilds"`
+}
+
+// buildJob is one build number to publish
+type buildJob struct {
+	name   string
+	number int
+}
+
+// SimBuildInfo simulates CI servers by publishing build info objects whose
+// modules reference the files uploaded by the simulator, promoting some of them
+// and discarding the old builds
+func (s *Simulator) SimBuildInfo(cfg BuildInfoCfg) error {
+	if cfg.BuildPrefix == "" {
+		cfg.BuildPrefix = DefaultBuildPrefix
+	}
+	if cfg.RepoPrefix == "" {
+		cfg.RepoPrefix = DefaultUploadRepoPrefix
+	}
+	if cfg.PromoteStatus == "" {
+		cfg.PromoteStatus = "released"
+	}
+	if cfg.NumModules < 1 {
+		cfg.NumModules = 1
+	}
+	if cfg.NumWorkers < 1 {
+		cfg.NumWorkers = 1
+	}
+
+	return s.runOnTargets("buildinfo", cfg.TargetCfg, func(ds *DutSet) error {
+		items := map[*Dut][]AqlItem{}
+		for _, d := range ds.Duts {
+			repos, err := listSimRepos(d, cfg.RepoPrefix)
+			if err != nil {
+				jflog.Error(fmt.Sprintf("Failed listing repos of DUT %s : %v", d.Name, err))
+				return err
+			}
+			if items[d], err = findFiles(d, repos, buildItemsLimit); err != nil {
+				jflog.Error(fmt.Sprintf("Failed to find items in DUT %s : %v", d.Name, err))
+				return err
+			}
+			if len(items[d]) == 0 {
+				err := fmt.Errorf("no file in the repos starting with %s of DUT %s", cfg.RepoPrefix, d.Name)
+				jflog.Error(fmt.Sprintf("buildinfo: %v", err))
+				return err
+			}
+			if cfg.PromoteRepo != "" && cfg.PromotePercent > 0 {
+				if err := createLocalRepo(d, cfg.PromoteRepo, "generic"); err != nil {
+					return err
+				}
+			}
+		}
+
+		// Build numbers are published in order, so a name is kept on one worker
+		jobs := make([]chan buildJob, cfg.NumWorkers)
+		var workerg sync.WaitGroup
+		workerg.Add(cfg.NumWorkers)
+		for i := 0; i < cfg.NumWorkers; i++ {
+			jobs[i] = make(chan buildJob)
+			go func(wnum int) {
+				defer workerg.Done()
+				rng := rand.New(rand.NewSource(time.Now().UnixNano() + int64(wnum)))
+				for job := range jobs[wnum] {
+					d := ds.Next()
+					if err := publishBuild(cfg, d, rng, items[d], job); err != nil {
+						continue
+					}
+					if rng.Intn(100) < cfg.PromotePercent {
+						promoteBuild(cfg, d, job)
+					}
+				}
+			}(i)
+		}
+		for n := 1; n <= cfg.NumBuildNumbers; n++ {
+			for b := 1; b <= cfg.NumBuildNames; b++ {
+				jobs[(b-1)%cfg.NumWorkers] <- buildJob{name: fmt.Sprintf("%s-%d", cfg.BuildPrefix, b), number: n}
+			}
+		}
+		for _, ch := range jobs {
+			close(ch)
+		}
+		workerg.Wait()
+
+		if cfg.KeepBuilds > 0 {
+			for _, d := range ds.Duts {
+				for b := 1; b <= cfg.NumBuildNames; b++ {
+					discardBuilds(cfg, d, fmt.Sprintf("%s-%d", cfg.BuildPrefix, b))
+				}
+			}
+		}
+		jflog.Info(fmt.Sprintf("All buildinfo workers completed on DUT(s) %s", ds.Names()))
+		return nil
+	})
+}
+
+// newBuildInfo returns a build info whose modules reference random items
+func newBuildInfo(cfg BuildInfoCfg, rng *rand.Rand, items []AqlItem, job buildJob) *buildinfo.BuildInfo {
+	build := buildinfo.New()
+	build.Name = job.name
+	build.Number = strconv.Itoa(job.number)
+	build.Started = time.Now().Format(buildinfo.TimeFormat)
+	build.SetAgentName("datasim")
+	build.Properties = buildinfo.Env{"buildInfo.env.DATASIM": "true"}
+	for m := 1; m <= cfg.NumModules; m++ {
+		module := buildinfo.Module{
+			Type: buildinfo.Generic,
+			Id:   fmt.Sprintf("%s:module-%d:%d", job.name, m, job.number),
+		}
+		for i := 0; i < cfg.NumArtifacts; i++ {
+			it := items[rng.Intn(len(items))]
+			module.Artifacts = append(module.Artifacts, buildinfo.Artifact{
+				Name:     it.Name,
+				Type:     strings.TrimPrefix(path.Ext(it.Name), "."),
+				Path:     path.Join(it.Path, it.Name),
+				Checksum: &buildinfo.Checksum{Sha1: it.Sha1, Md5: it.Md5},
+			})
+		}
+		for i := 0; i < cfg.NumDependencies; i++ {
+			it := items[rng.Intn(len(items))]
+			module.Dependencies = append(module.Dependencies, buildinfo.Dependency{
+				Id:       it.Name,
+				Type:     strings.TrimPrefix(path.Ext(it.Name), "."),
+				Scopes:   []string{"compile"},
+				Checksum: &buildinfo.Checksum{Sha1: it.Sha1, Md5: it.Md5},
+			})
+		}
+		build.Modules = append(build.Modules, module)
+	}
+	return build
+}
+
+// publishBuild publishes a generated build info of the job
+func publishBuild(cfg BuildInfoCfg, d *Dut, rng *rand.Rand, items []AqlItem, job buildJob) error {
+	rec := stats.NewRecorder("buildinfo", d.Name)
+	build := newBuildInfo(cfg, rng, items, job)
+	start := time.Now()
+	err := (*d.RtMgr).PublishBuildInfo(build, "")
+	rec.Record("publish", start, err)
+	if err != nil {
+		jflog.Error(fmt.Sprintf("Failed to publish build %s/%s in DUT %s : %v", build.Name, build.Number, d.Name, err))
+	}
+	return err
+}
+
+// promoteBuild promotes the build of the job
+func promoteBuild(cfg BuildInfoCfg, d *Dut, job buildJob) {
+	rec := stats.NewRecorder("buildinfo", d.Name)
+	params := services.PromotionParams{
+		BuildName:   job.name,
+		BuildNumber: strconv.Itoa(job.number),
+		Status:      cfg.PromoteStatus,
+		Comment:     "Promoted by the data simulator",
+		TargetRepo:  cfg.PromoteRepo,
+		Copy:        true,
+	}
+	start := time.Now()
+	err := (*d.RtMgr).PromoteBuild(params)
+	rec.Record("promote", start, err)
+	if err != nil {
+		jflog.Error(fmt.Sprintf("Failed to promote build %s/%d in DUT %s : %v", job.name, job.number, d.Name, err))
+	}
+}
+
+// discardBuilds deletes the builds of the name but the last KeepBuilds ones
+func discardBuilds(cfg BuildInfoCfg, d *Dut, name string) {
+	rec := stats.NewRecorder("buildinfo", d.Name)
+	params := services.DiscardBuildsParams{
+		BuildName: name,
+		MaxBuilds: strconv.Itoa(cfg.KeepBuilds),
+	}
+	start := time.Now()
+	err := (*d.RtMgr).DiscardBuilds(params)
+	rec.Record("discard", start, err)
+	if err != nil {
+		jflog.Error(fmt.Sprintf("Failed to discard builds %s in DUT %s : %v", name, d.Name, err))
+	}
+}
@@ -0,0 +1,373 @@
+package simulator
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	jflog "github.com/jfrog/jfrog-client-go/utils/log"
+	"jfrog.com/datasim/remoteartifacts"
+	"jfrog.com/datasim/stats"
+)
+
+// churnRefillLimit bounds the items fetched at a time for a repo
+const churnRefillLimit = 1000
+
+// ChurnCfg configures the churn simulation
+type ChurnCfg struct {
+	TargetCfg  `yaml:",inline"`
+	Enabled    bool    `yaml:"enabled"`
+	RepoPrefix string  `yaml:"repoprefix"`
+	RatePerSec float64 `yaml:"ratepersec"`
+	// The simulation stops after DurationSecs or NumDeletes, whichever comes first
+	DurationSecs int `yaml:"durationsecs"`
+	NumDeletes   int `yaml:"numdeletes"`
+	NumWorkers   int `yaml:"numworkers"`
+	Mix          struct {
+		Artifact int `yaml:"artifact"`
+		Folder   int `yaml:"folder"`
+		Repo     int `yaml:"repo"`
+	} `yaml:"mix"`
+	EmptyTrash              bool `yaml:"emptytrash"`
+	RunGc                   bool `yaml:"rungc"`
+	MaintenanceIntervalSecs int  `yaml:"maintenanceintervalsecs"`
+}
+
+// churnPool holds the simulator owned repos and items of a DUT left to delete
+type churnPool struct {
+	mu      sync.Mutex
+	repos   []string
+	files   map[string][]AqlItem
+	folders map[string][]AqlItem
+	// The repos found without items of a type, by type
+	emptied map[string]map[string]bool
+}
+
+// newChurnPool creates the pool of the repos of the DUT starting with prefix
+func newChurnPool(d *Dut, prefix string) (*churnPool, error) {
+	repos, err := listSimRepos(d, prefix)
+	if err != nil {
+		return nil, err
+	}
+	jflog.Info(fmt.Sprintf("Churn candidates in DUT %s : %v", d.Name, repos))
+	return &churnPool{
+		repos:   repos,
+		files:   map[string][]AqlItem{},
+		folders: map[string][]AqlItem{},
+		emptied: map[string]map[string]bool{"file": {}, "folder": {}},
+	}, nil
+}
+
+// pickRepo returns a random repo of the pool still holding items of itemType,
+// any repo when itemType is "", and "" when there is none left
+func (cp *churnPool) pickRepo(rng *rand.Rand, itemType string, remove bool) string {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	candidates := cp.candidates(itemType)
+	if len(candidates) == 0 {
+		return ""
+	}
+	repo := candidates[rng.Intn(len(candidates))]
+	if remove {
+		for i, r := range cp.repos {
+			if r == repo {
+				cp.repos = append(cp.repos[:i], cp.repos[i+1:]...)
+				break
+			}
+		}
+		delete(cp.files, repo)
+		delete(cp.folders, repo)
+	}
+	return repo
+}
+
+// candidates returns the repos still holding items of itemType, all of them
+// when itemType is "". The caller holds cp.mu.
+func (cp *churnPool) candidates(itemType string) []string {
+	if itemType == "" {
+		return cp.repos
+	}
+	candidates := []string{}
+	for _, repo := range cp.repos {
+		if !cp.emptied[itemType][repo] {
+			candidates = append(candidates, repo)
+		}
+	}
+	return candidates
+}
+
+// weights returns the weights of the artifact, folder and repo deletes with
+// the kinds the pool has nothing left for set to 0, and their total
+func (cp *churnPool) weights(weights []int) ([]int, int) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	left := make([]int, len(weights))
+	total := 0
+	for kind, itemType := range []string{"file", "folder", ""} {
+		if len(cp.candidates(itemType)) > 0 {
+			left[kind] = weights[kind]
+			total += weights[kind]
+		}
+	}
+	return left, total
+}
+
+// pickItem removes and returns a random item of itemType in repo, fetching
+// more from the DUT when none is left. It returns nil once the repo has no
+// more such items.
+func (cp *churnPool) pickItem(d *Dut, rng *rand.Rand, repo string, itemType string) (*AqlItem, error) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	items := cp.files
+	if itemType == "folder" {
+		items = cp.folders
+	}
+	if len(items[repo]) == 0 {
+		// The lock is released during the query, for the other workers to go on
+		cp.mu.Unlock()
+		found, err := findItems(d, repo, itemType, churnRefillLimit)
+		cp.mu.Lock()
+		if err != nil {
+			return nil, err
+		}
+		// Another worker may have refilled the repo, or deleted it, meanwhile
+		if len(items[repo]) == 0 && containsString(cp.repos, repo) {
+			// The repo root is returned as a folder named "."
+			for _, it := range found {
+				if it.Name != "." {
+					items[repo] = append(items[repo], it)
+				}
+			}
+			if len(items[repo]) == 0 {
+				cp.emptied[itemType][repo] = true
+			}
+		}
+		if len(items[repo]) == 0 {
+			return nil, nil
+		}
+	}
+	i := rng.Intn(len(items[repo]))
+	item := items[repo][i]
+	items[repo] = append(items[repo][:i], items[repo][i+1:]...)
+	return &item, nil
+}
+
+// forgetFolder drops the items below a deleted folder from the pool
+func (cp *churnPool) forgetFolder(folder AqlItem) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	prefix := folder.RepoPath() + "/"
+	for _, items := range []map[string][]AqlItem{cp.files, cp.folders} {
+		kept := []AqlItem{}
+		for _, it := range items[folder.Repo] {
+			if !strings.HasPrefix(it.RepoPath()+"/", prefix) {
+				kept = append(kept, it)
+			}
+		}
+		items[folder.Repo] = kept
+	}
+}
+
+// SimChurn simulates deletes by removing, at the configured rate, artifacts,
+// folders and repos created by the simulator, optionally followed by emptying
+// the trash can and running the garbage collection
+func (s *Simulator) SimChurn(cfg ChurnCfg) error {
+	if cfg.RepoPrefix == "" {
+		cfg.RepoPrefix = DefaultUploadRepoPrefix
+	}
+	if cfg.NumWorkers < 1 {
+		cfg.NumWorkers = 1
+	}
+	if cfg.DurationSecs <= 0 && cfg.NumDeletes <= 0 {
+		err := fmt.Errorf("durationsecs or numdeletes must be set")
+		jflog.Error(fmt.Sprintf("churn: %v", err))
+		return err
+	}
+	weights := []int{cfg.Mix.Artifact, cfg.Mix.Folder, cfg.Mix.Repo}
+	totalWeight := 0
+	for _, w := range weights {
+		totalWeight += w
+	}
+	if totalWeight == 0 {
+		weights, totalWeight = []int{1, 0, 0}, 1
+	}
+
+	return s.runOnTargets("churn", cfg.TargetCfg, func(ds *DutSet) error {
+		pools := map[*Dut]*churnPool{}
+		for _, d := range ds.Duts {
+			pool, err := newChurnPool(d, cfg.RepoPrefix)
+			if err != nil {
+				jflog.Error(fmt.Sprintf("Failed listing repos of DUT %s : %v", d.Name, err))
+				return err
+			}
+			pools[d] = pool
+		}
+
+		done := make(chan struct{})
+		var maintg sync.WaitGroup
+		if (cfg.EmptyTrash || cfg.RunGc) && cfg.MaintenanceIntervalSecs > 0 {
+			maintg.Add(1)
+			go func() {
+				defer maintg.Done()
+				ticker := time.NewTicker(time.Duration(cfg.MaintenanceIntervalSecs) * time.Second)
+				defer ticker.Stop()
+				for {
+					select {
+					case <-ticker.C:
+						churnMaintenance(cfg, ds)
+					case <-done:
+						return
+					}
+				}
+			}()
+		}
+
+		// Only the deletes count toward numdeletes, and the run stops early once
+		// the pools have nothing left to delete
+		stop := make(chan struct{})
+		var stopOnce sync.Once
+		stopRun := func() { stopOnce.Do(func() { close(stop) }) }
+		var deletes int64
+		ticks := rateTicksUntil(stop, cfg.RatePerSec, cfg.DurationSecs, 0)
+		var workerg sync.WaitGroup
+		workerg.Add(cfg.NumWorkers)
+		for i := 0; i < cfg.NumWorkers; i++ {
+			go func(wnum int) {
+				defer workerg.Done()
+				rng := rand.New(rand.NewSource(time.Now().UnixNano() + int64(wnum)))
+				for range ticks {
+					d := ds.Next()
+					left, total := pools[d].weights(weights)
+					if total == 0 || !churnDelete(d, pools[d], rng, pickWeighted(rng, left, total)) {
+						if churnExhausted(pools, weights) {
+							jflog.Info(fmt.Sprintf("Nothing left to churn in DUT(s) %s", ds.Names()))
+							stopRun()
+						}
+						continue
+					}
+					if cfg.NumDeletes > 0 && atomic.AddInt64(&deletes, 1) >= int64(cfg.NumDeletes) {
+						stopRun()
+					}
+				}
+			}(i)
+		}
+		workerg.Wait()
+		close(done)
+		maintg.Wait()
+
+		if cfg.EmptyTrash || cfg.RunGc {
+			churnMaintenance(cfg, ds)
+		}
+		jflog.Info(fmt.Sprintf("All churn workers completed on DUT(s) %s", ds.Names()))
+		return nil
+	})
+}
+
+// pickWeighted returns the index of a weight, drawn proportionally to the weights
+func pickWeighted(rng *rand.Rand, weights []int, totalWeight int) int {
+	n := rng.Intn(totalWeight)
+	for i, w := range weights {
+		if n < w {
+			return i
+		}
+		n -= w
+	}
+	return len(weights) - 1
+}
+
+// churnExhausted tells whether none of the pools has anything left to delete
+// for the kinds with a weight
+func churnExhausted(pools map[*Dut]*churnPool, weights []int) bool {
+	for _, pool := range pools {
+		if _, total := pool.weights(weights); total > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// churnDelete deletes an artifact (kind 0), a folder (kind 1) or a repo (kind
+// 2), returning false when the pool has nothing left of that kind
+func churnDelete(d *Dut, pool *churnPool, rng *rand.Rand, kind int) bool {
+	rec := stats.NewRecorder("churn", d.Name)
+	if kind == 2 {
+		repo := pool.pickRepo(rng, "", true)
+		if repo == "" {
+			jflog.Debug(fmt.Sprintf("No simulator repo left to churn in DUT %s", d.Name))
+			return false
+		}
+		start := time.Now()
+		err := (*d.RtMgr).DeleteRepository(repo)
+		rec.Record("delete-repo", start, err)
+		if err != nil {
+			jflog.Error(fmt.Sprintf("Failed to delete repo %s in DUT %s : %v", repo, d.Name, err))
+			return true
+		}
+		jflog.Info(fmt.Sprintf("Deleted repo %s in DUT %s", repo, d.Name))
+		return true
+	}
+
+	itemType, op := "file", "delete-artifact"
+	if kind == 1 {
+		itemType, op = "folder", "delete-folder"
+	}
+	// Repos found empty and items already deleted along with their parent
+	// folder are skipped, until one is deleted or none is left
+	for {
+		repo := pool.pickRepo(rng, itemType, false)
+		if repo == "" {
+			jflog.Debug(fmt.Sprintf("No %s left to delete in DUT %s", itemType, d.Name))
+			return false
+		}
+		item, err := pool.pickItem(d, rng, repo, itemType)
+		if err != nil {
+			jflog.Error(fmt.Sprintf("Failed to find items in repo %s of DUT %s : %v", repo, d.Name, err))
+			return true
+		}
+		if item == nil {
+			jflog.Debug(fmt.Sprintf("No %s left to delete in repo %s of DUT %s", itemType, repo, d.Name))
+			continue
+		}
+		start := time.Now()
+		err = remoteartifacts.DeleteItem(d.RtDetail, item.RepoPath())
+		if remoteartifacts.IsNotFound(err) {
+			jflog.Debug(fmt.Sprintf("%s was already deleted in DUT %s", item.RepoPath(), d.Name))
+			continue
+		}
+		rec.Record(op, start, err)
+		if err != nil {
+			jflog.Error(fmt.Sprintf("Failed to delete %s in DUT %s : %v", item.RepoPath(), d.Name, err))
+			return true
+		}
+		if kind == 1 {
+			pool.forgetFolder(*item)
+		}
+		return true
+	}
+}
+
+// churnMaintenance empties the trash can and runs the garbage collection in the DUTs
+func churnMaintenance(cfg ChurnCfg, ds *DutSet) {
+	for _, d := range ds.Duts {
+		rec := stats.NewRecorder("churn", d.Name)
+		if cfg.EmptyTrash {
+			start := time.Now()
+			err := remoteartifacts.EmptyTrashCan(d.RtDetail)
+			rec.Record("empty-trash", start, err)
+			if err != nil {
+				jflog.Error(fmt.Sprintf("Failed to empty the trash can of DUT %s : %v", d.Name, err))
+			}
+		}
+		if cfg.RunGc {
+			start := time.Now()
+			err := remoteartifacts.RunGarbageCollection(d.RtDetail)
+			rec.Record("gc", start, err)
+			if err != nil {
+				jflog.Error(fmt.Sprintf("Failed to run the garbage collection of DUT %s : %v", d.Name, err))
+			}
+		}
+	}
+}
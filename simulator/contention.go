@@ -0,0 +1,244 @@
+package simulator
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	jflog "github.com/jfrog/jfrog-client-go/utils/log"
+	"jfrog.com/datasim/generator"
+	"jfrog.com/datasim/remoteartifacts"
+	"jfrog.com/datasim/stats"
+)
+
+// DefaultContentionRepoKey is the repo of the contention simulation
+const DefaultContentionRepoKey = "datasim-contention"
+
+// ContentionCfg configures the concurrent same path contention simulation
+type ContentionCfg struct {
+	TargetCfg `yaml:",inline"`
+	Enabled   bool   `yaml:"enabled"`
+	RepoKey   string `yaml:"repokey"`
+	// The workers contend on NumPaths paths, each version written being FileSize bytes
+	NumPaths   int     `yaml:"numpaths"`
+	FileSize   int64   `yaml:"filesize"`
+	NumWorkers int     `yaml:"numworkers"`
+	RatePerSec float64 `yaml:"ratepersec"`
+	// The simulation stops after DurationSecs or NumOps, whichever comes first
+	DurationSecs int `yaml:"durationsecs"`
+	NumOps       int `yaml:"numops"`
+	Mix          struct {
+		Write  int `yaml:"write"`
+		Read   int `yaml:"read"`
+		Delete int `yaml:"delete"`
+	} `yaml:"mix"`
+}
+
+// Operations of the contention simulation, indexes of the mix weights
+const (
+	contentionOpWrite = iota
+	contentionOpRead
+	contentionOpDelete
+)
+
+// contentionState records the versions written to each path, a read being
+// consistent only when it returns one of them in full
+type contentionState struct {
+	mu       sync.Mutex
+	versions []map[string]bool
+	next     uint64
+}
+
+// newVersion returns the content of a new version of the path and records its digest
+func (cs *contentionState) newVersion(path int, size int64) []byte {
+	version := atomic.AddUint64(&cs.next, 1)
+	if size < 8 {
+		size = 8
+	}
+	data := generator.RandomBytes(generator.NewRand(int64(version), path), size)
+	// The version heads the content, for the inconsistent reads to tell which one they got
+	binary.BigEndian.PutUint64(data, version)
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.versions[path][generator.Digest(data)] = true
+	return data
+}
+
+func (cs *contentionState) isWritten(path int, data []byte) bool {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	return cs.versions[path][generator.Digest(data)]
+}
+
+// contentionPath returns the repo path of the n-th contended path
+func contentionPath(cfg ContentionCfg, n int) string {
+	return fmt.Sprintf("%s/contended/file-%d.bin", cfg.RepoKey, n)
+}
+
+// SimContention exposes locking and consistency bugs, in HA clusters notably,
+// by overwriting, downloading and deleting the same few paths from many
+// workers: every read must return in full one of the versions written
+func (s *Simulator) SimContention(cfg ContentionCfg) error {
+	if cfg.RepoKey == "" {
+		cfg.RepoKey = DefaultContentionRepoKey
+	}
+	if cfg.NumPaths < 1 {
+		cfg.NumPaths = 10
+	}
+	if cfg.FileSize <= 0 {
+		cfg.FileSize = 64 * 1024
+	}
+	if cfg.NumWorkers < 1 {
+		cfg.NumWorkers = 1
+	}
+	if cfg.DurationSecs <= 0 && cfg.NumOps <= 0 {
+		err := fmt.Errorf("durationsecs or numops must be set")
+		jflog.Error(fmt.Sprintf("contention: %v", err))
+		return err
+	}
+	weights := []int{cfg.Mix.Write, cfg.Mix.Read, cfg.Mix.Delete}
+	totalWeight := sumInts(weights)
+	if totalWeight == 0 {
+		weights, totalWeight = []int{4, 5, 1}, 10
+	}
+
+	return s.runOnTargets("contention", cfg.TargetCfg, func(ds *DutSet) error {
+		for _, d := range ds.Duts {
+			if err := createLocalRepo(d, cfg.RepoKey, "generic"); err != nil {
+				return err
+			}
+		}
+		state := &contentionState{versions: make([]map[string]bool, cfg.NumPaths)}
+		for i := range state.versions {
+			state.versions[i] = map[string]bool{}
+		}
+
+		var inconsistent uint64
+		ticks := rateTicks(cfg.RatePerSec, cfg.DurationSecs, cfg.NumOps)
+		var workerg sync.WaitGroup
+		workerg.Add(cfg.NumWorkers)
+		for i := 0; i < cfg.NumWorkers; i++ {
+			go func(wnum int) {
+				defer workerg.Done()
+				rng := rand.New(rand.NewSource(time.Now().UnixNano() + int64(wnum)))
+				for range ticks {
+					d := ds.Next()
+					path := rng.Intn(cfg.NumPaths)
+					switch pickWeighted(rng, weights, totalWeight) {
+					case contentionOpWrite:
+						contentionWrite(cfg, d, state, path)
+					case contentionOpRead:
+						if !contentionRead(cfg, d, state, path) {
+							atomic.AddUint64(&inconsistent, 1)
+						}
+					case contentionOpDelete:
+						contentionDelete(cfg, d, path)
+					}
+				}
+			}(i)
+		}
+		workerg.Wait()
+
+		// Once quiet, every DUT of the set must serve the same version of each path
+		diverged := 0
+		for path := 0; path < cfg.NumPaths; path++ {
+			if !contentionConverged(cfg, ds, state, path) {
+				diverged++
+			}
+		}
+		jflog.Info(fmt.Sprintf("All contention workers completed on DUT(s) %s", ds.Names()))
+		if inconsistent > 0 || diverged > 0 {
+			err := fmt.Errorf("%d inconsistent reads, %d paths diverged", inconsistent, diverged)
+			jflog.Error(fmt.Sprintf("Contention on DUT(s) %s : %v", ds.Names(), err))
+			return err
+		}
+		return nil
+	})
+}
+
+// contentionWrite overwrites the path with a new version
+func contentionWrite(cfg ContentionCfg, d *Dut, state *contentionState, path int) {
+	rec := stats.NewRecorder("contention", d.Name)
+	data := state.newVersion(path, cfg.FileSize)
+	start := time.Now()
+	err := remoteartifacts.UploadArtifact(d.RtDetail, contentionPath(cfg, path), data)
+	rec.RecordBytes("write", start, int64(len(data)), err)
+	if err != nil {
+		jflog.Error(fmt.Sprintf("Failed to write %s in DUT %s : %v", contentionPath(cfg, path), d.Name, err))
+	}
+}
+
+// contentionRead downloads the path and checks it is a version written in
+// full, returning false otherwise. A missing path is consistent, as it may
+// not be written yet or deleted.
+func contentionRead(cfg ContentionCfg, d *Dut, state *contentionState, path int) bool {
+	rec := stats.NewRecorder("contention", d.Name)
+	start := time.Now()
+	data, err := remoteartifacts.ReadUrl(d.RtDetail, (*d.RtDetail).GetUrl()+contentionPath(cfg, path), nil)
+	if remoteartifacts.IsNotFound(err) {
+		rec.Record("read-missing", start, nil)
+		return true
+	}
+	consistent := true
+	if err == nil && !state.isWritten(path, data) {
+		consistent = false
+		version := uint64(0)
+		if len(data) >= 8 {
+			version = binary.BigEndian.Uint64(data)
+		}
+		err = fmt.Errorf("inconsistent read of %d bytes, heading version %d, not a version written in full", len(data), version)
+	}
+	rec.RecordBytes("read", start, int64(len(data)), err)
+	if err != nil {
+		jflog.Error(fmt.Sprintf("Failed to read %s in DUT %s : %v", contentionPath(cfg, path), d.Name, err))
+	}
+	return consistent
+}
+
+// contentionDelete deletes the path, which may already be deleted
+func contentionDelete(cfg ContentionCfg, d *Dut, path int) {
+	rec := stats.NewRecorder("contention", d.Name)
+	start := time.Now()
+	err := remoteartifacts.DeleteItem(d.RtDetail, contentionPath(cfg, path))
+	if remoteartifacts.IsNotFound(err) {
+		err = nil
+	}
+	rec.Record("delete", start, err)
+	if err != nil {
+		jflog.Error(fmt.Sprintf("Failed to delete %s in DUT %s : %v", contentionPath(cfg, path), d.Name, err))
+	}
+}
+
+// contentionConverged checks that every DUT of the set serves the same
+// version of the path, or none
+func contentionConverged(cfg ContentionCfg, ds *DutSet, state *contentionState, path int) bool {
+	served := map[string][]string{}
+	for _, d := range ds.Duts {
+		rec := stats.NewRecorder("contention", d.Name)
+		start := time.Now()
+		data, err := remoteartifacts.ReadUrl(d.RtDetail, (*d.RtDetail).GetUrl()+contentionPath(cfg, path), nil)
+		digest := "missing"
+		if err == nil {
+			digest = generator.Digest(data)
+			if !state.isWritten(path, data) {
+				err = fmt.Errorf("final version of %d bytes was never written", len(data))
+			}
+		} else if remoteartifacts.IsNotFound(err) {
+			err = nil
+		}
+		rec.RecordBytes("final-read", start, int64(len(data)), err)
+		if err != nil {
+			jflog.Error(fmt.Sprintf("Failed final read of %s in DUT %s : %v", contentionPath(cfg, path), d.Name, err))
+			return false
+		}
+		served[digest] = append(served[digest], d.Name)
+	}
+	if len(served) > 1 {
+		jflog.Error(fmt.Sprintf("DUTs serve different versions of %s : %v", contentionPath(cfg, path), served))
+		return false
+	}
+	return true
+}
@@ -0,0 +1,181 @@
+package simulator
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	jflog "github.com/jfrog/jfrog-client-go/utils/log"
+	"jfrog.com/datasim/generator"
+	"jfrog.com/datasim/remoteartifacts"
+	"jfrog.com/datasim/stats"
+)
+
+// DefaultDedupRepoPrefix prefixes the repos of the deduplication simulation
+const DefaultDedupRepoPrefix = "datasim-dedup"
+
+// DedupCfg configures the checksum-based deduplication simulation
+type DedupCfg struct {
+	TargetCfg  `yaml:",inline"`
+	Enabled    bool   `yaml:"enabled"`
+	RepoPrefix string `yaml:"repoprefix"`
+	NumRepos   int    `yaml:"numrepos"`
+	// NumFiles files are deployed across the repos, DuplicatePercent of them
+	// with the content of a file deployed before
+	NumFiles         int                `yaml:"numfiles"`
+	DuplicatePercent int                `yaml:"duplicatepercent"`
+	SizeDist         generator.SizeDist `yaml:"sizedist"`
+	NumWorkers       int                `yaml:"numworkers"`
+	// The storage summary is recalculated, then read after CalculateWaitSecs
+	CalculateWaitSecs int `yaml:"calculatewaitsecs"`
+}
+
+// getStorageTotals recalculates the storage summary of the DUT, waits for the
+// calculation and returns its binaries totals
+func getStorageTotals(d *Dut, rec *stats.Recorder, waitSecs int) (*remoteartifacts.BinariesSummary, error) {
+	start := time.Now()
+	err := remoteartifacts.CalculateStorageInfo(d.RtDetail)
+	rec.Record("storageinfo-calculate", start, err)
+	if err != nil {
+		return nil, err
+	}
+	time.Sleep(time.Duration(waitSecs) * time.Second)
+	start = time.Now()
+	summary, err := remoteartifacts.GetStorageSummary(d.RtDetail)
+	rec.Record("storageinfo", start, err)
+	if err != nil {
+		return nil, err
+	}
+	return &summary.Binaries, nil
+}
+
+// SimDedup measures the checksum-based deduplication of the DUT filestore: it
+// deploys a controlled ratio of duplicate and unique contents across repos,
+// then compares the growth of the storage summary with the expected one
+func (s *Simulator) SimDedup(cfg DedupCfg) error {
+	if cfg.RepoPrefix == "" {
+		cfg.RepoPrefix = DefaultDedupRepoPrefix
+	}
+	if cfg.NumRepos < 1 {
+		cfg.NumRepos = 1
+	}
+	if cfg.DuplicatePercent < 0 || cfg.DuplicatePercent > 100 {
+		err := fmt.Errorf("duplicatepercent must be between 0 and 100")
+		jflog.Error(fmt.Sprintf("dedup: %v", err))
+		return err
+	}
+	if err := cfg.SizeDist.Validate(); err != nil {
+		jflog.Error(fmt.Sprintf("dedup: %v", err))
+		return err
+	}
+	if cfg.NumWorkers < 1 {
+		cfg.NumWorkers = 1
+	}
+	if cfg.CalculateWaitSecs <= 0 {
+		cfg.CalculateWaitSecs = 30
+	}
+
+	// The experiment runs once per set, whose DUTs are nodes sharing one
+	// filestore: the deploys are spread over the nodes, and the storage
+	// summary read from the first one
+	return s.runOnTargets("dedup", cfg.TargetCfg, func(ds *DutSet) error {
+		d := ds.Duts[0]
+		rec := stats.NewRecorder("dedup", d.Name)
+		repos := []string{}
+		for n := 1; n <= cfg.NumRepos; n++ {
+			repo := UploadRepoKey(cfg.RepoPrefix, n)
+			if err := createLocalRepo(d, repo, "generic"); err != nil {
+				return err
+			}
+			repos = append(repos, repo)
+		}
+		before, err := getStorageTotals(d, rec, cfg.CalculateWaitSecs)
+		if err != nil {
+			jflog.Error(fmt.Sprintf("Failed to get the storage summary of DUT %s : %v", d.Name, err))
+			return err
+		}
+
+		// The contents are seeded by the run, to be unique across runs too. The
+		// i-th file duplicates one of the unique contents deployed before it.
+		runID := time.Now().UnixNano()
+		rng := rand.New(rand.NewSource(runID))
+		contents := make([]int, cfg.NumFiles)
+		unique := []int{}
+		for i := range contents {
+			if len(unique) > 0 && rng.Intn(100) < cfg.DuplicatePercent {
+				contents[i] = unique[rng.Intn(len(unique))]
+			} else {
+				contents[i] = i
+				unique = append(unique, i)
+			}
+		}
+		sizes := make([]int64, cfg.NumFiles)
+		var deployedSize, uniqueSize int64
+		for i := range contents {
+			sizes[i] = cfg.SizeDist.Sample(generator.NewRand(runID, -1-contents[i]))
+			deployedSize += sizes[i]
+			if contents[i] == i {
+				uniqueSize += sizes[i]
+			}
+		}
+
+		// The unique contents are deployed first, for their duplicates to find them
+		var mu sync.Mutex
+		failed := 0
+		for _, duplicates := range []bool{false, true} {
+			runParallel(cfg.NumWorkers, cfg.NumFiles, func(i int) {
+				if (contents[i] != i) != duplicates {
+					return
+				}
+				op := "deploy-unique"
+				if duplicates {
+					op = "deploy-duplicate"
+				}
+				data := generator.RandomBytes(generator.NewRand(runID, contents[i]), sizes[i])
+				repoPath := fmt.Sprintf("%s/dedup-%d/file-%d.bin", repos[i%len(repos)], runID, i)
+				dd := ds.Next()
+				start := time.Now()
+				err := remoteartifacts.UploadArtifact(dd.RtDetail, repoPath, data)
+				stats.NewRecorder("dedup", dd.Name).RecordBytes(op, start, int64(len(data)), err)
+				if err != nil {
+					jflog.Error(fmt.Sprintf("Failed to deploy %s to DUT %s : %v", repoPath, dd.Name, err))
+					mu.Lock()
+					failed++
+					mu.Unlock()
+				}
+			})
+		}
+
+		after, err := getStorageTotals(d, rec, cfg.CalculateWaitSecs)
+		if err != nil {
+			jflog.Error(fmt.Sprintf("Failed to get the storage summary of DUT %s : %v", d.Name, err))
+			return err
+		}
+		expectedRatio, actualRatio := 0.0, 0.0
+		if deployedSize > 0 {
+			expectedRatio = 100 * float64(deployedSize-uniqueSize) / float64(deployedSize)
+		}
+		addedArtifacts, addedBinaries := after.ArtifactsSize-before.ArtifactsSize, after.Size-before.Size
+		if addedArtifacts > 0 {
+			actualRatio = 100 * float64(addedArtifacts-addedBinaries) / float64(addedArtifacts)
+		}
+		jflog.Info(fmt.Sprintf("Dedup in DUT %s : deployed %d files of %d bytes, %d unique of %d bytes, %d failed",
+			d.Name, cfg.NumFiles, deployedSize, len(unique), uniqueSize, failed))
+		jflog.Info(fmt.Sprintf("Dedup in DUT %s : binaries grew by %d (expected %d) and %d bytes (expected %d), artifacts by %d bytes (expected %d)",
+			d.Name, after.Count-before.Count, len(unique), addedBinaries, uniqueSize, addedArtifacts, deployedSize))
+		jflog.Info(fmt.Sprintf("Dedup in DUT %s : saved %.1f%% of the deployed size (expected %.1f%%), global optimization %.1f%% -> %.1f%%",
+			d.Name, actualRatio, expectedRatio, before.Optimization, after.Optimization))
+		// Each size is rounded to its reported unit, so their growth is off by up
+		// to the resolution
+		resolution := before.SizeResolution
+		if after.SizeResolution > resolution {
+			resolution = after.SizeResolution
+		}
+		if uniqueSize < 10*resolution {
+			jflog.Warn(fmt.Sprintf("Dedup in DUT %s : the expected growth of %d bytes is not well above the %d bytes resolution of the storage summary sizes, the measured sizes and ratio are unreliable; deploy more or larger files",
+				d.Name, uniqueSize, resolution))
+		}
+		return nil
+	})
+}
@@ -0,0 +1,221 @@
+package simulator
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	jflog "github.com/jfrog/jfrog-client-go/utils/log"
+	"jfrog.com/datasim/generator"
+	"jfrog.com/datasim/remoteartifacts"
+	"jfrog.com/datasim/stats"
+)
+
+// DefaultDockerRepoKey is the docker repo of the docker simulation
+const DefaultDockerRepoKey = "datasim-docker"
+
+// DockerCfg configures the docker registry simulation
+type DockerCfg struct {
+	TargetCfg `yaml:",inline"`
+	Enabled   bool   `yaml:"enabled"`
+	RepoKey   string `yaml:"repokey"`
+	// The catalog holds NumImages images of NumTags tags each, pushed first
+	NumImages int                `yaml:"numimages"`
+	NumTags   int                `yaml:"numtags"`
+	Seed      int64              `yaml:"seed"`
+	LayerSize generator.SizeDist `yaml:"layersize"`
+	// Blobs are uploaded in chunks of ChunkSize bytes, at once when 0
+	ChunkSize  int     `yaml:"chunksize"`
+	NumWorkers int     `yaml:"numworkers"`
+	RatePerSec float64 `yaml:"ratepersec"`
+	// The pulls stop after DurationSecs or NumPulls, whichever comes first
+	DurationSecs int `yaml:"durationsecs"`
+	NumPulls     int `yaml:"numpulls"`
+	// RangePercent of the blobs are pulled in two ranged requests, as a resumed pull
+	RangePercent int `yaml:"rangepercent"`
+}
+
+// dockerImageRef is an image tag of the catalog
+type dockerImageRef struct {
+	name string
+	tag  string
+}
+
+// dockerImageName returns the name of the n-th image of the catalog
+func dockerImageName(n int) string {
+	return fmt.Sprintf("datasim/image-%d", n)
+}
+
+// SimDocker simulates docker clients by speaking the Docker Registry v2
+// protocol to a docker repo of the DUT: it pushes a catalog of generated
+// images, then pulls them at the configured rate, each pull resolving the
+// manifest with a HEAD and a GET before downloading the config and layer blobs
+func (s *Simulator) SimDocker(cfg DockerCfg) error {
+	if cfg.RepoKey == "" {
+		cfg.RepoKey = DefaultDockerRepoKey
+	}
+	if cfg.NumImages < 1 {
+		cfg.NumImages = 1
+	}
+	if cfg.NumTags < 1 {
+		cfg.NumTags = 1
+	}
+	if cfg.NumWorkers < 1 {
+		cfg.NumWorkers = 1
+	}
+	if err := cfg.LayerSize.Validate(); err != nil {
+		jflog.Error(fmt.Sprintf("docker: %v", err))
+		return err
+	}
+
+	return s.runOnTargets("docker", cfg.TargetCfg, func(ds *DutSet) error {
+		registries := map[*Dut]*remoteartifacts.DockerRegistry{}
+		for _, d := range ds.Duts {
+			if err := createLocalRepo(d, cfg.RepoKey, "docker"); err != nil {
+				return err
+			}
+			registries[d] = remoteartifacts.NewDockerRegistry(d.RtDetail, cfg.RepoKey)
+			if err := registries[d].Ping(); err != nil {
+				jflog.Error(fmt.Sprintf("Failed to reach the registry of repo %s in DUT %s : %v", cfg.RepoKey, d.Name, err))
+				return err
+			}
+		}
+
+		// Push the catalog, every image tag to every DUT of the set
+		catalog := []dockerImageRef{}
+		pushJobs := make(chan int)
+		var workerg sync.WaitGroup
+		workerg.Add(cfg.NumWorkers)
+		for i := 0; i < cfg.NumWorkers; i++ {
+			go func() {
+				defer workerg.Done()
+				for seq := range pushJobs {
+					for _, d := range ds.Duts {
+						dockerPush(cfg, d, registries[d], seq)
+					}
+				}
+			}()
+		}
+		for n := 0; n < cfg.NumImages; n++ {
+			for t := 0; t < cfg.NumTags; t++ {
+				pushJobs <- n*cfg.NumTags + t
+				catalog = append(catalog, dockerImageRef{dockerImageName(n), fmt.Sprintf("1.0.%d", t)})
+			}
+		}
+		close(pushJobs)
+		workerg.Wait()
+		jflog.Info(fmt.Sprintf("Pushed %d image tags to DUT(s) %s", len(catalog), ds.Names()))
+
+		if cfg.DurationSecs <= 0 && cfg.NumPulls <= 0 {
+			return nil
+		}
+		ticks := rateTicks(cfg.RatePerSec, cfg.DurationSecs, cfg.NumPulls)
+		workerg.Add(cfg.NumWorkers)
+		for i := 0; i < cfg.NumWorkers; i++ {
+			go func(wnum int) {
+				defer workerg.Done()
+				rng := rand.New(rand.NewSource(time.Now().UnixNano() + int64(wnum)))
+				for range ticks {
+					d := ds.Next()
+					dockerPull(cfg, d, registries[d], rng, catalog[rng.Intn(len(catalog))])
+				}
+			}(i)
+		}
+		workerg.Wait()
+		jflog.Info(fmt.Sprintf("All docker workers completed on DUT(s) %s", ds.Names()))
+		return nil
+	})
+}
+
+// dockerPush pushes the seq-th image tag of the catalog like the docker
+// client does, uploading the blobs missing in the registry before the manifest
+func dockerPush(cfg DockerCfg, d *Dut, reg *remoteartifacts.DockerRegistry, seq int) {
+	rec := stats.NewRecorder("docker", d.Name)
+	rng := generator.NewRand(cfg.Seed, seq)
+	img, err := generator.NewImage(rng, seq, generator.RandomBytes(rng, cfg.LayerSize.Sample(rng)))
+	if err != nil {
+		jflog.Error(fmt.Sprintf("Failed to generate docker image : %v", err))
+		return
+	}
+	img.Name, img.Tag = dockerImageName(seq/cfg.NumTags), fmt.Sprintf("1.0.%d", seq%cfg.NumTags)
+
+	for _, blob := range append([][]byte{img.Config}, img.Layers...) {
+		digest := generator.Digest(blob)
+		start := time.Now()
+		exists, err := reg.BlobExists(img.Name, digest)
+		rec.Record("blob-head", start, err)
+		if err != nil {
+			jflog.Error(fmt.Sprintf("Failed to check blob %s of %s in DUT %s : %v", digest, img.Name, d.Name, err))
+			return
+		}
+		if exists {
+			continue
+		}
+		start = time.Now()
+		err = reg.UploadBlob(img.Name, digest, blob, cfg.ChunkSize)
+		rec.RecordBytes("blob-upload", start, int64(len(blob)), err)
+		if err != nil {
+			jflog.Error(fmt.Sprintf("Failed to upload blob %s of %s in DUT %s : %v", digest, img.Name, d.Name, err))
+			return
+		}
+	}
+	start := time.Now()
+	err = reg.PutManifest(img.Name, img.Tag, generator.MediaTypeManifest, img.Manifest)
+	rec.RecordBytes("manifest-put", start, int64(len(img.Manifest)), err)
+	if err != nil {
+		jflog.Error(fmt.Sprintf("Failed to push manifest of %s:%s in DUT %s : %v", img.Name, img.Tag, d.Name, err))
+	}
+}
+
+// dockerPull pulls the image tag like the docker client does
+func dockerPull(cfg DockerCfg, d *Dut, reg *remoteartifacts.DockerRegistry, rng *rand.Rand, ref dockerImageRef) {
+	rec := stats.NewRecorder("docker", d.Name)
+	start := time.Now()
+	digest, err := reg.HeadManifest(ref.name, ref.tag, generator.MediaTypeManifest)
+	rec.Record("manifest-head", start, err)
+	if err != nil {
+		jflog.Error(fmt.Sprintf("Failed to resolve %s:%s in DUT %s : %v", ref.name, ref.tag, d.Name, err))
+		return
+	}
+	if digest == "" {
+		digest = ref.tag
+	}
+	start = time.Now()
+	body, err := reg.GetManifest(ref.name, digest, generator.MediaTypeManifest)
+	rec.RecordBytes("manifest-get", start, int64(len(body)), err)
+	if err != nil {
+		jflog.Error(fmt.Sprintf("Failed to get manifest of %s@%s in DUT %s : %v", ref.name, digest, d.Name, err))
+		return
+	}
+	manifest := generator.Manifest{}
+	if err := json.Unmarshal(body, &manifest); err != nil {
+		jflog.Error(fmt.Sprintf("Invalid manifest of %s@%s in DUT %s : %v", ref.name, digest, d.Name, err))
+		return
+	}
+
+	for _, blob := range append([]generator.Descriptor{manifest.Config}, manifest.Layers...) {
+		op := "blob-get"
+		var n int64
+		start := time.Now()
+		if blob.Size > 1 && rng.Intn(100) < cfg.RangePercent {
+			// A pull interrupted half way and resumed
+			op = "blob-range-get"
+			half := int64(blob.Size / 2)
+			n, err = reg.GetBlob(ref.name, blob.Digest, 0, half-1)
+			if err == nil {
+				var rest int64
+				rest, err = reg.GetBlob(ref.name, blob.Digest, half, int64(blob.Size)-1)
+				n += rest
+			}
+		} else {
+			n, err = reg.GetBlob(ref.name, blob.Digest, 0, -1)
+		}
+		rec.RecordBytes(op, start, n, err)
+		if err != nil {
+			jflog.Error(fmt.Sprintf("Failed to get blob %s of %s in DUT %s : %v", blob.Digest, ref.name, d.Name, err))
+			return
+		}
+	}
+}
@@ -0,0 +1,311 @@
+package simulator
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"sync"
+	"time"
+
+	jflog "github.com/jfrog/jfrog-client-go/utils/log"
+	"jfrog.com/datasim/generator"
+	"jfrog.com/datasim/remoteartifacts"
+	"jfrog.com/datasim/stats"
+)
+
+// Methods of uploading the large files
+const (
+	// LargeFileUploadStream streams the file with its content length
+	LargeFileUploadStream = "stream"
+	// LargeFileUploadChunked streams the file with the chunked transfer encoding
+	LargeFileUploadChunked = "chunked"
+	// LargeFileUploadMultipart uploads the file in parts with the multipart
+	// upload API of Artifactory
+	LargeFileUploadMultipart = "multipart"
+)
+
+// Defaults of the multipart upload
+const (
+	DefaultLargeFilePartSizeMB  = 100
+	DefaultLargeFilePartWorkers = 4
+)
+
+// DefaultLargeFileRepoKey is the repo of the large file simulation
+const DefaultLargeFileRepoKey = "datasim-largefile"
+
+// LargeFileCfg configures the large file simulation
+type LargeFileCfg struct {
+	TargetCfg `yaml:",inline"`
+	Enabled   bool               `yaml:"enabled"`
+	RepoKey   string             `yaml:"repokey"`
+	NumFiles  int                `yaml:"numfiles"`
+	Seed      int64              `yaml:"seed"`
+	SizeDist  generator.SizeDist `yaml:"sizedist"`
+	// NumWorkers files are handled concurrently
+	NumWorkers   int    `yaml:"numworkers"`
+	UploadMethod string `yaml:"uploadmethod"`
+	// The multipart upload sends parts of PartSizeMB MiB, PartWorkers at once
+	PartSizeMB  int `yaml:"partsizemb"`
+	PartWorkers int `yaml:"partworkers"`
+	// Each file is deployed ChecksumCopies more times by checksum, without its content
+	ChecksumCopies int `yaml:"checksumcopies"`
+	// Each file is downloaded DownloadsPerFile times, in RangeParts concurrent
+	// ranged requests when more than 1, or at once verifying its checksum
+	DownloadsPerFile int `yaml:"downloadsperfile"`
+	RangeParts       int `yaml:"rangeparts"`
+}
+
+// largeFile is a generated file, read from its seed as many times as needed
+type largeFile struct {
+	path   string
+	seq    int
+	size   int64
+	sha1   string
+	sha256 string
+	md5    string
+	// The sha256 of each range of the ranged downloads
+	rangeSha256 []string
+}
+
+// largeFileRanges returns the first and last offsets of the parts of a ranged
+// download of size bytes, nil when it is downloaded at once
+func largeFileRanges(size int64, parts int) [][2]int64 {
+	if parts <= 1 || size < int64(parts) {
+		return nil
+	}
+	partSize := size / int64(parts)
+	ranges := make([][2]int64, parts)
+	for p := range ranges {
+		ranges[p] = [2]int64{int64(p) * partSize, int64(p+1)*partSize - 1}
+	}
+	ranges[parts-1][1] = size - 1
+	return ranges
+}
+
+// rangeHasher hashes each range of the content written to it separately
+type rangeHasher struct {
+	ranges  [][2]int64
+	hashes  []hash.Hash
+	written int64
+}
+
+func newRangeHasher(ranges [][2]int64) *rangeHasher {
+	rh := &rangeHasher{ranges: ranges}
+	for range ranges {
+		rh.hashes = append(rh.hashes, sha256.New())
+	}
+	return rh
+}
+
+func (rh *rangeHasher) Write(b []byte) (int, error) {
+	n := len(b)
+	for p, r := range rh.ranges {
+		if len(b) == 0 {
+			break
+		}
+		if rh.written > r[1] {
+			continue
+		}
+		chunk := b
+		if left := r[1] - rh.written + 1; int64(len(chunk)) > left {
+			chunk = chunk[:left]
+		}
+		rh.hashes[p].Write(chunk)
+		rh.written += int64(len(chunk))
+		b = b[len(chunk):]
+	}
+	return n, nil
+}
+
+// sums returns the hex sha256 of each range
+func (rh *rangeHasher) sums() []string {
+	sums := []string{}
+	for _, h := range rh.hashes {
+		sums = append(sums, hex.EncodeToString(h.Sum(nil)))
+	}
+	return sums
+}
+
+// reader returns a new reader of the content of the file
+func (lf *largeFile) reader(cfg LargeFileCfg) io.Reader {
+	return io.LimitReader(generator.NewRand(cfg.Seed, lf.seq), lf.size)
+}
+
+// newLargeFile generates the seq-th file and computes its checksums
+func newLargeFile(cfg LargeFileCfg, seq int) (*largeFile, error) {
+	lf := &largeFile{
+		path: fmt.Sprintf("%s/large/file-%d.bin", cfg.RepoKey, seq),
+		seq:  seq,
+		size: cfg.SizeDist.Sample(generator.NewRand(cfg.Seed, -1-seq)),
+	}
+	h1, h256, hmd5 := sha1.New(), sha256.New(), md5.New()
+	rh := newRangeHasher(largeFileRanges(lf.size, cfg.RangeParts))
+	if _, err := io.Copy(io.MultiWriter(h1, h256, hmd5, rh), lf.reader(cfg)); err != nil {
+		return nil, err
+	}
+	lf.sha1, lf.sha256, lf.md5 = hex.EncodeToString(h1.Sum(nil)), hex.EncodeToString(h256.Sum(nil)), hex.EncodeToString(hmd5.Sum(nil))
+	lf.rangeSha256 = rh.sums()
+	return lf, nil
+}
+
+// SimLargeFile simulates very large artifacts, like ML models or game assets:
+// generated files of the configured sizes are streamed to the DUT, with their
+// content length, chunked or in parts, deployed again by checksum, and
+// downloaded at once or in concurrent ranged requests. The files are never held
+// in memory.
+func (s *Simulator) SimLargeFile(cfg LargeFileCfg) error {
+	if cfg.RepoKey == "" {
+		cfg.RepoKey = DefaultLargeFileRepoKey
+	}
+	if cfg.UploadMethod == "" {
+		cfg.UploadMethod = LargeFileUploadStream
+	}
+	if cfg.UploadMethod != LargeFileUploadStream && cfg.UploadMethod != LargeFileUploadChunked &&
+		cfg.UploadMethod != LargeFileUploadMultipart {
+		err := fmt.Errorf("unsupported upload method %s", cfg.UploadMethod)
+		jflog.Error(fmt.Sprintf("largefile: %v", err))
+		return err
+	}
+	if err := cfg.SizeDist.Validate(); err != nil {
+		jflog.Error(fmt.Sprintf("largefile: %v", err))
+		return err
+	}
+	if cfg.NumWorkers < 1 {
+		cfg.NumWorkers = 1
+	}
+	if cfg.RangeParts < 1 {
+		cfg.RangeParts = 1
+	}
+	if cfg.PartSizeMB < 1 {
+		cfg.PartSizeMB = DefaultLargeFilePartSizeMB
+	}
+	if cfg.PartWorkers < 1 {
+		cfg.PartWorkers = DefaultLargeFilePartWorkers
+	}
+
+	return s.runOnTargets("largefile", cfg.TargetCfg, func(ds *DutSet) error {
+		for _, d := range ds.Duts {
+			if err := createLocalRepo(d, cfg.RepoKey, "generic"); err != nil {
+				return err
+			}
+		}
+		runParallel(cfg.NumWorkers, cfg.NumFiles, func(i int) {
+			d := ds.Next()
+			lf, err := newLargeFile(cfg, i)
+			if err != nil {
+				jflog.Error(fmt.Sprintf("Failed to generate large file %d : %v", i, err))
+				return
+			}
+			if err := largeFileUpload(cfg, d, lf); err != nil {
+				return
+			}
+			for c := 0; c < cfg.ChecksumCopies; c++ {
+				largeFileChecksumDeploy(cfg, d, lf, c)
+			}
+			for n := 0; n < cfg.DownloadsPerFile; n++ {
+				largeFileDownload(cfg, ds.Next(), lf)
+			}
+		})
+		jflog.Info(fmt.Sprintf("All largefile workers completed on DUT(s) %s", ds.Names()))
+		return nil
+	})
+}
+
+// largeFileUpload streams the file to the DUT with its checksums, or uploads
+// it in parts
+func largeFileUpload(cfg LargeFileCfg, d *Dut, lf *largeFile) error {
+	rec := stats.NewRecorder("largefile", d.Name)
+	if cfg.UploadMethod == LargeFileUploadMultipart {
+		start := time.Now()
+		err := remoteartifacts.MultipartUpload(d.RtDetail, lf.path, lf.reader(cfg), cfg.PartSizeMB, cfg.PartWorkers, lf.sha1)
+		rec.RecordBytes("upload-"+cfg.UploadMethod, start, lf.size, err)
+		if err != nil {
+			jflog.Error(fmt.Sprintf("Failed multipart upload of %s of %d bytes to DUT %s : %v", lf.path, lf.size, d.Name, err))
+		}
+		return err
+	}
+	size := lf.size
+	if cfg.UploadMethod == LargeFileUploadChunked {
+		size = -1
+	}
+	headers := map[string]string{
+		"X-Checksum-Sha1":   lf.sha1,
+		"X-Checksum-Sha256": lf.sha256,
+		"X-Checksum-Md5":    lf.md5,
+	}
+	start := time.Now()
+	err := remoteartifacts.UploadStream(d.RtDetail, lf.path, func() io.Reader { return lf.reader(cfg) }, size, headers)
+	rec.RecordBytes("upload-"+cfg.UploadMethod, start, lf.size, err)
+	if err != nil {
+		jflog.Error(fmt.Sprintf("Failed to upload %s of %d bytes to DUT %s : %v", lf.path, lf.size, d.Name, err))
+	}
+	return err
+}
+
+// largeFileChecksumDeploy deploys the c-th copy of the file by checksum
+func largeFileChecksumDeploy(cfg LargeFileCfg, d *Dut, lf *largeFile, c int) {
+	rec := stats.NewRecorder("largefile", d.Name)
+	repoPath := fmt.Sprintf("%s/copies/file-%d-%d.bin", cfg.RepoKey, lf.seq, c)
+	start := time.Now()
+	err := remoteartifacts.ChecksumDeploy(d.RtDetail, repoPath, lf.sha1, lf.sha256)
+	rec.Record("checksum-deploy", start, err)
+	if err != nil {
+		jflog.Error(fmt.Sprintf("Failed to deploy %s by checksum to DUT %s : %v", repoPath, d.Name, err))
+	}
+}
+
+// largeFileDownload downloads the file at once, or in concurrent ranged
+// requests, verifying the content. Each range is checked against the hash of
+// that part of the file, computed when generating it: all of them matching
+// means the reassembled content matches, without holding nor serializing the
+// ranges to hash them in order.
+func largeFileDownload(cfg LargeFileCfg, d *Dut, lf *largeFile) {
+	rec := stats.NewRecorder("largefile", d.Name)
+	start := time.Now()
+	ranges := largeFileRanges(lf.size, cfg.RangeParts)
+	if ranges == nil {
+		h := sha256.New()
+		n, err := remoteartifacts.DownloadRange(d.RtDetail, lf.path, 0, -1, h)
+		if err == nil && hex.EncodeToString(h.Sum(nil)) != lf.sha256 {
+			err = fmt.Errorf("downloaded %d bytes with another sha256 than the %d bytes uploaded", n, lf.size)
+		}
+		rec.RecordBytes("download", start, n, err)
+		if err != nil {
+			jflog.Error(fmt.Sprintf("Failed to download %s from DUT %s : %v", lf.path, d.Name, err))
+		}
+		return
+	}
+
+	var total int64
+	var failed error
+	var mu sync.Mutex
+	var partg sync.WaitGroup
+	partg.Add(len(ranges))
+	for p, r := range ranges {
+		go func(p int, from int64, to int64) {
+			defer partg.Done()
+			h := sha256.New()
+			n, err := remoteartifacts.DownloadRange(d.RtDetail, lf.path, from, to, h)
+			if err == nil && n != to-from+1 {
+				err = fmt.Errorf("range %d-%d returned %d bytes", from, to, n)
+			} else if err == nil && hex.EncodeToString(h.Sum(nil)) != lf.rangeSha256[p] {
+				err = fmt.Errorf("range %d-%d returned another content than uploaded", from, to)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			total += n
+			if err != nil {
+				failed = err
+			}
+		}(p, r[0], r[1])
+	}
+	partg.Wait()
+	rec.RecordBytes("ranged-download", start, total, failed)
+	if failed != nil {
+		jflog.Error(fmt.Sprintf("Failed ranged download of %s from DUT %s : %v", lf.path, d.Name, failed))
+	}
+}
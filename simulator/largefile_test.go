@@ -0,0 +1,216 @@
+package simulator
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	jflog "github.com/jfrog/jfrog-client-go/utils/log"
+	"jfrog.com/datasim/generator"
+	"jfrog.com/datasim/httpclient"
+	"jfrog.com/datasim/stats"
+)
+
+func TestLargeFileRanges(t *testing.T) {
+	cfg := LargeFileCfg{RepoKey: "large", Seed: 7, RangeParts: 3, SizeDist: generator.SizeDist{Type: "fixed", Size: 1000}}
+	lf, err := newLargeFile(cfg, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, _ := ioutil.ReadAll(lf.reader(cfg))
+	ranges := largeFileRanges(lf.size, cfg.RangeParts)
+	want := [][2]int64{{0, 332}, {333, 665}, {666, 999}}
+	if len(ranges) != len(want) || len(lf.rangeSha256) != len(want) {
+		t.Fatalf("largeFileRanges() = %v with %d hashes, want %v", ranges, len(lf.rangeSha256), want)
+	}
+	for p, r := range ranges {
+		sum := sha256.Sum256(content[r[0] : r[1]+1])
+		if r != want[p] || lf.rangeSha256[p] != hex.EncodeToString(sum[:]) {
+			t.Errorf("range %d = %v with sha256 %s, want %v", p, r, lf.rangeSha256[p], want[p])
+		}
+	}
+	if got := largeFileRanges(2, 3); got != nil {
+		t.Errorf("largeFileRanges(2, 3) = %v, want nil", got)
+	}
+}
+
+func TestLargeFileDownload(t *testing.T) {
+	jflog.SetLogger(jflog.NewLogger(jflog.ERROR, ioutil.Discard))
+	cfg := LargeFileCfg{RepoKey: "large", Seed: 7, RangeParts: 4, SizeDist: generator.SizeDist{Type: "fixed", Size: 4099}}
+	lf, err := newLargeFile(cfg, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, _ := ioutil.ReadAll(lf.reader(cfg))
+	corrupted := append([]byte{}, content...)
+	corrupted[3000] ^= 0xff
+
+	for _, tt := range []struct {
+		dut     string
+		served  []byte
+		parts   int
+		op      string
+		failing bool
+	}{
+		{"ranged-ok", content, 4, "ranged-download", false},
+		{"ranged-corrupted", corrupted, 4, "ranged-download", true},
+		{"whole-corrupted", corrupted, 1, "download", true},
+	} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(tt.served))
+		}))
+		d := testDut(server.URL + "/artifactory/")
+		d.Name = tt.dut
+		cfg.RangeParts = tt.parts
+		largeFileDownload(cfg, d, lf)
+		server.Close()
+
+		found := false
+		for _, s := range stats.Summary() {
+			if s.Sim == "largefile" && s.Dut == tt.dut && s.Op == tt.op {
+				found = true
+				if s.Count != 1 || (s.Errors > 0) != tt.failing {
+					t.Errorf("%s: %d downloads with %d errors, want failing %v", tt.dut, s.Count, s.Errors, tt.failing)
+				}
+			}
+		}
+		if !found {
+			t.Errorf("%s: no %s recorded", tt.dut, tt.op)
+		}
+	}
+}
+
+func TestLargeFileUploadOutlivesReadTimeout(t *testing.T) {
+	jflog.SetLogger(jflog.NewLogger(jflog.ERROR, ioutil.Discard))
+	cfg := LargeFileCfg{RepoKey: "large", Seed: 7, UploadMethod: LargeFileUploadStream, SizeDist: generator.SizeDist{Type: "fixed", Size: 16 << 20}}
+	lf, err := newLargeFile(cfg, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The server drains the first 12MB of the body at about 6MB/s, so the
+	// 16MB upload lasts longer than the 1s read timeout even with the socket
+	// buffers absorbing its end, then drains the rest at once to reply in time
+	var mu sync.Mutex
+	var received string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := sha256.New()
+		buf := make([]byte, 128<<10)
+		for read := 0; ; {
+			n, err := io.ReadFull(r.Body, buf)
+			h.Write(buf[:n])
+			read += n
+			if err != nil {
+				break
+			}
+			if read < 12<<20 {
+				time.Sleep(20 * time.Millisecond)
+			}
+		}
+		mu.Lock()
+		received = hex.EncodeToString(h.Sum(nil))
+		mu.Unlock()
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+	client, err := httpclient.New(httpclient.Config{ReadTimeoutSecs: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpclient.Register(server.URL+"/artifactory/", client)
+
+	d := testDut(server.URL + "/artifactory/")
+	start := time.Now()
+	if err := largeFileUpload(cfg, d, lf); err != nil {
+		t.Fatalf("upload failed after %v: %v", time.Since(start), err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("upload took %v, not longer than the read timeout", elapsed)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if received != lf.sha256 {
+		t.Errorf("received another sha256 than the %d bytes uploaded", lf.size)
+	}
+}
+
+func TestLargeFileMultipartUpload(t *testing.T) {
+	jflog.SetLogger(jflog.NewLogger(jflog.ERROR, ioutil.Discard))
+	cfg := LargeFileCfg{RepoKey: "large", Seed: 7, UploadMethod: LargeFileUploadMultipart, PartSizeMB: 1, PartWorkers: 3,
+		SizeDist: generator.SizeDist{Type: "fixed", Size: 5<<20 + 123}}
+	lf, err := newLargeFile(cfg, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	parts := map[string][]byte{}
+	var query url.Values
+	var serverURL string
+	completed := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if strings.HasPrefix(r.URL.Path, "/storage/") {
+			if r.Header.Get("Authorization") != "" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			parts[strings.TrimPrefix(r.URL.Path, "/storage/")], _ = ioutil.ReadAll(r.Body)
+			return
+		}
+		if !strings.HasPrefix(r.URL.Path, "/artifactory/api/v1/uploads/") || r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		op := strings.TrimPrefix(r.URL.Path, "/artifactory/api/v1/uploads/")
+		if op != "create" && r.Header.Get("Authorization") != "Bearer upload-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch op {
+		case "create":
+			query = r.URL.Query()
+			w.Write([]byte(`{"token":"upload-token"}`))
+		case "urlPart":
+			fmt.Fprintf(w, `{"url":"%s/storage/%s"}`, serverURL, r.URL.Query().Get("partNumber"))
+		case "complete":
+			var content []byte
+			for p := 1; p <= len(parts); p++ {
+				content = append(content, parts[fmt.Sprint(p)]...)
+			}
+			sum := sha1.Sum(content)
+			completed = hex.EncodeToString(sum[:]) == r.URL.Query().Get("sha1")
+			w.WriteHeader(http.StatusAccepted)
+		case "status":
+			if completed {
+				w.Write([]byte(`{"status":"FINISHED"}`))
+			} else {
+				w.Write([]byte(`{"status":"ABORTED","error":"sha1 mismatch"}`))
+			}
+		}
+	}))
+	defer server.Close()
+	serverURL = server.URL
+
+	d := testDut(server.URL + "/artifactory/")
+	if err := largeFileUpload(cfg, d, lf); err != nil {
+		t.Fatal(err)
+	}
+	if query.Get("repoKey") != "large" || query.Get("repoPath") != "large/file-1.bin" || query.Get("partSizeMB") != "1" {
+		t.Errorf("created the upload with %v", query)
+	}
+	if len(parts) != 6 || len(parts["6"]) != 123 {
+		t.Errorf("uploaded %d parts, the last of %d bytes, want 6 parts, the last of 123 bytes", len(parts), len(parts["6"]))
+	}
+}
@@ -0,0 +1,315 @@
+package simulator
+
+import (
+	"encoding/xml"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// mavenPropertyRe matches the property references of a POM
+var mavenPropertyRe = regexp.MustCompile(`\$\{([^}]+)\}`)
+
+// mavenRangeRe matches each range of a version spec, like [1.0,2.0) or [1.5]
+var mavenRangeRe = regexp.MustCompile(`[\[(][^\])]*[\])]`)
+
+// mavenInRange tells if version is in one of the ranges of spec, like
+// [1.0,2.0) or (,1.0],[1.2,)
+func mavenInRange(spec string, version string) bool {
+	for _, r := range mavenRangeRe.FindAllString(spec, -1) {
+		bounds := strings.Split(r[1:len(r)-1], ",")
+		lower := strings.TrimSpace(bounds[0])
+		if len(bounds) == 1 {
+			if compareVersions(version, lower) == 0 {
+				return true
+			}
+			continue
+		}
+		upper := strings.TrimSpace(bounds[1])
+		if lower != "" {
+			if c := compareVersions(version, lower); c < 0 || (c == 0 && r[0] == '(') {
+				continue
+			}
+		}
+		if upper != "" {
+			if c := compareVersions(version, upper); c > 0 || (c == 0 && r[len(r)-1] == ')') {
+				continue
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// mavenCoord is a maven artifact coordinate
+type mavenCoord struct {
+	GroupId    string `xml:"groupId"`
+	ArtifactId string `xml:"artifactId"`
+	Version    string `xml:"version"`
+}
+
+func (c mavenCoord) String() string {
+	return c.GroupId + ":" + c.ArtifactId + ":" + c.Version
+}
+
+// mavenDependency is a dependency declared in a POM
+type mavenDependency struct {
+	mavenCoord
+	Type     string `xml:"type"`
+	Scope    string `xml:"scope"`
+	Optional string `xml:"optional"`
+}
+
+// mavenPom is the part of a POM a dependency resolution reads
+type mavenPom struct {
+	mavenCoord
+	Packaging  string     `xml:"packaging"`
+	Parent     mavenCoord `xml:"parent"`
+	Properties struct {
+		Entries []struct {
+			XMLName xml.Name
+			Value   string `xml:",chardata"`
+		} `xml:",any"`
+	} `xml:"properties"`
+	DependencyManagement []mavenDependency `xml:"dependencyManagement>dependencies>dependency"`
+	Dependencies         []mavenDependency `xml:"dependencies>dependency"`
+}
+
+// declares tells if the POM declares a dependency on the artifact of dep
+func (p *mavenPom) declares(dep mavenDependency) bool {
+	for _, d := range p.Dependencies {
+		if d.GroupId == dep.GroupId && d.ArtifactId == dep.ArtifactId {
+			return true
+		}
+	}
+	return false
+}
+
+// mavenModel is a POM merged with its parents, with the properties and the
+// managed versions to resolve its dependencies, inherited ones included
+type mavenModel struct {
+	packaging    string
+	properties   map[string]string
+	managed      map[string]string
+	dependencies []mavenDependency
+}
+
+// interpolate replaces the property references of value
+func (m *mavenModel) interpolate(value string) string {
+	for i := 0; i < 5 && strings.Contains(value, "${"); i++ {
+		value = mavenPropertyRe.ReplaceAllStringFunc(value, func(ref string) string {
+			if v, ok := m.properties[ref[2:len(ref)-1]]; ok {
+				return v
+			}
+			return ref
+		})
+	}
+	return value
+}
+
+// mavenUrl returns the URL of the file with extension ext of the coordinate
+func (ni *nativeInstall) mavenUrl(c mavenCoord, ext string) string {
+	return (*ni.d.RtDetail).GetUrl() + ni.repoKey + "/" + strings.Replace(c.GroupId, ".", "/", -1) + "/" +
+		c.ArtifactId + "/" + c.Version + "/" + c.ArtifactId + "-" + c.Version + "." + ext
+}
+
+// mavenFile downloads the file of the coordinate then its checksum, as the
+// maven client verifies each file it downloads
+func (ni *nativeInstall) mavenFile(op string, c mavenCoord, ext string, read bool) ([]byte, error) {
+	var body []byte
+	var err error
+	if read {
+		body, err = ni.read(op, ni.mavenUrl(c, ext), nil)
+	} else {
+		err = ni.fetch(op, ni.mavenUrl(c, ext))
+	}
+	if err != nil {
+		return nil, err
+	}
+	ni.fetch("maven-checksum", ni.mavenUrl(c, ext+".sha1"))
+	return body, nil
+}
+
+// mavenVersion resolves a missing or range version from the maven-metadata.xml
+// of the artifact, as the maven client does: a range resolves to the highest
+// version it contains, a missing version to the release
+func (ni *nativeInstall) mavenVersion(c mavenCoord) (string, error) {
+	metadataURL := (*ni.d.RtDetail).GetUrl() + ni.repoKey + "/" + strings.Replace(c.GroupId, ".", "/", -1) + "/" + c.ArtifactId + "/maven-metadata.xml"
+	body, err := ni.read("maven-metadata", metadataURL, nil)
+	if err != nil {
+		return "", err
+	}
+	metadata := struct {
+		Release  string   `xml:"versioning>release"`
+		Latest   string   `xml:"versioning>latest"`
+		Versions []string `xml:"versioning>versions>version"`
+	}{}
+	if err := xml.Unmarshal(body, &metadata); err != nil {
+		return "", err
+	}
+	if mavenRangeRe.MatchString(c.Version) {
+		best := ""
+		for _, v := range metadata.Versions {
+			if mavenInRange(c.Version, v) && (best == "" || compareVersions(v, best) > 0) {
+				best = v
+			}
+		}
+		if best == "" {
+			return "", fmt.Errorf("no version in %s matches %s", metadataURL, c.Version)
+		}
+		return best, nil
+	}
+	switch {
+	case metadata.Release != "":
+		return metadata.Release, nil
+	case metadata.Latest != "":
+		return metadata.Latest, nil
+	case len(metadata.Versions) > 0:
+		return metadata.Versions[len(metadata.Versions)-1], nil
+	}
+	return "", fmt.Errorf("no version in %s", metadataURL)
+}
+
+// mavenModel fetches the POM of the coordinate and its parents, importing the
+// managed versions of the BOMs, and caches the merged model for the install
+func (ni *nativeInstall) mavenModel(c mavenCoord, models map[string]*mavenModel, depth int) (*mavenModel, error) {
+	if m, ok := models[c.String()]; ok {
+		if m == nil {
+			return nil, fmt.Errorf("POM of %s is not available", c)
+		}
+		return m, nil
+	}
+	models[c.String()] = nil
+	if depth > ni.cfg.MaxDepth {
+		return nil, fmt.Errorf("POM of %s is too deep", c)
+	}
+	body, err := ni.mavenFile("maven-pom", c, "pom", true)
+	if err != nil {
+		return nil, err
+	}
+	pom := &mavenPom{}
+	if err := xml.Unmarshal(body, pom); err != nil {
+		return nil, fmt.Errorf("invalid POM of %s: %v", c, err)
+	}
+
+	m := &mavenModel{packaging: pom.Packaging, properties: map[string]string{}, managed: map[string]string{}}
+	if pom.Parent.ArtifactId != "" {
+		if parent, err := ni.mavenModel(pom.Parent, models, depth+1); err == nil {
+			for k, v := range parent.properties {
+				m.properties[k] = v
+			}
+			for k, v := range parent.managed {
+				m.managed[k] = v
+			}
+			// A dependency declared again by the child overrides the parent's
+			for _, dep := range parent.dependencies {
+				if !pom.declares(dep) {
+					m.dependencies = append(m.dependencies, dep)
+				}
+			}
+		}
+	}
+	m.dependencies = append(m.dependencies, pom.Dependencies...)
+	if pom.GroupId == "" {
+		pom.GroupId = pom.Parent.GroupId
+	}
+	if pom.Version == "" {
+		pom.Version = pom.Parent.Version
+	}
+	if m.packaging == "" {
+		m.packaging = "jar"
+	}
+	for _, e := range pom.Properties.Entries {
+		m.properties[e.XMLName.Local] = strings.TrimSpace(e.Value)
+	}
+	for k, v := range map[string]string{"groupId": pom.GroupId, "artifactId": pom.ArtifactId, "version": pom.Version} {
+		m.properties["project."+k], m.properties["pom."+k] = v, v
+	}
+	m.properties["project.parent.version"] = pom.Parent.Version
+	m.properties["project.parent.groupId"] = pom.Parent.GroupId
+
+	for _, dep := range pom.DependencyManagement {
+		dep.GroupId, dep.ArtifactId, dep.Version = m.interpolate(dep.GroupId), m.interpolate(dep.ArtifactId), m.interpolate(dep.Version)
+		if dep.Scope == "import" {
+			if bom, err := ni.mavenModel(dep.mavenCoord, models, depth+1); err == nil {
+				for k, v := range bom.managed {
+					if _, ok := m.managed[k]; !ok {
+						m.managed[k] = v
+					}
+				}
+			}
+			continue
+		}
+		m.managed[dep.GroupId+":"+dep.ArtifactId] = dep.Version
+	}
+	models[c.String()] = m
+	return m, nil
+}
+
+// installMaven emulates the maven dependency resolution of the artifact, given
+// as <group>:<artifact>:<version>, with an empty local repository: the POMs are
+// walked with their parents, and the compile and runtime dependencies followed
+// transitively, the nearest declaration of an artifact winning
+func (ni *nativeInstall) installMaven(root string) error {
+	parts := strings.Split(root, ":")
+	if len(parts) != 3 {
+		return fmt.Errorf("invalid maven coordinate %s, expecting <group>:<artifact>:<version>", root)
+	}
+	type mavenNode struct {
+		coord mavenCoord
+		depth int
+	}
+	models := map[string]*mavenModel{}
+	queue := []mavenNode{{mavenCoord{parts[0], parts[1], parts[2]}, 0}}
+	var rootManaged map[string]string
+	var rootErr error
+	for len(queue) > 0 && !ni.full() {
+		node := queue[0]
+		queue = queue[1:]
+		ga := node.coord.GroupId + ":" + node.coord.ArtifactId
+		if ni.seen[ga] {
+			continue
+		}
+		ni.seen[ga] = true
+		m, err := ni.mavenModel(node.coord, models, 0)
+		if err != nil {
+			if node.depth == 0 {
+				rootErr = err
+			}
+			continue
+		}
+		if node.depth == 0 {
+			rootManaged = m.managed
+		}
+		if m.packaging != "pom" {
+			if _, err := ni.mavenFile("maven-jar", node.coord, "jar", false); err != nil && node.depth == 0 {
+				rootErr = err
+			}
+		}
+		if node.depth+1 >= ni.cfg.MaxDepth {
+			continue
+		}
+		for _, dep := range m.dependencies {
+			if dep.Scope != "" && dep.Scope != "compile" && dep.Scope != "runtime" {
+				continue
+			}
+			if strings.TrimSpace(dep.Optional) == "true" || (dep.Type != "" && dep.Type != "jar") {
+				continue
+			}
+			c := mavenCoord{m.interpolate(dep.GroupId), m.interpolate(dep.ArtifactId), m.interpolate(dep.Version)}
+			depGa := c.GroupId + ":" + c.ArtifactId
+			if v, ok := rootManaged[depGa]; ok {
+				c.Version = v
+			} else if c.Version == "" {
+				c.Version = m.managed[depGa]
+			}
+			if c.Version == "" || strings.ContainsAny(c.Version, "[]()${}") {
+				if c.Version, err = ni.mavenVersion(c); err != nil {
+					continue
+				}
+			}
+			queue = append(queue, mavenNode{c, node.depth + 1})
+		}
+	}
+	return rootErr
+}
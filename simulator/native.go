@@ -0,0 +1,701 @@
+package simulator
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	jflog "github.com/jfrog/jfrog-client-go/utils/log"
+	"jfrog.com/datasim/remoteartifacts"
+	"jfrog.com/datasim/stats"
+)
+
+// Package manager clients emulated by the native simulation
+const (
+	NativeClientNpm   = "npm"
+	NativeClientMaven = "maven"
+	NativeClientPypi  = "pypi"
+)
+
+// NativeClientCfg is the repo a client resolves from and the root packages it installs
+type NativeClientCfg struct {
+	RepoKey string `yaml:"repokey"`
+	// Packages are npm names, maven <group>:<artifact>:<version> or pypi names
+	Packages []string `yaml:"packages"`
+}
+
+// NativeCfg configures the package manager client simulation
+type NativeCfg struct {
+	TargetCfg  `yaml:",inline"`
+	Enabled    bool    `yaml:"enabled"`
+	NumWorkers int     `yaml:"numworkers"`
+	RatePerSec float64 `yaml:"ratepersec"`
+	// The simulation stops after DurationSecs or NumInstalls, whichever comes first
+	DurationSecs int `yaml:"durationsecs"`
+	NumInstalls  int `yaml:"numinstalls"`
+	// An install resolves dependencies down to MaxDepth and at most MaxPackages packages
+	MaxDepth    int             `yaml:"maxdepth"`
+	MaxPackages int             `yaml:"maxpackages"`
+	Npm         NativeClientCfg `yaml:"npm"`
+	Maven       NativeClientCfg `yaml:"maven"`
+	Pypi        NativeClientCfg `yaml:"pypi"`
+}
+
+// nativeRoot is a root package of a client
+type nativeRoot struct {
+	client  string
+	repoKey string
+	pkg     string
+}
+
+// nativeInstall is the state of one install, which like a client with an empty
+// cache fetches every package once
+type nativeInstall struct {
+	cfg      NativeCfg
+	d        *Dut
+	rec      *stats.Recorder
+	repoKey  string
+	seen     map[string]bool
+	bytes    int64
+	requests int
+}
+
+// read fetches the URL, recording the request as op
+func (ni *nativeInstall) read(op string, rtURL string, headers map[string]string) ([]byte, error) {
+	start := time.Now()
+	body, err := remoteartifacts.ReadUrl(ni.d.RtDetail, rtURL, headers)
+	ni.rec.RecordBytes(op, start, int64(len(body)), err)
+	ni.bytes += int64(len(body))
+	ni.requests++
+	if err != nil {
+		jflog.Error(fmt.Sprintf("Failed %s of %s in DUT %s : %v", op, rtURL, ni.d.Name, err))
+	}
+	return body, err
+}
+
+// fetch downloads the URL discarding the content, recording the request as op
+func (ni *nativeInstall) fetch(op string, rtURL string) error {
+	start := time.Now()
+	n, err := remoteartifacts.FetchUrl(ni.d.RtDetail, rtURL)
+	ni.rec.RecordBytes(op, start, n, err)
+	ni.bytes += n
+	ni.requests++
+	if err != nil {
+		jflog.Error(fmt.Sprintf("Failed %s of %s in DUT %s : %v", op, rtURL, ni.d.Name, err))
+	}
+	return err
+}
+
+// full reports whether the install reached MaxPackages packages
+func (ni *nativeInstall) full() bool {
+	return len(ni.seen) >= ni.cfg.MaxPackages
+}
+
+// SimNative simulates package manager clients resolving from DUT repos through
+// the package metadata endpoints: npm install fetching package documents then
+// tarballs, maven walking the POMs with their parents and transitive
+// dependencies, and pip install reading the simple index then the wheels
+func (s *Simulator) SimNative(cfg NativeCfg) error {
+	if cfg.NumWorkers < 1 {
+		cfg.NumWorkers = 1
+	}
+	if cfg.MaxDepth < 1 {
+		cfg.MaxDepth = 10
+	}
+	if cfg.MaxPackages < 1 {
+		cfg.MaxPackages = 500
+	}
+	if cfg.DurationSecs <= 0 && cfg.NumInstalls <= 0 {
+		err := fmt.Errorf("durationsecs or numinstalls must be set")
+		jflog.Error(fmt.Sprintf("native: %v", err))
+		return err
+	}
+	roots := []nativeRoot{}
+	for client, ccfg := range map[string]NativeClientCfg{NativeClientNpm: cfg.Npm, NativeClientMaven: cfg.Maven, NativeClientPypi: cfg.Pypi} {
+		if ccfg.RepoKey == "" {
+			continue
+		}
+		for _, p := range ccfg.Packages {
+			roots = append(roots, nativeRoot{client, ccfg.RepoKey, p})
+		}
+	}
+	if len(roots) == 0 {
+		err := fmt.Errorf("no client has a repokey and packages")
+		jflog.Error(fmt.Sprintf("native: %v", err))
+		return err
+	}
+
+	return s.runOnTargets("native", cfg.TargetCfg, func(ds *DutSet) error {
+		ticks := rateTicks(cfg.RatePerSec, cfg.DurationSecs, cfg.NumInstalls)
+		var workerg sync.WaitGroup
+		workerg.Add(cfg.NumWorkers)
+		for i := 0; i < cfg.NumWorkers; i++ {
+			go func(wnum int) {
+				defer workerg.Done()
+				rng := rand.New(rand.NewSource(time.Now().UnixNano() + int64(wnum)))
+				for range ticks {
+					d := ds.Next()
+					nativeInstallRoot(cfg, d, roots[rng.Intn(len(roots))])
+				}
+			}(i)
+		}
+		workerg.Wait()
+		jflog.Info(fmt.Sprintf("All native workers completed on DUT(s) %s", ds.Names()))
+		return nil
+	})
+}
+
+// nativeInstallRoot installs the root package with its dependencies, recording
+// the whole install as <client>-install
+func nativeInstallRoot(cfg NativeCfg, d *Dut, root nativeRoot) {
+	ni := &nativeInstall{
+		cfg:     cfg,
+		d:       d,
+		rec:     stats.NewRecorder("native", d.Name),
+		repoKey: root.repoKey,
+		seen:    map[string]bool{},
+	}
+	start := time.Now()
+	var err error
+	switch root.client {
+	case NativeClientNpm:
+		err = ni.installNpm(root.pkg)
+	case NativeClientMaven:
+		err = ni.installMaven(root.pkg)
+	case NativeClientPypi:
+		err = ni.installPypi(root.pkg)
+	}
+	ni.rec.RecordBytes(root.client+"-install", start, ni.bytes, err)
+	jflog.Debug(fmt.Sprintf("%s install of %s in DUT %s : %d packages, %d requests, %d bytes in %v",
+		root.client, root.pkg, d.Name, len(ni.seen), ni.requests, ni.bytes, time.Since(start)))
+}
+
+// versionPartRe splits a version in its numeric and alphabetic parts
+var versionPartRe = regexp.MustCompile(`\d+|[A-Za-z]+`)
+
+// compareVersions compares dotted versions numerically, a version with a
+// pre-release suffix being lower than the release
+func compareVersions(a string, b string) int {
+	pa, pb := versionPartRe.FindAllString(a, -1), versionPartRe.FindAllString(b, -1)
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		switch {
+		case i >= len(pa):
+			if _, err := strconv.Atoi(pb[i]); err != nil {
+				return 1
+			}
+			return -1
+		case i >= len(pb):
+			if _, err := strconv.Atoi(pa[i]); err != nil {
+				return -1
+			}
+			return 1
+		}
+		na, errA := strconv.Atoi(pa[i])
+		nb, errB := strconv.Atoi(pb[i])
+		switch {
+		case errA == nil && errB == nil && na != nb:
+			if na < nb {
+				return -1
+			}
+			return 1
+		case errA == nil && errB != nil:
+			return 1
+		case errA != nil && errB == nil:
+			return -1
+		case errA != nil && errB != nil && pa[i] != pb[i]:
+			if pa[i] < pb[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// isPrerelease reports whether the version has an alphabetic part, like 1.0.0-rc.1
+func isPrerelease(version string) bool {
+	for _, p := range versionPartRe.FindAllString(version, -1) {
+		if _, err := strconv.Atoi(p); err != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// highestVersion returns the highest release version of versions accepted by match
+func highestVersion(versions []string, match func(v string) bool) string {
+	best := ""
+	for _, v := range versions {
+		if isPrerelease(v) || !match(v) {
+			continue
+		}
+		if best == "" || compareVersions(v, best) > 0 {
+			best = v
+		}
+	}
+	return best
+}
+
+// npmPackument is the part of an npm package document a client resolves with
+type npmPackument struct {
+	DistTags map[string]string `json:"dist-tags"`
+	Versions map[string]struct {
+		Dependencies map[string]string `json:"dependencies"`
+		Dist         struct {
+			Tarball string `json:"tarball"`
+		} `json:"dist"`
+	} `json:"versions"`
+}
+
+// npmPartialRe matches a partial npm version, like 1, 1.2.x or 1.2.3-rc.1
+var npmPartialRe = regexp.MustCompile(`^v?(\d+|[xX*])(?:\.(\d+|[xX*]))?(?:\.(\d+|[xX*]))?(-[0-9A-Za-z.-]+)?(?:\+[0-9A-Za-z.-]+)?$`)
+
+// npmOpSpaceRe matches the blanks between an operator and its version
+var npmOpSpaceRe = regexp.MustCompile(`(>=|<=|>|<|=|\^|~>?)\s+`)
+
+// npmComparator is a primitive comparison of a version, like >=1.2.0
+type npmComparator struct {
+	op      string
+	version string
+}
+
+// matches reports whether the version satisfies the comparator
+func (c npmComparator) matches(version string) bool {
+	cmp := compareVersions(version, c.version)
+	switch c.op {
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	}
+	return cmp == 0
+}
+
+// npmPartial is a parsed partial version, its missing or wildcard parts being -1
+type npmPartial struct {
+	major, minor, patch int
+	pre                 string
+}
+
+// parseNpmPartial parses a partial version, returning false when invalid
+func parseNpmPartial(v string) (npmPartial, bool) {
+	m := npmPartialRe.FindStringSubmatch(v)
+	if m == nil {
+		return npmPartial{}, false
+	}
+	p := npmPartial{-1, -1, -1, m[4]}
+	for i, part := range []*int{&p.major, &p.minor, &p.patch} {
+		n, err := strconv.Atoi(m[i+1])
+		if err != nil {
+			break
+		}
+		*part = n
+	}
+	return p, true
+}
+
+// version returns the partial version with its missing parts zeroed
+func (p npmPartial) version() string {
+	zero := func(n int) int {
+		if n < 0 {
+			return 0
+		}
+		return n
+	}
+	return fmt.Sprintf("%d.%d.%d%s", zero(p.major), zero(p.minor), zero(p.patch), p.pre)
+}
+
+// next returns the lowest version above those the partial version matches,
+// like 1.3.0 for 1.2, or "" when it matches every version
+func (p npmPartial) next() string {
+	switch {
+	case p.major < 0:
+		return ""
+	case p.minor < 0:
+		return fmt.Sprintf("%d.0.0", p.major+1)
+	case p.patch < 0:
+		return fmt.Sprintf("%d.%d.0", p.major, p.minor+1)
+	}
+	return ""
+}
+
+// npmComparators desugars one comparator of a range, like ^1.2 or >=1, into
+// primitive comparators
+func npmComparators(comp string) ([]npmComparator, bool) {
+	op := ""
+	for _, o := range []string{">=", "<=", "~>", ">", "<", "=", "^", "~"} {
+		if strings.HasPrefix(comp, o) {
+			op, comp = o, comp[len(o):]
+			break
+		}
+	}
+	p, ok := parseNpmPartial(comp)
+	if !ok {
+		return nil, false
+	}
+	low, next := npmComparator{">=", p.version()}, p.next()
+	switch op {
+	case "", "=":
+		if next == "" && p.major >= 0 {
+			return []npmComparator{{"=", p.version()}}, true
+		}
+	case ">":
+		if next != "" {
+			return []npmComparator{{">=", next}}, true
+		}
+		if p.major < 0 {
+			// Nothing is greater than any version
+			return []npmComparator{{"<", "0.0.0"}}, true
+		}
+		return []npmComparator{{">", p.version()}}, true
+	case ">=":
+		return []npmComparator{low}, true
+	case "<":
+		return []npmComparator{{"<", p.version()}}, true
+	case "<=":
+		if next != "" {
+			return []npmComparator{{"<", next}}, true
+		}
+		if p.major < 0 {
+			return []npmComparator{low}, true
+		}
+		return []npmComparator{{"<=", p.version()}}, true
+	case "~", "~>":
+		if p.minor >= 0 {
+			next = fmt.Sprintf("%d.%d.0", p.major, p.minor+1)
+		}
+	case "^":
+		switch {
+		case p.major > 0 || p.minor < 0:
+			next = npmPartial{p.major, -1, -1, ""}.next()
+		case p.minor > 0 || p.patch < 0:
+			next = fmt.Sprintf("0.%d.0", p.minor+1)
+		default:
+			next = fmt.Sprintf("0.0.%d", p.patch+1)
+		}
+	}
+	if next == "" {
+		return []npmComparator{low}, true
+	}
+	return []npmComparator{low, {"<", next}}, true
+}
+
+// parseNpmRange parses an npm range into its comparator sets, a version
+// satisfying the range when it satisfies all the comparators of one set.
+// Hyphen ranges, x-ranges, ~, ^ and the comparison operators are supported,
+// false being returned for the other specs, like URLs, git or file paths.
+func parseNpmRange(spec string) ([][]npmComparator, bool) {
+	sets := [][]npmComparator{}
+	for _, alt := range strings.Split(spec, "||") {
+		fields := strings.Fields(npmOpSpaceRe.ReplaceAllString(strings.TrimSpace(alt), "$1"))
+		set := []npmComparator{}
+		if len(fields) == 3 && fields[1] == "-" {
+			from, ok1 := parseNpmPartial(fields[0])
+			to, ok2 := parseNpmPartial(fields[2])
+			if !ok1 || !ok2 {
+				return nil, false
+			}
+			set = append(set, npmComparator{">=", from.version()})
+			if next := to.next(); next != "" {
+				set = append(set, npmComparator{"<", next})
+			} else if to.major >= 0 {
+				set = append(set, npmComparator{"<=", to.version()})
+			}
+			fields = nil
+		}
+		if len(fields) == 0 && len(set) == 0 {
+			// An empty range matches any version
+			set = append(set, npmComparator{">=", "0.0.0"})
+		}
+		for _, f := range fields {
+			comps, ok := npmComparators(f)
+			if !ok {
+				return nil, false
+			}
+			set = append(set, comps...)
+		}
+		sets = append(sets, set)
+	}
+	return sets, true
+}
+
+// npmVersion returns the version of the package document satisfying spec, a
+// dist tag, an exact version or a range, like npm install does: the highest
+// release version satisfying the range, pre-releases being only installed
+// when named exactly. Specs which are no ranges, like URLs or git
+// repositories, resolve to the latest version, and "" is returned when no
+// version satisfies the range.
+func npmVersion(doc *npmPackument, spec string) string {
+	latest := doc.DistTags["latest"]
+	if v, ok := doc.DistTags[spec]; ok {
+		return v
+	}
+	spec = strings.TrimSpace(spec)
+	if _, ok := doc.Versions[strings.TrimPrefix(strings.TrimPrefix(spec, "="), "v")]; ok {
+		return strings.TrimPrefix(strings.TrimPrefix(spec, "="), "v")
+	}
+	sets, ok := parseNpmRange(spec)
+	if !ok {
+		return latest
+	}
+	versions := []string{}
+	for v := range doc.Versions {
+		versions = append(versions, v)
+	}
+	satisfies := func(v string) bool {
+		for _, set := range sets {
+			matched := true
+			for _, c := range set {
+				if !c.matches(v) {
+					matched = false
+					break
+				}
+			}
+			if matched {
+				return true
+			}
+		}
+		return false
+	}
+	// Like npm, the latest tag wins when it satisfies the range
+	if _, ok := doc.Versions[latest]; ok && !isPrerelease(latest) && satisfies(latest) {
+		return latest
+	}
+	return highestVersion(versions, satisfies)
+}
+
+// npmDocUrl returns the URL of the package document of name, scoped names
+// having their slash escaped like the npm client does
+func (ni *nativeInstall) npmDocUrl(name string) string {
+	return (*ni.d.RtDetail).GetUrl() + "api/npm/" + ni.repoKey + "/" + strings.Replace(name, "/", "%2f", 1)
+}
+
+// installNpm emulates npm install of the package with an empty cache: the
+// package document of each package is fetched once, then the tarball of the
+// version resolved
+func (ni *nativeInstall) installNpm(root string) error {
+	type npmDep struct {
+		name  string
+		spec  string
+		depth int
+	}
+	docs := map[string]*npmPackument{}
+	queue := []npmDep{{root, "latest", 0}}
+	var rootErr error
+	for len(queue) > 0 && !ni.full() {
+		dep := queue[0]
+		queue = queue[1:]
+		doc, ok := docs[dep.name]
+		if !ok {
+			body, err := ni.read("npm-metadata", ni.npmDocUrl(dep.name), map[string]string{
+				"Accept": "application/vnd.npm.install-v1+json; q=1.0, application/json; q=0.8, */*",
+			})
+			if err == nil {
+				doc = &npmPackument{}
+				err = json.Unmarshal(body, doc)
+			}
+			if err != nil {
+				if dep.depth == 0 {
+					rootErr = err
+				}
+				docs[dep.name] = nil
+				continue
+			}
+			docs[dep.name] = doc
+		}
+		if doc == nil {
+			continue
+		}
+		version := npmVersion(doc, dep.spec)
+		if version == "" {
+			jflog.Debug(fmt.Sprintf("No version of %s satisfies %s", dep.name, dep.spec))
+			continue
+		}
+		key := dep.name + "@" + version
+		if ni.seen[key] {
+			continue
+		}
+		ni.seen[key] = true
+		pkg, ok := doc.Versions[version]
+		if !ok {
+			continue
+		}
+		if pkg.Dist.Tarball != "" {
+			if err := ni.fetch("npm-tarball", pkg.Dist.Tarball); err != nil && dep.depth == 0 {
+				rootErr = err
+			}
+		}
+		if dep.depth+1 < ni.cfg.MaxDepth {
+			for name, spec := range pkg.Dependencies {
+				queue = append(queue, npmDep{name, spec, dep.depth + 1})
+			}
+		}
+	}
+	return rootErr
+}
+
+// pypiAnchorRe matches the links of a simple index page
+var pypiAnchorRe = regexp.MustCompile(`<a[^>]*href="([^"]+)"[^>]*>([^<]+)</a>`)
+
+// pypiNameRe matches the project name of a requirement
+var pypiNameRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*`)
+
+// pypiSepRe matches the separators of a project name
+var pypiSepRe = regexp.MustCompile(`[-_.]+`)
+
+// pypiNormalize returns the normalized project name used in the simple index
+func pypiNormalize(name string) string {
+	return strings.ToLower(pypiSepRe.ReplaceAllString(name, "-"))
+}
+
+// pypiPickFile returns the URL of the distribution pip would install from the
+// simple index page: the universal wheel of the highest version, else its sdist
+func pypiPickFile(indexURL string, page []byte) (string, bool) {
+	base, err := url.Parse(indexURL)
+	if err != nil {
+		return "", false
+	}
+	type dist struct {
+		href  string
+		wheel bool
+	}
+	dists := map[string][]dist{}
+	versions := []string{}
+	for _, m := range pypiAnchorRe.FindAllStringSubmatch(string(page), -1) {
+		file := strings.TrimSpace(m[2])
+		var version string
+		var wheel bool
+		switch {
+		case strings.HasSuffix(file, ".whl"):
+			parts := strings.Split(strings.TrimSuffix(file, ".whl"), "-")
+			if len(parts) < 5 || !strings.HasSuffix(file, "-none-any.whl") {
+				continue
+			}
+			version, wheel = parts[1], true
+		case strings.HasSuffix(file, ".tar.gz"):
+			name := strings.TrimSuffix(file, ".tar.gz")
+			version = name[strings.LastIndex(name, "-")+1:]
+		default:
+			continue
+		}
+		ref, err := url.Parse(m[1])
+		if err != nil {
+			continue
+		}
+		ref.Fragment = ""
+		if _, ok := dists[version]; !ok {
+			versions = append(versions, version)
+		}
+		dists[version] = append(dists[version], dist{base.ResolveReference(ref).String(), wheel})
+	}
+	version := highestVersion(versions, func(string) bool { return true })
+	if version == "" {
+		return "", false
+	}
+	for _, d := range dists[version] {
+		if d.wheel {
+			return d.href, true
+		}
+	}
+	return dists[version][0].href, false
+}
+
+// wheelRequirements returns the names of the unconditional requirements in the
+// metadata of the wheel
+func wheelRequirements(whl []byte) []string {
+	zr, err := zip.NewReader(bytes.NewReader(whl), int64(len(whl)))
+	if err != nil {
+		return nil
+	}
+	names := []string{}
+	for _, f := range zr.File {
+		if !strings.HasSuffix(f.Name, ".dist-info/METADATA") {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil
+		}
+		defer rc.Close()
+		scanner := bufio.NewScanner(rc)
+		for scanner.Scan() {
+			line := scanner.Text()
+			if line == "" {
+				// The headers end at the first empty line
+				break
+			}
+			if !strings.HasPrefix(line, "Requires-Dist:") || strings.Contains(line, "extra ==") {
+				continue
+			}
+			if name := pypiNameRe.FindString(strings.TrimSpace(strings.TrimPrefix(line, "Requires-Dist:"))); name != "" {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// installPypi emulates pip install of the project with an empty cache: the
+// simple index page of each project is read, then the distribution of the
+// highest version downloaded, and the requirements of wheels followed
+func (ni *nativeInstall) installPypi(root string) error {
+	type pypiDep struct {
+		name  string
+		depth int
+	}
+	queue := []pypiDep{{root, 0}}
+	var rootErr error
+	for len(queue) > 0 && !ni.full() {
+		dep := queue[0]
+		queue = queue[1:]
+		name := pypiNormalize(dep.name)
+		if ni.seen[name] {
+			continue
+		}
+		ni.seen[name] = true
+		indexURL := (*ni.d.RtDetail).GetUrl() + "api/pypi/" + ni.repoKey + "/simple/" + name + "/"
+		page, err := ni.read("pypi-index", indexURL, nil)
+		if err != nil {
+			if dep.depth == 0 {
+				rootErr = err
+			}
+			continue
+		}
+		fileURL, wheel := pypiPickFile(indexURL, page)
+		if fileURL == "" {
+			continue
+		}
+		if !wheel {
+			if err := ni.fetch("pypi-sdist", fileURL); err != nil && dep.depth == 0 {
+				rootErr = err
+			}
+			continue
+		}
+		whl, err := ni.read("pypi-wheel", fileURL, nil)
+		if err != nil {
+			if dep.depth == 0 {
+				rootErr = err
+			}
+			continue
+		}
+		if dep.depth+1 < ni.cfg.MaxDepth {
+			for _, req := range wheelRequirements(whl) {
+				queue = append(queue, pypiDep{req, dep.depth + 1})
+			}
+		}
+	}
+	return rootErr
+}
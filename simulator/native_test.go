@@ -0,0 +1,313 @@
+package simulator
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jfrog/jfrog-client-go/artifactory/auth"
+	"jfrog.com/datasim/stats"
+)
+
+// testDut returns a DUT reaching the Artifactory at url
+func testDut(url string) *Dut {
+	details := auth.NewArtifactoryDetails()
+	details.SetUrl(url)
+	return NewDut("test", &details, nil)
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.2.3", "1.2.3", 0},
+		{"1.10.0", "1.9.0", 1},
+		{"1.9.0", "1.10.0", -1},
+		{"2.0.0", "1.99.99", 1},
+		{"1.0.0-rc.1", "1.0.0", -1},
+		{"1.0.0", "1.0.0-rc.1", 1},
+		{"1.0.0-alpha", "1.0.0-beta", -1},
+		{"1.0.0-rc.2", "1.0.0-rc.10", -1},
+		{"2.32.0rc1", "2.31.0", 1},
+	}
+	for _, tt := range tests {
+		if got := compareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("compareVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestNpmVersion(t *testing.T) {
+	body, err := ioutil.ReadFile(filepath.Join("testdata", "native", "packument.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := &npmPackument{}
+	if err := json.Unmarshal(body, doc); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		spec string
+		want string
+	}{
+		{"latest", "2.1.0"},
+		{"next", "2.1.0-beta.1"},
+		{"1.2.0", "1.2.0"},
+		{"=1.2.0", "1.2.0"},
+		{"v1.2.0", "1.2.0"},
+		{"2.1.0-beta.1", "2.1.0-beta.1"},
+		{"", "2.1.0"},
+		{"*", "2.1.0"},
+		{"x", "2.1.0"},
+		{"1", "1.9.9"},
+		{"1.x", "1.9.9"},
+		{"1.2.x", "1.2.5"},
+		{"1.2.*", "1.2.5"},
+		{"^1.2.0", "1.9.9"},
+		{"^1.2", "1.9.9"},
+		{"^0.1.0", "0.1.5"},
+		{"^0.0.3", "0.0.3"},
+		{"^0.0", "0.0.4"},
+		{"^0", "0.2.0"},
+		{"~1.2.0", "1.2.5"},
+		{"~1.2", "1.2.5"},
+		{"~1", "1.9.9"},
+		{"~0.1", "0.1.5"},
+		{">=1.2.0 <2.0.0", "1.9.9"},
+		{">= 1.2.0 < 1.3.0", "1.2.5"},
+		{">1.2.0 <=1.3.0", "1.3.0"},
+		{"<2.0.0", "1.9.9"},
+		{"<2", "1.9.9"},
+		{"<=1.3", "1.3.0"},
+		{"<=1", "1.9.9"},
+		{"<1.2", "1.0.0"},
+		{">2.0.0", "2.1.0"},
+		{">1", "2.1.0"},
+		{">=2", "2.1.0"},
+		{"1.0.0 - 1.2", "1.2.5"},
+		{"1.0.0 - 1.2.0", "1.2.0"},
+		{"0.1 - 1", "1.9.9"},
+		{"<1.0.0 || ^1.2.0 <1.3.0", "1.2.5"},
+		{"^0.2.0 || ~1.3.0", "1.3.0"},
+		{"^3.0.0", ""},
+		{">2.1.0", ""},
+		{"git+https://github.com/demo/demo.git", "2.1.0"},
+		{"file:../demo", "2.1.0"},
+		{"npm:other@^1.0.0", "2.1.0"},
+	}
+	for _, tt := range tests {
+		if got := npmVersion(doc, tt.spec); got != tt.want {
+			t.Errorf("npmVersion(%q) = %q, want %q", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestPypiPickFile(t *testing.T) {
+	tests := []struct {
+		page      string
+		indexURL  string
+		wantURL   string
+		wantWheel bool
+	}{
+		{
+			page:      "simple-index.html",
+			indexURL:  "http://rt/artifactory/api/pypi/pypi/simple/requests/",
+			wantURL:   "http://rt/artifactory/api/pypi/pypi/packages/requests-2.31.0-py3-none-any.whl",
+			wantWheel: true,
+		},
+		{
+			page:     "simple-index-sdist.html",
+			indexURL: "http://rt/artifactory/api/pypi/pypi/simple/six/",
+			wantURL:  "https://files.example.com/six-1.16.0.tar.gz",
+		},
+	}
+	for _, tt := range tests {
+		page, err := ioutil.ReadFile(filepath.Join("testdata", "native", tt.page))
+		if err != nil {
+			t.Fatal(err)
+		}
+		gotURL, gotWheel := pypiPickFile(tt.indexURL, page)
+		if gotURL != tt.wantURL || gotWheel != tt.wantWheel {
+			t.Errorf("pypiPickFile(%s) = %q, %v, want %q, %v", tt.page, gotURL, gotWheel, tt.wantURL, tt.wantWheel)
+		}
+	}
+	if url, _ := pypiPickFile("http://rt/simple/none/", []byte("<html></html>")); url != "" {
+		t.Errorf("pypiPickFile(empty page) = %q, want none", url)
+	}
+}
+
+func TestWheelRequirements(t *testing.T) {
+	metadata := strings.Join([]string{
+		"Metadata-Version: 2.1",
+		"Name: requests",
+		"Version: 2.31.0",
+		"Requires-Dist: charset-normalizer (<4,>=2)",
+		"Requires-Dist: idna<4,>=2.5",
+		"Requires-Dist: urllib3<3,>=1.21.1",
+		`Requires-Dist: PySocks!=1.5.7,>=1.5.6; extra == "socks"`,
+		"Requires-Dist: certifi>=2017.4.17",
+		"",
+		"Requires-Dist: in-the-description",
+	}, "\n")
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+	for name, content := range map[string]string{
+		"requests/__init__.py":                "",
+		"requests-2.31.0.dist-info/METADATA":  metadata,
+		"requests-2.31.0.dist-info/top_level": "requests\n",
+	} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	got := wheelRequirements(buf.Bytes())
+	want := []string{"charset-normalizer", "idna", "urllib3", "certifi"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("wheelRequirements() = %v, want %v", got, want)
+	}
+	if got := wheelRequirements([]byte("not a zip")); len(got) != 0 {
+		t.Errorf("wheelRequirements(invalid) = %v, want none", got)
+	}
+}
+
+func TestMavenInterpolate(t *testing.T) {
+	m := &mavenModel{properties: map[string]string{
+		"a":    "${b}.${c}",
+		"b":    "1",
+		"c":    "${b}0",
+		"loop": "${loop}",
+	}}
+	tests := map[string]string{
+		"${a}":          "1.10",
+		"v${b}-${c}":    "v1-10",
+		"${missing}":    "${missing}",
+		"plain":         "plain",
+		"${loop}-${b}":  "${loop}-1",
+		"${a}/${a}.jar": "1.10/1.10.jar",
+	}
+	for value, want := range tests {
+		if got := m.interpolate(value); got != want {
+			t.Errorf("interpolate(%q) = %q, want %q", value, got, want)
+		}
+	}
+}
+
+func TestMavenInRange(t *testing.T) {
+	tests := []struct {
+		spec    string
+		version string
+		want    bool
+	}{
+		{"[1.0,2.0)", "1.0", true},
+		{"[1.0,2.0)", "1.9", true},
+		{"[1.0,2.0)", "2.0", false},
+		{"[1.0,2.0)", "0.9", false},
+		{"(1.0,2.0]", "1.0", false},
+		{"(1.0,2.0]", "2.0", true},
+		{"[1.5]", "1.5", true},
+		{"[1.5]", "1.6", false},
+		{"[1.0,)", "10.0", true},
+		{"(,1.0]", "0.1", true},
+		{"(,1.0],[1.2,)", "1.1", false},
+		{"(,1.0],[1.2,)", "1.3", true},
+		{"1.0", "1.0", false},
+	}
+	for _, tt := range tests {
+		if got := mavenInRange(tt.spec, tt.version); got != tt.want {
+			t.Errorf("mavenInRange(%q, %q) = %v, want %v", tt.spec, tt.version, got, tt.want)
+		}
+	}
+}
+
+func TestInstallMaven(t *testing.T) {
+	var mu sync.Mutex
+	requested := []string{}
+	files := http.StripPrefix("/artifactory/libs/", http.FileServer(http.Dir(filepath.Join("testdata", "native", "maven"))))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requested = append(requested, strings.TrimPrefix(r.URL.Path, "/artifactory/libs/"))
+		mu.Unlock()
+		if strings.HasSuffix(r.URL.Path, ".jar") || strings.HasSuffix(r.URL.Path, ".sha1") {
+			w.Write([]byte("content"))
+			return
+		}
+		files.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	d := testDut(server.URL + "/artifactory/")
+	ni := &nativeInstall{
+		cfg:     NativeCfg{MaxDepth: 10, MaxPackages: 100},
+		d:       d,
+		rec:     stats.NewRecorder("native", d.Name),
+		repoKey: "libs",
+		seen:    map[string]bool{},
+	}
+	if err := ni.installMaven("com.example:app:1.0"); err != nil {
+		t.Fatalf("installMaven() failed: %v", err)
+	}
+
+	got := map[string]bool{}
+	for _, r := range requested {
+		got[r] = true
+	}
+	for _, want := range []string{
+		"com/example/app/1.0/app-1.0.pom",
+		"com/example/app/1.0/app-1.0.jar",
+		"com/example/parent/1.0/parent-1.0.pom",
+		"com/example/bom/1.0/bom-1.0.pom",
+		// Managed by the parent, over the BOM it imports
+		"com/example/managed/2.0/managed-2.0.pom",
+		// Managed by the BOM
+		"com/example/from-bom/3.1/from-bom-3.1.pom",
+		// Versioned by ${project.version}, inherited from the parent
+		"com/example/direct/1.0/direct-1.0.pom",
+		"com/example/transitive/1.1/transitive-1.1.pom",
+		// Declared by the parent, with a property of the child
+		"com/example/inherited/1.2/inherited-1.2.pom",
+		"com/example/ranged/maven-metadata.xml",
+		"com/example/ranged/1.5/ranged-1.5.pom",
+		// The highest version in [1.0,2.0), the release 2.1 being out of it
+		"com/example/bounded/maven-metadata.xml",
+		"com/example/bounded/1.9/bounded-1.9.pom",
+	} {
+		if !got[want] {
+			t.Errorf("installMaven() did not request %s", want)
+		}
+	}
+	for r := range got {
+		if strings.Contains(r, "testonly") || strings.Contains(r, "/opt/") || strings.Contains(r, "9.9") || strings.Contains(r, "${") {
+			t.Errorf("installMaven() requested %s", r)
+		}
+		if strings.Contains(r, "/bounded/") && !strings.HasSuffix(r, "maven-metadata.xml") && !strings.Contains(r, "/1.9/") {
+			t.Errorf("installMaven() requested %s, out of the range", r)
+		}
+		if strings.HasSuffix(r, ".jar") && (strings.Contains(r, "/parent/") || strings.Contains(r, "/example/bom/")) {
+			t.Errorf("installMaven() requested the jar of a pom packaging %s", r)
+		}
+	}
+	seen := []string{}
+	for ga := range ni.seen {
+		seen = append(seen, ga)
+	}
+	sort.Strings(seen)
+	want := "com.example:app,com.example:bounded,com.example:direct,com.example:from-bom,com.example:inherited,com.example:managed,com.example:ranged,com.example:transitive"
+	if strings.Join(seen, ",") != want {
+		t.Errorf("installMaven() resolved %v, want %s", seen, want)
+	}
+}
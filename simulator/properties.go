@@ -0,0 +1,274 @@
+package simulator
+
+import (
+	"fmt"
+	"math/rand"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	jflog "github.com/jfrog/jfrog-client-go/utils/log"
+	"jfrog.com/datasim/remoteartifacts"
+	"jfrog.com/datasim/stats"
+)
+
+// PropertiesCfg configures the property set and search simulation
+type PropertiesCfg struct {
+	TargetCfg  `yaml:",inline"`
+	Enabled    bool    `yaml:"enabled"`
+	RepoPrefix string  `yaml:"repoprefix"`
+	NumItems   int     `yaml:"numitems"`
+	RatePerSec float64 `yaml:"ratepersec"`
+	// The simulation stops after DurationSecs or NumOps, whichever comes first
+	DurationSecs int `yaml:"durationsecs"`
+	NumOps       int `yaml:"numops"`
+	NumWorkers   int `yaml:"numworkers"`
+	// PropsPerCall properties are set at once
+	PropsPerCall int `yaml:"propspercall"`
+	Mix          struct {
+		Set            int `yaml:"set"`
+		Update         int `yaml:"update"`
+		Delete         int `yaml:"delete"`
+		PropSearch     int `yaml:"propsearch"`
+		GavcSearch     int `yaml:"gavcsearch"`
+		ChecksumSearch int `yaml:"checksumsearch"`
+		QuickSearch    int `yaml:"quicksearch"`
+	} `yaml:"mix"`
+}
+
+// Operations of the properties simulation, indexes of the mix weights
+var propOps = []string{"set", "update", "delete", "prop-search", "gavc-search", "checksum-search", "quick-search"}
+
+// propValues are the values of each property key, few enough for searches to match
+var propValues = map[string][]string{
+	"datasim.stage":     {"dev", "qa", "staging", "release"},
+	"datasim.team":      {"core", "platform", "mobile", "web", "data"},
+	"datasim.ci.server": {"jenkins", "github", "gitlab", "circleci"},
+	"datasim.ci.build":  {},
+	"datasim.approved":  {"true", "false"},
+}
+
+// propKeys are the keys of propValues, sorted
+var propKeys = func() []string {
+	keys := []string{}
+	for k := range propValues {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}()
+
+// propValue returns a random value of the property key
+func propValue(rng *rand.Rand, key string) string {
+	if len(propValues[key]) == 0 {
+		return fmt.Sprintf("%d", rng.Intn(100000))
+	}
+	return propValues[key][rng.Intn(len(propValues[key]))]
+}
+
+// propState tracks the property keys the simulation set on the items of a DUT
+type propState struct {
+	mu    sync.Mutex
+	items []AqlItem
+	keys  map[int][]string
+}
+
+// pick returns a random item index, one having properties when withProps is set,
+// -1 when there is none
+func (ps *propState) pick(rng *rand.Rand, withProps bool) int {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if !withProps {
+		return rng.Intn(len(ps.items))
+	}
+	if len(ps.keys) == 0 {
+		return -1
+	}
+	indexes := []int{}
+	for i := range ps.keys {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+	return indexes[rng.Intn(len(indexes))]
+}
+
+func (ps *propState) setKeys(i int, keys []string) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	for _, k := range keys {
+		if !containsString(ps.keys[i], k) {
+			ps.keys[i] = append(ps.keys[i], k)
+		}
+	}
+}
+
+func (ps *propState) getKeys(i int) []string {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	return append([]string{}, ps.keys[i]...)
+}
+
+func (ps *propState) deleteKeys(i int) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	delete(ps.keys, i)
+}
+
+// SimProperties simulates property-heavy workflows by setting, updating and
+// deleting properties of the simulator files and issuing property, GAVC,
+// checksum and quick searches
+func (s *Simulator) SimProperties(cfg PropertiesCfg) error {
+	if cfg.RepoPrefix == "" {
+		cfg.RepoPrefix = DefaultUploadRepoPrefix
+	}
+	if cfg.NumItems < 1 {
+		cfg.NumItems = 1000
+	}
+	if cfg.NumWorkers < 1 {
+		cfg.NumWorkers = 1
+	}
+	if cfg.PropsPerCall < 1 {
+		cfg.PropsPerCall = 1
+	}
+	if cfg.DurationSecs <= 0 && cfg.NumOps <= 0 {
+		err := fmt.Errorf("durationsecs or numops must be set")
+		jflog.Error(fmt.Sprintf("properties: %v", err))
+		return err
+	}
+	weights := []int{cfg.Mix.Set, cfg.Mix.Update, cfg.Mix.Delete, cfg.Mix.PropSearch, cfg.Mix.GavcSearch, cfg.Mix.ChecksumSearch, cfg.Mix.QuickSearch}
+	totalWeight := sumInts(weights)
+	if totalWeight == 0 {
+		weights, totalWeight = []int{1, 1, 1, 1, 1, 1, 1}, len(propOps)
+	}
+
+	return s.runOnTargets("properties", cfg.TargetCfg, func(ds *DutSet) error {
+		states := map[*Dut]*propState{}
+		repos := map[*Dut][]string{}
+		for _, d := range ds.Duts {
+			var err error
+			if repos[d], err = listSimRepos(d, cfg.RepoPrefix); err != nil {
+				jflog.Error(fmt.Sprintf("Failed listing repos of DUT %s : %v", d.Name, err))
+				return err
+			}
+			items, err := findFiles(d, repos[d], cfg.NumItems)
+			if err != nil {
+				jflog.Error(fmt.Sprintf("Failed to find items in DUT %s : %v", d.Name, err))
+				return err
+			}
+			if len(items) == 0 {
+				err := fmt.Errorf("no file in the repos starting with %s of DUT %s", cfg.RepoPrefix, d.Name)
+				jflog.Error(fmt.Sprintf("properties: %v", err))
+				return err
+			}
+			states[d] = &propState{items: items, keys: map[int][]string{}}
+		}
+
+		ticks := rateTicks(cfg.RatePerSec, cfg.DurationSecs, cfg.NumOps)
+		var workerg sync.WaitGroup
+		workerg.Add(cfg.NumWorkers)
+		for i := 0; i < cfg.NumWorkers; i++ {
+			go func(wnum int) {
+				defer workerg.Done()
+				rng := rand.New(rand.NewSource(time.Now().UnixNano() + int64(wnum)))
+				for range ticks {
+					d := ds.Next()
+					propOp(cfg, d, states[d], repos[d], rng, propOps[pickWeighted(rng, weights, totalWeight)])
+				}
+			}(i)
+		}
+		workerg.Wait()
+		jflog.Info(fmt.Sprintf("All properties workers completed on DUT(s) %s", ds.Names()))
+		return nil
+	})
+}
+
+// propOp runs one operation of the properties simulation
+func propOp(cfg PropertiesCfg, d *Dut, state *propState, repos []string, rng *rand.Rand, op string) {
+	rec := stats.NewRecorder("properties", d.Name)
+	var err error
+	var n int64
+	var target string
+	start := time.Now()
+	switch op {
+	case "set", "update":
+		i := state.pick(rng, op == "update")
+		if i < 0 {
+			return
+		}
+		keys := state.getKeys(i)
+		if op == "set" || len(keys) == 0 {
+			keys = []string{}
+			for _, k := range rng.Perm(len(propKeys))[:minInt(cfg.PropsPerCall, len(propKeys))] {
+				keys = append(keys, propKeys[k])
+			}
+		}
+		props := map[string]string{}
+		for _, k := range keys {
+			props[k] = propValue(rng, k)
+		}
+		target = state.items[i].RepoPath()
+		start = time.Now()
+		if err = remoteartifacts.SetItemProperties(d.RtDetail, target, props); err == nil {
+			state.setKeys(i, keys)
+		}
+	case "delete":
+		i := state.pick(rng, true)
+		if i < 0 {
+			return
+		}
+		target = state.items[i].RepoPath()
+		start = time.Now()
+		if err = remoteartifacts.DeleteItemProperties(d.RtDetail, target, state.getKeys(i)); err == nil {
+			state.deleteKeys(i)
+		}
+	default:
+		target = searchUri(op, state.items[state.pick(rng, false)], repos, rng)
+		start = time.Now()
+		n, err = remoteartifacts.FetchUri(d.RtDetail, target)
+	}
+	rec.RecordBytes(op, start, n, err)
+	if err != nil {
+		jflog.Error(fmt.Sprintf("Failed properties %s of %s in DUT %s : %v", op, target, d.Name, err))
+	}
+}
+
+// searchUri returns the URI of a search of kind op expected to match the item
+func searchUri(op string, item AqlItem, repos []string, rng *rand.Rand) string {
+	params := url.Values{"repos": {strings.Join(repos, ",")}}
+	switch op {
+	case "prop-search":
+		key := propKeys[rng.Intn(len(propKeys))]
+		params.Set(key, propValue(rng, key))
+		return remoteartifacts.SearchUri("prop", params)
+	case "gavc-search":
+		// Items of maven repos are at <group>/<artifact>/<version>/<file>
+		parts := strings.Split(item.Path, "/")
+		if len(parts) >= 3 {
+			params.Set("g", strings.Join(parts[:len(parts)-2], "."))
+			params.Set("a", parts[len(parts)-2])
+			params.Set("v", parts[len(parts)-1])
+			return remoteartifacts.SearchUri("gavc", params)
+		}
+		params.Set("a", strings.TrimSuffix(item.Name, path.Ext(item.Name)))
+		return remoteartifacts.SearchUri("gavc", params)
+	case "checksum-search":
+		if item.Sha256 != "" {
+			params.Set("sha256", item.Sha256)
+		} else {
+			params.Set("sha1", item.Sha1)
+		}
+		return remoteartifacts.SearchUri("checksum", params)
+	}
+	params.Set("name", item.Name)
+	return remoteartifacts.SearchUri("artifact", params)
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
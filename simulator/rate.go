@@ -0,0 +1,50 @@
+package simulator
+
+import (
+	"time"
+)
+
+// rateTicks emits ratePerSec ticks a second for durationSecs seconds, or count
+// ticks as fast as they are consumed when ratePerSec is not set. The channel is
+// closed once the duration elapsed or count ticks were emitted, count 0 meaning
+// no limit.
+func rateTicks(ratePerSec float64, durationSecs int, count int) <-chan struct{} {
+	return rateTicksUntil(nil, ratePerSec, durationSecs, count)
+}
+
+// rateTicksUntil emits ticks like rateTicks, closing the channel early once
+// stop is closed
+func rateTicksUntil(stop <-chan struct{}, ratePerSec float64, durationSecs int, count int) <-chan struct{} {
+	ticks := make(chan struct{})
+	go func() {
+		defer close(ticks)
+		var deadline <-chan time.Time
+		if durationSecs > 0 {
+			deadline = time.After(time.Duration(durationSecs) * time.Second)
+		}
+		var ticker *time.Ticker
+		if ratePerSec > 0 {
+			ticker = time.NewTicker(time.Duration(float64(time.Second) / ratePerSec))
+			defer ticker.Stop()
+		}
+		for n := 0; count == 0 || n < count; n++ {
+			if ticker != nil {
+				select {
+				case <-ticker.C:
+				case <-deadline:
+					return
+				case <-stop:
+					return
+				}
+			}
+			select {
+			case ticks <- struct{}{}:
+			case <-deadline:
+				return
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return ticks
+}
@@ -0,0 +1,357 @@
+package simulator
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	jfauth "github.com/jfrog/jfrog-client-go/auth"
+	jflog "github.com/jfrog/jfrog-client-go/utils/log"
+	"jfrog.com/datasim/generator"
+	"jfrog.com/datasim/redact"
+	"jfrog.com/datasim/remoteartifacts"
+	"jfrog.com/datasim/stats"
+)
+
+// Replay speeds
+const (
+	ReplaySpeedOriginal = "original"
+	ReplaySpeedScaled   = "scaled"
+	ReplaySpeedMax      = "max"
+)
+
+// ReplayUser is the DUT user a logged user is replayed as
+type ReplayUser struct {
+	Username    string `yaml:"username"`
+	Password    string `yaml:"password"`
+	AccessToken string `yaml:"accesstoken"`
+	Anonymous   bool   `yaml:"anonymous"`
+}
+
+// ReplayCfg configures the access log replay simulation
+type ReplayCfg struct {
+	TargetCfg   `yaml:",inline"`
+	Enabled     bool     `yaml:"enabled"`
+	RequestLogs []string `yaml:"requestlogs"`
+	AccessLogs  []string `yaml:"accesslogs"`
+	// Only the requests logged between From and To, RFC3339 times, are replayed
+	From string `yaml:"from"`
+	To   string `yaml:"to"`
+	// Methods replayed, GET and HEAD by default
+	Methods []string `yaml:"methods"`
+	// RepoMap renames the logged repos to the DUT ones
+	RepoMap map[string]string `yaml:"repomap"`
+	// Users maps the logged users to DUT users, the others use the DUT credentials
+	Users map[string]ReplayUser `yaml:"users"`
+	// Speed is original, scaled by ScaleFactor or max
+	Speed       string  `yaml:"speed"`
+	ScaleFactor float64 `yaml:"scalefactor"`
+	NumWorkers  int     `yaml:"numworkers"`
+	// MaxBodySize bounds the generated bodies of the replayed uploads
+	MaxBodySize int64 `yaml:"maxbodysize"`
+}
+
+// replayRequest is a request read from a log
+type replayRequest struct {
+	time     time.Time
+	user     string
+	method   string
+	uri      string
+	status   int
+	bodySize int64
+}
+
+// requestLogV7Re matches the lines of the artifactory-request.log of Artifactory 7:
+// date|trace id|remote address|user|method|uri|status|request length|response length|duration|user agent
+var requestLogV7Re = regexp.MustCompile(`^(\d{4}-\d\d-\d\dT[^|]+)\|[^|]*\|[^|]*\|([^|]*)\|([A-Z]+)\|([^|]+)\|(\d+)\|(-?\d+)\|`)
+
+// requestLogV6Re matches the lines of the request.log of Artifactory 6:
+// date|duration|type|remote address|user|method|uri|protocol|status|size
+var requestLogV6Re = regexp.MustCompile(`^(\d{14})\|\d+\|[A-Z]+\|[^|]*\|([^|]*)\|([A-Z]+)\|([^|]+)\|[^|]*\|(\d+)\|(-?\d+)`)
+
+// accessLogRe matches the accepted actions of the access.log:
+// date [service] [ACCEPTED action] repo:path for client : user / address.
+var accessLogRe = regexp.MustCompile(`^(\d{4}-\d\d-\d\d[T ][\d:.,]+Z?)\s.*\[ACCEPTED (DOWNLOAD|DEPLOY|DELETE)\]\s+([^:\s]+):(\S+)\s+for\s+(?:client\s*:\s*)?([^/\s]+)`)
+
+// accessLogMethods maps the access.log actions to the request methods
+var accessLogMethods = map[string]string{"DOWNLOAD": "GET", "DEPLOY": "PUT", "DELETE": "DELETE"}
+
+// parseLogTime parses the date formats of the Artifactory logs
+func parseLogTime(value string) (time.Time, error) {
+	for _, layout := range []string{"2006-01-02T15:04:05.000Z", time.RFC3339Nano, "20060102150405", "2006-01-02 15:04:05,000", "2006-01-02T15:04:05.000-07:00"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unknown date format %s", value)
+}
+
+// parseRequestLine parses a line of a request log, returning nil if it is not a request
+func parseRequestLine(line string) *replayRequest {
+	m := requestLogV7Re.FindStringSubmatch(line)
+	if m == nil {
+		m = requestLogV6Re.FindStringSubmatch(line)
+	}
+	if m == nil {
+		return nil
+	}
+	t, err := parseLogTime(m[1])
+	if err != nil {
+		return nil
+	}
+	status, _ := strconv.Atoi(m[5])
+	size, _ := strconv.ParseInt(m[6], 10, 64)
+	return &replayRequest{time: t, user: m[2], method: m[3], uri: m[4], status: status, bodySize: size}
+}
+
+// parseAccessLine parses a line of an access log, returning nil if it is not an accepted action
+func parseAccessLine(line string) *replayRequest {
+	m := accessLogRe.FindStringSubmatch(line)
+	if m == nil {
+		return nil
+	}
+	t, err := parseLogTime(m[1])
+	if err != nil {
+		return nil
+	}
+	return &replayRequest{time: t, user: m[5], method: accessLogMethods[m[2]], uri: m[3] + "/" + m[4], status: 200, bodySize: -1}
+}
+
+// readReplayLog reads the requests of a log file with the line parser
+func readReplayLog(file string, parse func(line string) *replayRequest) ([]replayRequest, int, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+	requests := []replayRequest{}
+	skipped := 0
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if r := parse(scanner.Text()); r != nil {
+			requests = append(requests, *r)
+		} else {
+			skipped++
+		}
+	}
+	return requests, skipped, scanner.Err()
+}
+
+// replayNoRepoApis are the REST APIs whose path has no repo after api/<type>/
+var replayNoRepoApis = map[string]bool{
+	"build":       true,
+	"builds":      true,
+	"plugins":     true,
+	"search":      true,
+	"security":    true,
+	"storageinfo": true,
+	"system":      true,
+	"tasks":       true,
+	"versions":    true,
+}
+
+// replayRepoSegment returns the index of the repo among the segments of a URI
+// path, -1 when it has none: an artifact path starts with its repo, and the
+// REST APIs take it after api/<type>/, like api/storage/<repo> or api/npm/<repo>
+func replayRepoSegment(segments []string) int {
+	if segments[0] != "api" {
+		return 0
+	}
+	if len(segments) < 3 || replayNoRepoApis[segments[1]] {
+		return -1
+	}
+	return 2
+}
+
+// replayUri returns the URI of the logged request in the DUT, relative to the
+// Artifactory URL, with the repo renamed
+func replayUri(uri string, repoMap map[string]string) string {
+	uri = strings.TrimPrefix(strings.TrimPrefix(uri, "/"), "artifactory/")
+	if len(repoMap) == 0 {
+		return uri
+	}
+	pathPart, query := uri, ""
+	if i := strings.Index(uri, "?"); i >= 0 {
+		pathPart, query = uri[:i], uri[i:]
+	}
+	segments := strings.Split(pathPart, "/")
+	if i := replayRepoSegment(segments); i >= 0 {
+		if to, ok := repoMap[segments[i]]; ok {
+			segments[i] = to
+		}
+	}
+	return strings.Join(segments, "/") + query
+}
+
+// replayOp returns the statistics operation of the request, its method and the
+// REST API or artifact it targets
+func replayOp(method string, uri string) string {
+	if strings.HasPrefix(uri, "api/") {
+		segments := strings.SplitN(strings.SplitN(uri, "?", 2)[0], "/", 3)
+		if len(segments) > 1 {
+			return method + " api/" + segments[1]
+		}
+	}
+	return method + " artifact"
+}
+
+// SimReplay replays the requests of Artifactory request and access logs against
+// the DUT, at their original timing, at a scaled speed or as fast as the
+// workers allow, with the logged repos and users mapped to DUT ones. A replayed
+// request fails when its status differs from the logged one.
+func (s *Simulator) SimReplay(cfg ReplayCfg) error {
+	if cfg.NumWorkers < 1 {
+		cfg.NumWorkers = 1
+	}
+	if len(cfg.Methods) == 0 {
+		cfg.Methods = []string{"GET", "HEAD"}
+	}
+	if cfg.MaxBodySize <= 0 {
+		cfg.MaxBodySize = 10 * 1024 * 1024
+	}
+	factor := 1.0
+	switch cfg.Speed {
+	case "", ReplaySpeedOriginal:
+	case ReplaySpeedScaled:
+		if cfg.ScaleFactor <= 0 {
+			err := fmt.Errorf("scalefactor must be positive")
+			jflog.Error(fmt.Sprintf("replay: %v", err))
+			return err
+		}
+		factor = cfg.ScaleFactor
+	case ReplaySpeedMax:
+		factor = 0
+	default:
+		err := fmt.Errorf("unsupported speed %s", cfg.Speed)
+		jflog.Error(fmt.Sprintf("replay: %v", err))
+		return err
+	}
+	var from, to time.Time
+	var err error
+	if cfg.From != "" {
+		if from, err = time.Parse(time.RFC3339, cfg.From); err != nil {
+			jflog.Error(fmt.Sprintf("replay: invalid from: %v", err))
+			return err
+		}
+	}
+	if cfg.To != "" {
+		if to, err = time.Parse(time.RFC3339, cfg.To); err != nil {
+			jflog.Error(fmt.Sprintf("replay: invalid to: %v", err))
+			return err
+		}
+	}
+	for _, u := range cfg.Users {
+		redact.Register(u.Password)
+		redact.Register(u.AccessToken)
+	}
+
+	requests := []replayRequest{}
+	for _, logs := range []struct {
+		files []string
+		parse func(string) *replayRequest
+	}{{cfg.RequestLogs, parseRequestLine}, {cfg.AccessLogs, parseAccessLine}} {
+		for _, file := range logs.files {
+			read, skipped, err := readReplayLog(file, logs.parse)
+			if err != nil {
+				jflog.Error(fmt.Sprintf("Failed to read log %s : %v", file, err))
+				return err
+			}
+			jflog.Info(fmt.Sprintf("Read %d requests from %s, %d lines skipped", len(read), file, skipped))
+			for _, r := range read {
+				if !containsString(cfg.Methods, r.method) || (!from.IsZero() && r.time.Before(from)) || (!to.IsZero() && r.time.After(to)) {
+					continue
+				}
+				requests = append(requests, r)
+			}
+		}
+	}
+	if len(requests) == 0 {
+		err := fmt.Errorf("no request to replay")
+		jflog.Error(fmt.Sprintf("replay: %v", err))
+		return err
+	}
+	sort.SliceStable(requests, func(i, j int) bool { return requests[i].time.Before(requests[j].time) })
+	jflog.Info(fmt.Sprintf("Replaying %d requests logged from %v to %v", len(requests), requests[0].time, requests[len(requests)-1].time))
+
+	return s.runOnTargets("replay", cfg.TargetCfg, func(ds *DutSet) error {
+		users := map[*Dut]map[string]*jfauth.ServiceDetails{}
+		for _, d := range ds.Duts {
+			users[d] = map[string]*jfauth.ServiceDetails{}
+			for name, u := range cfg.Users {
+				if u.Anonymous {
+					users[d][name] = d.UserDetails("", "", "")
+				} else {
+					users[d][name] = d.UserDetails(u.Username, u.Password, u.AccessToken)
+				}
+			}
+		}
+
+		jobs := make(chan replayRequest, 1024)
+		var workerg sync.WaitGroup
+		workerg.Add(cfg.NumWorkers)
+		for i := 0; i < cfg.NumWorkers; i++ {
+			go func() {
+				defer workerg.Done()
+				for r := range jobs {
+					d := ds.Next()
+					details := d.RtDetail
+					if u, ok := users[d][r.user]; ok {
+						details = u
+					}
+					replaySend(cfg, d, details, r)
+				}
+			}()
+		}
+
+		start := time.Now()
+		var maxLag time.Duration
+		for _, r := range requests {
+			if factor > 0 {
+				due := start.Add(time.Duration(float64(r.time.Sub(requests[0].time)) / factor))
+				if wait := time.Until(due); wait > 0 {
+					time.Sleep(wait)
+				} else if -wait > maxLag {
+					maxLag = -wait
+				}
+			}
+			jobs <- r
+		}
+		close(jobs)
+		workerg.Wait()
+		if maxLag > time.Second {
+			jflog.Warn(fmt.Sprintf("Replay fell behind the logged timing by up to %v, consider more workers", maxLag))
+		}
+		jflog.Info(fmt.Sprintf("Replayed %d requests on DUT(s) %s in %v", len(requests), ds.Names(), time.Since(start)))
+		return nil
+	})
+}
+
+// replaySend sends the logged request to the DUT with the details of its user
+func replaySend(cfg ReplayCfg, d *Dut, details *jfauth.ServiceDetails, r replayRequest) {
+	rec := stats.NewRecorder("replay", d.Name)
+	uri := replayUri(r.uri, cfg.RepoMap)
+	var body []byte
+	if r.method == "PUT" || r.method == "POST" {
+		size := r.bodySize
+		if size < 0 || size > cfg.MaxBodySize {
+			size = cfg.MaxBodySize
+		}
+		body = generator.RandomBytes(generator.NewRand(r.time.UnixNano(), 0), size)
+	}
+	start := time.Now()
+	status, n, err := remoteartifacts.SendRequest(details, r.method, uri, body)
+	if err == nil && status != r.status && !(status/100 == 2 && r.status/100 == 2) {
+		err = fmt.Errorf("%s %s returned %d, logged %d", r.method, uri, status, r.status)
+	}
+	rec.RecordBytes(replayOp(r.method, uri), start, n+int64(len(body)), err)
+	if err != nil {
+		jflog.Debug(fmt.Sprintf("Replay in DUT %s : %v", d.Name, err))
+	}
+}
@@ -0,0 +1,122 @@
+package simulator
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReplayUri(t *testing.T) {
+	repoMap := map[string]string{
+		"npm":      "npm-dut",
+		"docker":   "docker-dut",
+		"libs":     "libs-dut",
+		"storage":  "storage-dut",
+		"artifact": "artifact-dut",
+	}
+	tests := []struct {
+		uri  string
+		want string
+	}{
+		{"/artifactory/libs/org/foo/1.0/foo-1.0.jar", "libs-dut/org/foo/1.0/foo-1.0.jar"},
+		{"/libs/org/foo/1.0/foo-1.0.jar", "libs-dut/org/foo/1.0/foo-1.0.jar"},
+		{"libs", "libs-dut"},
+		{"/other/npm/libs/file", "other/npm/libs/file"},
+		// The API type is kept, only the repo after it renamed
+		{"/artifactory/api/npm/npm/lodash", "api/npm/npm-dut/lodash"},
+		{"/api/npm/other/npm", "api/npm/other/npm"},
+		{"/api/docker/docker/v2/alpine/manifests/latest", "api/docker/docker-dut/v2/alpine/manifests/latest"},
+		{"/api/storage/libs/org/foo?properties", "api/storage/libs-dut/org/foo?properties"},
+		{"/api/storage/npm/libs", "api/storage/npm-dut/libs"},
+		{"/api/repositories/libs", "api/repositories/libs-dut"},
+		{"/api/storage/storage/file", "api/storage/storage-dut/file"},
+		// REST APIs without a repo are left unchanged
+		{"/api/search/artifact?name=foo&repos=libs", "api/search/artifact?name=foo&repos=libs"},
+		{"/api/system/ping", "api/system/ping"},
+		{"/api/npm", "api/npm"},
+		{"/libs/file?libs=npm", "libs-dut/file?libs=npm"},
+	}
+	for _, tt := range tests {
+		if got := replayUri(tt.uri, repoMap); got != tt.want {
+			t.Errorf("replayUri(%q) = %q, want %q", tt.uri, got, tt.want)
+		}
+	}
+	if got := replayUri("/artifactory/api/npm/npm/lodash", nil); got != "api/npm/npm/lodash" {
+		t.Errorf("replayUri() without repo map = %q", got)
+	}
+}
+
+func TestParseRequestLine(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want *replayRequest
+	}{
+		{
+			name: "v7",
+			line: "2021-03-01T10:15:30.123Z|a1b2c3d4e5f6|10.0.0.5|admin|GET|/api/npm/npm/lodash|200|-1|1234|15|npm/7.5.0 node/v15.8.0",
+			want: &replayRequest{time: time.Date(2021, 3, 1, 10, 15, 30, 123000000, time.UTC), user: "admin", method: "GET", uri: "/api/npm/npm/lodash", status: 200, bodySize: -1},
+		},
+		{
+			name: "v7 deploy by anonymous",
+			line: "2021-03-01T10:15:31.000Z|f00|10.0.0.6|anonymous|PUT|/libs/a/b.jar|201|2048|0|40|curl/7.68.0",
+			want: &replayRequest{time: time.Date(2021, 3, 1, 10, 15, 31, 0, time.UTC), user: "anonymous", method: "PUT", uri: "/libs/a/b.jar", status: 201, bodySize: 2048},
+		},
+		{
+			name: "v6",
+			line: "20210301101530|15|REQUEST|10.0.0.5|admin|GET|/libs-release/org/foo/1.0/foo-1.0.jar|HTTP/1.1|200|2048",
+			want: &replayRequest{time: time.Date(2021, 3, 1, 10, 15, 30, 0, time.UTC), user: "admin", method: "GET", uri: "/libs-release/org/foo/1.0/foo-1.0.jar", status: 200, bodySize: 2048},
+		},
+		{
+			name: "v6 not found",
+			line: "20210301101531|3|REQUEST|10.0.0.5|non_authenticated_user|HEAD|/libs/missing.jar|HTTP/1.1|404|0",
+			want: &replayRequest{time: time.Date(2021, 3, 1, 10, 15, 31, 0, time.UTC), user: "non_authenticated_user", method: "HEAD", uri: "/libs/missing.jar", status: 404, bodySize: 0},
+		},
+		{name: "service log", line: "2021-03-01T10:15:30.123Z [jfrt ] [INFO ] [abc] [Main:42] [main] - Artifactory started"},
+		{name: "empty", line: ""},
+		{name: "bad date", line: "2021-13-45T99:99:99.000Z|a|b|admin|GET|/libs/a|200|-1|1|1|ua"},
+	}
+	for _, tt := range tests {
+		got := parseRequestLine(tt.line)
+		if tt.want == nil {
+			if got != nil {
+				t.Errorf("%s: parseRequestLine() = %+v, want nil", tt.name, *got)
+			}
+			continue
+		}
+		if got == nil {
+			t.Errorf("%s: parseRequestLine() = nil, want %+v", tt.name, *tt.want)
+			continue
+		}
+		if !got.time.Equal(tt.want.time) || got.user != tt.want.user || got.method != tt.want.method ||
+			got.uri != tt.want.uri || got.status != tt.want.status || got.bodySize != tt.want.bodySize {
+			t.Errorf("%s: parseRequestLine() = %+v, want %+v", tt.name, *got, *tt.want)
+		}
+	}
+}
+
+func TestParseAccessLine(t *testing.T) {
+	tests := []struct {
+		line   string
+		method string
+		uri    string
+		user   string
+	}{
+		{"2021-03-01 10:15:30,123 [ACCEPTED DOWNLOAD] libs-release:org/foo/1.0/foo-1.0.jar for client : admin / 10.0.0.5.", "GET", "libs-release/org/foo/1.0/foo-1.0.jar", "admin"},
+		{"2021-03-01T10:15:30.123Z [jfrt ] [ACCEPTED DEPLOY] libs:a/b.jar for client : deployer / 10.0.0.6.", "PUT", "libs/a/b.jar", "deployer"},
+		{"2021-03-01T10:15:30.123Z [jfrt ] [ACCEPTED DELETE] libs:a/b.jar for anonymous / 10.0.0.7.", "DELETE", "libs/a/b.jar", "anonymous"},
+		{"2021-03-01T10:15:30.123Z [jfrt ] [DENIED DOWNLOAD] libs:a/b.jar for client : bob / 10.0.0.8.", "", "", ""},
+		{"2021-03-01T10:15:30.123Z [jfrt ] [ACCEPTED LOGIN] admin for client : admin / 10.0.0.8.", "", "", ""},
+	}
+	for _, tt := range tests {
+		got := parseAccessLine(tt.line)
+		if tt.method == "" {
+			if got != nil {
+				t.Errorf("parseAccessLine(%q) = %+v, want nil", tt.line, *got)
+			}
+			continue
+		}
+		if got == nil || got.method != tt.method || got.uri != tt.uri || got.user != tt.user || got.status != 200 {
+			t.Errorf("parseAccessLine(%q) = %+v, want %s %s by %s", tt.line, got, tt.method, tt.uri, tt.user)
+		}
+	}
+}
@@ -0,0 +1,270 @@
+package simulator
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jfrog/jfrog-client-go/artifactory/services"
+	jfauth "github.com/jfrog/jfrog-client-go/auth"
+	jflog "github.com/jfrog/jfrog-client-go/utils/log"
+	"jfrog.com/datasim/generator"
+	"jfrog.com/datasim/remoteartifacts"
+	"jfrog.com/datasim/stats"
+)
+
+// Replication modes
+const (
+	// ReplicationPush replicates a local repo of the reference to a local repo of the DUT
+	ReplicationPush = "push"
+	// ReplicationPull has a remote repo of the DUT replicate a local repo of the reference
+	ReplicationPull = "pull"
+)
+
+// DefaultReplicationRepoKey is the repo of the replication simulation
+const DefaultReplicationRepoKey = "datasim-replication"
+
+// ReplicationCfg configures the replication simulation
+type ReplicationCfg struct {
+	TargetCfg `yaml:",inline"`
+	Enabled   bool   `yaml:"enabled"`
+	Mode      string `yaml:"mode"`
+	// The DUT repo is RepoKey, replicating the RepoKey-<DUT name> repo of the reference
+	RepoKey string `yaml:"repokey"`
+	// EventReplication replicates each deploy, otherwise the replication is triggered after them
+	EventReplication bool   `yaml:"eventreplication"`
+	CronExp          string `yaml:"cronexp"`
+	SyncDeletes      bool   `yaml:"syncdeletes"`
+	SyncProperties   bool   `yaml:"syncproperties"`
+	// Each of the NumRounds rounds deploys NumFiles generated files to the
+	// reference repo, then waits for the DUT repo to converge
+	NumRounds  int                `yaml:"numrounds"`
+	NumFiles   int                `yaml:"numfiles"`
+	NumWorkers int                `yaml:"numworkers"`
+	Seed       int64              `yaml:"seed"`
+	SizeDist   generator.SizeDist `yaml:"sizedist"`
+	// The repos are compared every PollIntervalSecs, for up to TimeoutSecs
+	PollIntervalSecs int `yaml:"pollintervalsecs"`
+	TimeoutSecs      int `yaml:"timeoutsecs"`
+	// MaxCompared bounds the files listed on each side to compare them
+	MaxCompared int `yaml:"maxcompared"`
+}
+
+// replicationSecret returns the user and the secret replication authenticates with
+func replicationSecret(details *jfauth.ServiceDetails) (string, string) {
+	for _, secret := range []string{(*details).GetPassword(), (*details).GetApiKey(), (*details).GetAccessToken()} {
+		if secret != "" {
+			return (*details).GetUser(), secret
+		}
+	}
+	return (*details).GetUser(), ""
+}
+
+// SimReplication simulates the replication of a DR setup between the
+// reference and the DUTs: it configures push or pull replication of
+// simulator-owned repos, deploys files to the reference and measures the
+// time the DUT repos take to converge, comparing the file lists and checksums
+func (s *Simulator) SimReplication(cfg ReplicationCfg) error {
+	if cfg.Mode == "" {
+		cfg.Mode = ReplicationPush
+	}
+	if cfg.Mode != ReplicationPush && cfg.Mode != ReplicationPull {
+		err := fmt.Errorf("unsupported replication mode %s", cfg.Mode)
+		jflog.Error(fmt.Sprintf("replication: %v", err))
+		return err
+	}
+	if cfg.RepoKey == "" {
+		cfg.RepoKey = DefaultReplicationRepoKey
+	}
+	if cfg.CronExp == "" {
+		cfg.CronExp = "0 0 * * * ?"
+	}
+	if cfg.NumRounds < 1 {
+		cfg.NumRounds = 1
+	}
+	if cfg.NumWorkers < 1 {
+		cfg.NumWorkers = 1
+	}
+	if cfg.PollIntervalSecs < 1 {
+		cfg.PollIntervalSecs = 5
+	}
+	if cfg.TimeoutSecs < 1 {
+		cfg.TimeoutSecs = 600
+	}
+	if cfg.MaxCompared < 1 {
+		cfg.MaxCompared = 100000
+	}
+	if err := cfg.SizeDist.Validate(); err != nil {
+		jflog.Error(fmt.Sprintf("replication: %v", err))
+		return err
+	}
+	ref := NewDut("reference", s.RefRtDetail, s.RefRtMgr)
+
+	return s.runOnTargets("replication", cfg.TargetCfg, func(ds *DutSet) error {
+		errs := make(chan error, len(ds.Duts))
+		for _, d := range ds.Duts {
+			go func(d *Dut) {
+				errs <- replicate(cfg, ref, d)
+			}(d)
+		}
+		var err error
+		for range ds.Duts {
+			if e := <-errs; e != nil {
+				err = e
+			}
+		}
+		jflog.Info(fmt.Sprintf("All replication rounds completed on DUT(s) %s", ds.Names()))
+		return err
+	})
+}
+
+// replicate configures the replication of the reference to the DUT and runs the rounds
+func replicate(cfg ReplicationCfg, ref *Dut, d *Dut) error {
+	rec := stats.NewRecorder("replication", d.Name)
+	srcRepo := cfg.RepoKey + "-" + d.Name
+	tgtRepo, listedRepo := cfg.RepoKey, cfg.RepoKey
+	if err := createLocalRepo(ref, srcRepo, "generic"); err != nil {
+		return err
+	}
+
+	params := services.NewCreateReplicationParams()
+	params.CronExp, params.Enabled = cfg.CronExp, true
+	params.EnableEventReplication = cfg.EventReplication
+	params.SyncDeletes, params.SyncProperties = cfg.SyncDeletes, cfg.SyncProperties
+	start := time.Now()
+	var err error
+	switch cfg.Mode {
+	case ReplicationPush:
+		if err := createLocalRepo(d, tgtRepo, "generic"); err != nil {
+			return err
+		}
+		params.RepoKey, params.Url = srcRepo, (*d.RtDetail).GetUrl()+tgtRepo
+		params.Username, params.Password = replicationSecret(d.RtDetail)
+		err = (*ref.RtMgr).CreateReplication(params)
+	case ReplicationPull:
+		// The files pulled by a remote repo are stored in its cache repo
+		listedRepo = tgtRepo + "-cache"
+		repoCfg := remoteartifacts.RepoConfig{
+			Key:         tgtRepo,
+			Rclass:      RepoClassRemote,
+			PackageType: "generic",
+			Description: simRepoDescription,
+			Url:         (*ref.RtDetail).GetUrl() + srcRepo,
+		}
+		repoCfg.Username, repoCfg.Password = replicationSecret(ref.RtDetail)
+		if repo, _ := (*d.RtMgr).GetRepository(tgtRepo); repo != nil && repo.Key == tgtRepo {
+			err = remoteartifacts.UpdateRepository(d.RtDetail, repoCfg)
+		} else {
+			err = remoteartifacts.CreateRepository(d.RtDetail, repoCfg)
+		}
+		if err == nil {
+			params.RepoKey = tgtRepo
+			err = (*d.RtMgr).CreateReplication(params)
+		}
+	}
+	rec.Record("configure-"+cfg.Mode, start, err)
+	if err != nil {
+		jflog.Error(fmt.Sprintf("Failed to configure %s replication of %s to DUT %s : %v", cfg.Mode, srcRepo, d.Name, err))
+		return err
+	}
+	jflog.Info(fmt.Sprintf("Configured %s replication of %s in the reference to %s in DUT %s", cfg.Mode, srcRepo, tgtRepo, d.Name))
+
+	runID := time.Now().Unix()
+	for round := 0; round < cfg.NumRounds; round++ {
+		var size int64
+		start := time.Now()
+		runParallel(cfg.NumWorkers, cfg.NumFiles, func(i int) {
+			rng := generator.NewRand(cfg.Seed, round*cfg.NumFiles+i)
+			data := generator.RandomBytes(rng, cfg.SizeDist.Sample(rng))
+			repoPath := fmt.Sprintf("%s/round-%d-%d/file-%d.bin", srcRepo, runID, round, i)
+			deployStart := time.Now()
+			err := remoteartifacts.UploadArtifact(ref.RtDetail, repoPath, data)
+			rec.RecordBytes("deploy", deployStart, int64(len(data)), err)
+			if err != nil {
+				jflog.Error(fmt.Sprintf("Failed to deploy %s to the reference : %v", repoPath, err))
+			}
+		})
+		jflog.Info(fmt.Sprintf("Deployed round %d of %d files to %s in the reference in %v", round, cfg.NumFiles, srcRepo, time.Since(start)))
+
+		start = time.Now()
+		if !cfg.EventReplication {
+			triggered := ref
+			if cfg.Mode == ReplicationPull {
+				triggered = d
+			}
+			triggerStart := time.Now()
+			err := remoteartifacts.ExecuteReplication(triggered.RtDetail, params.RepoKey)
+			rec.Record("trigger", triggerStart, err)
+			if err != nil {
+				jflog.Error(fmt.Sprintf("Failed to trigger the replication of %s to DUT %s : %v", srcRepo, d.Name, err))
+				continue
+			}
+		}
+		size, err = replicationConverge(cfg, ref, d, srcRepo, listedRepo)
+		rec.Add("converge", time.Since(start), size, err)
+		if err != nil {
+			jflog.Error(fmt.Sprintf("Replication of %s to DUT %s did not converge : %v", srcRepo, d.Name, err))
+			continue
+		}
+		jflog.Info(fmt.Sprintf("Replication of round %d to DUT %s converged in %v", round, d.Name, time.Since(start)))
+	}
+	return nil
+}
+
+// replicationConverge compares the files of the reference repo and the DUT
+// repo until the DUT has all of them with the same checksums, returning the
+// size of the replicated files
+func replicationConverge(cfg ReplicationCfg, ref *Dut, d *Dut, srcRepo string, tgtRepo string) (int64, error) {
+	deadline := time.Now().Add(time.Duration(cfg.TimeoutSecs) * time.Second)
+	for {
+		missing, size, err := replicationDiff(cfg, ref, d, srcRepo, tgtRepo)
+		if err == nil && missing == 0 {
+			return size, nil
+		}
+		if time.Now().After(deadline) {
+			if err == nil {
+				err = fmt.Errorf("%d files missing or different after %ds", missing, cfg.TimeoutSecs)
+			}
+			return size, err
+		}
+		time.Sleep(time.Duration(cfg.PollIntervalSecs) * time.Second)
+	}
+}
+
+// replicationDiff returns the number of files of the reference repo that are
+// missing in the DUT repo or have another checksum, and the size of the files
+func replicationDiff(cfg ReplicationCfg, ref *Dut, d *Dut, srcRepo string, tgtRepo string) (int, int64, error) {
+	var srcFiles, tgtFiles []AqlItem
+	var srcErr, tgtErr error
+	var listg sync.WaitGroup
+	listg.Add(2)
+	go func() {
+		defer listg.Done()
+		srcFiles, srcErr = findItems(ref, srcRepo, "file", cfg.MaxCompared)
+	}()
+	go func() {
+		defer listg.Done()
+		tgtFiles, tgtErr = findItems(d, tgtRepo, "file", cfg.MaxCompared)
+	}()
+	listg.Wait()
+	if srcErr != nil {
+		return 0, 0, fmt.Errorf("reference: %v", srcErr)
+	}
+	if tgtErr != nil {
+		return 0, 0, fmt.Errorf("DUT %s: %v", d.Name, tgtErr)
+	}
+
+	replicated := map[string]string{}
+	for _, f := range tgtFiles {
+		replicated[f.Path+"/"+f.Name] = f.Sha1
+	}
+	missing := 0
+	var size int64
+	for _, f := range srcFiles {
+		if sha1, ok := replicated[f.Path+"/"+f.Name]; !ok || sha1 != f.Sha1 {
+			missing++
+		}
+		size += f.Size
+	}
+	return missing, size, nil
+}
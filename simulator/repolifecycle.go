@@ -0,0 +1,359 @@
+package simulator
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	jflog "github.com/jfrog/jfrog-client-go/utils/log"
+	"jfrog.com/datasim/remoteartifacts"
+	"jfrog.com/datasim/stats"
+)
+
+// Repository classes
+const (
+	RepoClassLocal     = "local"
+	RepoClassRemote    = "remote"
+	RepoClassVirtual   = "virtual"
+	RepoClassFederated = "federated"
+)
+
+// DefaultRepoLifecyclePrefix prefixes the repos of the repo lifecycle simulation
+const DefaultRepoLifecyclePrefix = "datasim-lc"
+
+// DefaultRepoLifecycleRemoteUrl is the URL of the remote repos when none is configured
+const DefaultRepoLifecycleRemoteUrl = "https://repo1.maven.org/maven2/"
+
+// RepoLifecycleCfg configures the repository CRUD lifecycle simulation
+type RepoLifecycleCfg struct {
+	TargetCfg   `yaml:",inline"`
+	Enabled     bool    `yaml:"enabled"`
+	RepoPrefix  string  `yaml:"repoprefix"`
+	PackageType string  `yaml:"packagetype"`
+	RemoteUrl   string  `yaml:"remoteurl"`
+	RatePerSec  float64 `yaml:"ratepersec"`
+	// The simulation stops after DurationSecs or NumOps, whichever comes first
+	DurationSecs int `yaml:"durationsecs"`
+	NumOps       int `yaml:"numops"`
+	NumWorkers   int `yaml:"numworkers"`
+	// Once MaxRepos repos exist, creates are turned into deletes
+	MaxRepos int `yaml:"maxrepos"`
+	// CleanUp deletes the remaining repos at the end of the simulation
+	CleanUp bool `yaml:"cleanup"`
+	Mix     struct {
+		Create int `yaml:"create"`
+		Update int `yaml:"update"`
+		List   int `yaml:"list"`
+		Delete int `yaml:"delete"`
+	} `yaml:"mix"`
+	RepoClasses struct {
+		Local     int `yaml:"local"`
+		Remote    int `yaml:"remote"`
+		Virtual   int `yaml:"virtual"`
+		Federated int `yaml:"federated"`
+	} `yaml:"repoclasses"`
+}
+
+// Operations of the repo lifecycle simulation, indexes of the mix weights
+const (
+	repoOpCreate = iota
+	repoOpUpdate
+	repoOpList
+	repoOpDelete
+)
+
+var repoClasses = []string{RepoClassLocal, RepoClassRemote, RepoClassVirtual, RepoClassFederated}
+
+// repoLifecycleState tracks the repos the simulation owns in a set of DUTs,
+// the nodes of one cluster sharing their repos
+type repoLifecycleState struct {
+	mu    sync.Mutex
+	repos map[string]string
+	// deleting are the repos being deleted, which are not picked again
+	deleting map[string]bool
+	seq      int
+}
+
+// newRepoLifecycleState loads the repos of a previous run starting with prefix.
+// The class is taken from the key, as the repos list does not report it.
+func newRepoLifecycleState(d *Dut, prefix string) (*repoLifecycleState, error) {
+	keys, err := listSimRepos(d, prefix+"-")
+	if err != nil {
+		return nil, err
+	}
+	state := &repoLifecycleState{repos: map[string]string{}, deleting: map[string]bool{}, seq: int(time.Now().Unix())}
+	for _, key := range keys {
+		for _, class := range repoClasses {
+			if strings.HasPrefix(key, prefix+"-"+class+"-") {
+				state.repos[key] = class
+			}
+		}
+	}
+	return state, nil
+}
+
+// nextKey returns a new repo key of the class
+func (rs *repoLifecycleState) nextKey(prefix string, class string) string {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.seq++
+	return fmt.Sprintf("%s-%s-%d", prefix, class, rs.seq)
+}
+
+// keys returns the sorted owned repos not being deleted, of one of the
+// classes when given
+func (rs *repoLifecycleState) keys(classes ...string) []string {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	keys := []string{}
+	for k, c := range rs.repos {
+		if !rs.deleting[k] && (len(classes) == 0 || containsString(classes, c)) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// pick returns a random owned repo, of one of the classes when given. With
+// remove set, the repo is marked as being deleted until done is called.
+func (rs *repoLifecycleState) pick(rng *rand.Rand, remove bool, classes ...string) (string, string) {
+	keys := rs.keys(classes...)
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	for len(keys) > 0 {
+		i := rng.Intn(len(keys))
+		key := keys[i]
+		// Another worker may have picked it for deletion meanwhile
+		if class, ok := rs.repos[key]; ok && !rs.deleting[key] {
+			if remove {
+				rs.deleting[key] = true
+			}
+			return key, class
+		}
+		keys = append(keys[:i], keys[i+1:]...)
+	}
+	return "", ""
+}
+
+// done ends the deletion of the repo, which is kept in the state when the
+// deletion failed, to be deleted again later
+func (rs *repoLifecycleState) done(key string, deleted bool) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	delete(rs.deleting, key)
+	if deleted {
+		delete(rs.repos, key)
+	}
+}
+
+// pickMany returns up to n random owned repos of one of the classes
+func (rs *repoLifecycleState) pickMany(rng *rand.Rand, n int, classes ...string) []string {
+	picked := []string{}
+	for i := 0; i < n; i++ {
+		key, _ := rs.pick(rng, false, classes...)
+		if key != "" && !containsString(picked, key) {
+			picked = append(picked, key)
+		}
+	}
+	return picked
+}
+
+func (rs *repoLifecycleState) add(key string, class string) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.repos[key] = class
+}
+
+func (rs *repoLifecycleState) count() int {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	return len(rs.repos)
+}
+
+func containsString(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
+// SimRepoLifecycle simulates repository configuration changes by creating,
+// updating, listing and deleting repos of every class at the configured rate.
+// Only repos whose key starts with the prefix are touched.
+func (s *Simulator) SimRepoLifecycle(cfg RepoLifecycleCfg) error {
+	if cfg.RepoPrefix == "" {
+		cfg.RepoPrefix = DefaultRepoLifecyclePrefix
+	}
+	if cfg.PackageType == "" {
+		cfg.PackageType = "generic"
+	}
+	if cfg.RemoteUrl == "" {
+		cfg.RemoteUrl = DefaultRepoLifecycleRemoteUrl
+	}
+	if cfg.NumWorkers < 1 {
+		cfg.NumWorkers = 1
+	}
+	if cfg.DurationSecs <= 0 && cfg.NumOps <= 0 {
+		err := fmt.Errorf("durationsecs or numops must be set")
+		jflog.Error(fmt.Sprintf("repolifecycle: %v", err))
+		return err
+	}
+	opWeights := []int{cfg.Mix.Create, cfg.Mix.Update, cfg.Mix.List, cfg.Mix.Delete}
+	classWeights := []int{cfg.RepoClasses.Local, cfg.RepoClasses.Remote, cfg.RepoClasses.Virtual, cfg.RepoClasses.Federated}
+	totalOpWeight, totalClassWeight := sumInts(opWeights), sumInts(classWeights)
+	if totalOpWeight == 0 {
+		opWeights, totalOpWeight = []int{1, 1, 1, 1}, 4
+	}
+	if totalClassWeight == 0 {
+		classWeights, totalClassWeight = []int{1, 0, 0, 0}, 1
+	}
+
+	return s.runOnTargets("repolifecycle", cfg.TargetCfg, func(ds *DutSet) error {
+		// The DUTs of the set are nodes of one cluster, which share one state
+		state, err := newRepoLifecycleState(ds.Duts[0], cfg.RepoPrefix)
+		if err != nil {
+			jflog.Error(fmt.Sprintf("Failed listing repos of DUT %s : %v", ds.Duts[0].Name, err))
+			return err
+		}
+
+		ticks := rateTicks(cfg.RatePerSec, cfg.DurationSecs, cfg.NumOps)
+		var workerg sync.WaitGroup
+		workerg.Add(cfg.NumWorkers)
+		for i := 0; i < cfg.NumWorkers; i++ {
+			go func(wnum int) {
+				defer workerg.Done()
+				rng := rand.New(rand.NewSource(time.Now().UnixNano() + int64(wnum)))
+				for range ticks {
+					d := ds.Next()
+					op := pickWeighted(rng, opWeights, totalOpWeight)
+					if op == repoOpCreate && cfg.MaxRepos > 0 && state.count() >= cfg.MaxRepos {
+						op = repoOpDelete
+					}
+					switch op {
+					case repoOpCreate:
+						class := repoClasses[pickWeighted(rng, classWeights, totalClassWeight)]
+						lifecycleCreate(cfg, d, state, rng, class)
+					case repoOpUpdate:
+						lifecycleUpdate(cfg, d, state, rng)
+					case repoOpList:
+						lifecycleList(d)
+					case repoOpDelete:
+						lifecycleDelete(d, state, rng)
+					}
+				}
+			}(i)
+		}
+		workerg.Wait()
+
+		jflog.Info(fmt.Sprintf("All repolifecycle workers completed on DUT(s) %s", ds.Names()))
+		if cfg.CleanUp {
+			// Virtual repos go first so that no repo is deleted while aggregated
+			for _, classes := range [][]string{{RepoClassVirtual}, {RepoClassLocal, RepoClassRemote, RepoClassFederated}} {
+				for _, key := range state.keys(classes...) {
+					d := ds.Next()
+					err := (*d.RtMgr).DeleteRepository(key)
+					if err != nil {
+						jflog.Error(fmt.Sprintf("Failed to delete repo %s in DUT %s : %v", key, d.Name, err))
+					}
+					state.done(key, err == nil)
+				}
+			}
+			if left := state.keys(); len(left) > 0 {
+				err := fmt.Errorf("%d repos left after the clean up: %s", len(left), strings.Join(left, ", "))
+				jflog.Error(fmt.Sprintf("repolifecycle on DUT(s) %s : %v", ds.Names(), err))
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func sumInts(values []int) int {
+	sum := 0
+	for _, v := range values {
+		sum += v
+	}
+	return sum
+}
+
+// lifecycleRepoConfig returns the configuration of an owned repo of the class
+func lifecycleRepoConfig(cfg RepoLifecycleCfg, d *Dut, state *repoLifecycleState, rng *rand.Rand, key string, class string) remoteartifacts.RepoConfig {
+	repoCfg := remoteartifacts.RepoConfig{
+		Key:         key,
+		Rclass:      class,
+		PackageType: cfg.PackageType,
+		Description: simRepoDescription,
+		Notes:       fmt.Sprintf("Configured at %s", time.Now().Format(time.RFC3339Nano)),
+	}
+	switch class {
+	case RepoClassRemote:
+		repoCfg.Url = cfg.RemoteUrl
+	case RepoClassVirtual:
+		repoCfg.Repositories = state.pickMany(rng, 3, RepoClassLocal, RepoClassRemote)
+	case RepoClassFederated:
+		repoCfg.Members = []remoteartifacts.FederatedMember{{Url: (*d.RtDetail).GetUrl() + key, Enabled: true}}
+	}
+	return repoCfg
+}
+
+// lifecycleCreate creates a repo of the class
+func lifecycleCreate(cfg RepoLifecycleCfg, d *Dut, state *repoLifecycleState, rng *rand.Rand, class string) {
+	rec := stats.NewRecorder("repolifecycle", d.Name)
+	key := state.nextKey(cfg.RepoPrefix, class)
+	start := time.Now()
+	err := remoteartifacts.CreateRepository(d.RtDetail, lifecycleRepoConfig(cfg, d, state, rng, key, class))
+	rec.Record("create-"+class, start, err)
+	if err != nil {
+		jflog.Error(fmt.Sprintf("Failed to create %s repo %s in DUT %s : %v", class, key, d.Name, err))
+		return
+	}
+	state.add(key, class)
+}
+
+// lifecycleUpdate updates the configuration of an owned repo
+func lifecycleUpdate(cfg RepoLifecycleCfg, d *Dut, state *repoLifecycleState, rng *rand.Rand) {
+	key, class := state.pick(rng, false)
+	if key == "" {
+		return
+	}
+	rec := stats.NewRecorder("repolifecycle", d.Name)
+	start := time.Now()
+	err := remoteartifacts.UpdateRepository(d.RtDetail, lifecycleRepoConfig(cfg, d, state, rng, key, class))
+	rec.Record("update-"+class, start, err)
+	if err != nil {
+		jflog.Error(fmt.Sprintf("Failed to update %s repo %s in DUT %s : %v", class, key, d.Name, err))
+	}
+}
+
+// lifecycleList lists all the repos of the DUT
+func lifecycleList(d *Dut) {
+	rec := stats.NewRecorder("repolifecycle", d.Name)
+	start := time.Now()
+	_, err := (*d.RtMgr).GetAllRepositories()
+	rec.Record("list", start, err)
+	if err != nil {
+		jflog.Error(fmt.Sprintf("Failed to list repos in DUT %s : %v", d.Name, err))
+	}
+}
+
+// lifecycleDelete deletes an owned repo, which stays owned when it fails
+func lifecycleDelete(d *Dut, state *repoLifecycleState, rng *rand.Rand) {
+	key, class := state.pick(rng, true)
+	if key == "" {
+		return
+	}
+	rec := stats.NewRecorder("repolifecycle", d.Name)
+	start := time.Now()
+	err := (*d.RtMgr).DeleteRepository(key)
+	rec.Record("delete-"+class, start, err)
+	if err != nil {
+		jflog.Error(fmt.Sprintf("Failed to delete %s repo %s in DUT %s, keeping it to retry : %v", class, key, d.Name, err))
+	}
+	state.done(key, err == nil)
+}
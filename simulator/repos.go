@@ -0,0 +1,78 @@
+package simulator
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jfrog/jfrog-client-go/artifactory/services"
+	jflog "github.com/jfrog/jfrog-client-go/utils/log"
+)
+
+// simRepoDescription marks the repos created by the simulator
+const simRepoDescription = "A repository created by the data simulator"
+
+// createLocalRepo creates a local repo of the package type in the DUT, unless
+// a repo with the same key is already present
+func createLocalRepo(d *Dut, key string, packageType string) error {
+	if repo, _ := (*d.RtMgr).GetRepository(key); repo != nil && repo.Key == key {
+		jflog.Info(fmt.Sprintf("Local repo %s is present in DUT %s", key, d.Name))
+		return nil
+	}
+
+	var err error
+	xrayIndex := &[]bool{true}[0]
+	switch packageType {
+	case "", "generic":
+		params := services.NewGenericLocalRepositoryParams()
+		params.Key, params.Description, params.XrayIndex = key, simRepoDescription, xrayIndex
+		err = (*d.RtMgr).CreateLocalRepository().Generic(params)
+	case "maven":
+		params := services.NewMavenLocalRepositoryParams()
+		params.Key, params.Description, params.XrayIndex = key, simRepoDescription, xrayIndex
+		err = (*d.RtMgr).CreateLocalRepository().Maven(params)
+	case "npm":
+		params := services.NewNpmLocalRepositoryParams()
+		params.Key, params.Description, params.XrayIndex = key, simRepoDescription, xrayIndex
+		err = (*d.RtMgr).CreateLocalRepository().Npm(params)
+	case "pypi":
+		params := services.NewPypiLocalRepositoryParams()
+		params.Key, params.Description, params.XrayIndex = key, simRepoDescription, xrayIndex
+		err = (*d.RtMgr).CreateLocalRepository().Pypi(params)
+	case "debian":
+		params := services.NewDebianLocalRepositoryParams()
+		params.Key, params.Description, params.XrayIndex = key, simRepoDescription, xrayIndex
+		err = (*d.RtMgr).CreateLocalRepository().Debian(params)
+	case "helm":
+		params := services.NewHelmLocalRepositoryParams()
+		params.Key, params.Description, params.XrayIndex = key, simRepoDescription, xrayIndex
+		err = (*d.RtMgr).CreateLocalRepository().Helm(params)
+	case "docker":
+		params := services.NewDockerLocalRepositoryParams()
+		params.Key, params.Description, params.XrayIndex = key, simRepoDescription, xrayIndex
+		err = (*d.RtMgr).CreateLocalRepository().Docker(params)
+	default:
+		return fmt.Errorf("unsupported local repo package type %s", packageType)
+	}
+	if err != nil {
+		jflog.Error(fmt.Sprintf("Failed to create %s local repo %s in DUT %s", packageType, key, d.Name))
+		return err
+	}
+	jflog.Info(fmt.Sprintf("Created %s local repo %s in DUT %s", packageType, key, d.Name))
+	return nil
+}
+
+// listSimRepos returns the keys of the repos in the DUT starting with prefix,
+// which are the ones a simulation created and is allowed to modify
+func listSimRepos(d *Dut, prefix string) ([]string, error) {
+	repos, err := (*d.RtMgr).GetAllRepositories()
+	if err != nil {
+		return nil, err
+	}
+	keys := []string{}
+	for _, r := range *repos {
+		if strings.HasPrefix(r.Key, prefix) {
+			keys = append(keys, r.Key)
+		}
+	}
+	return keys, nil
+}
@@ -0,0 +1,429 @@
+package simulator
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/jfrog/jfrog-client-go/artifactory/services"
+	jflog "github.com/jfrog/jfrog-client-go/utils/log"
+	"jfrog.com/datasim/redact"
+	"jfrog.com/datasim/remoteartifacts"
+	"jfrog.com/datasim/stats"
+)
+
+// DefaultSecurityPrefix prefixes the users, groups and permission targets of the security simulation
+const DefaultSecurityPrefix = "datasim-sec"
+
+// DefaultSecurityPassword is the password of the simulated users when none is configured
+const DefaultSecurityPassword = "DataSim-Passw0rd1"
+
+// SecurityCfg configures the users, groups and permission targets simulation
+type SecurityCfg struct {
+	TargetCfg `yaml:",inline"`
+	Enabled   bool   `yaml:"enabled"`
+	Prefix    string `yaml:"prefix"`
+	Password  string `yaml:"password"`
+	// The permission targets grant access to the repos starting with RepoPrefix
+	RepoPrefix     string `yaml:"repoprefix"`
+	NumUsers       int    `yaml:"numusers"`
+	NumGroups      int    `yaml:"numgroups"`
+	NumPermissions int    `yaml:"numpermissions"`
+	GroupsPerUser  int    `yaml:"groupsperuser"`
+	// Each permission target covers ReposPerPermission repos, granted to
+	// GroupsPerPermission groups and UsersPerPermission users directly
+	ReposPerPermission  int `yaml:"reposperpermission"`
+	GroupsPerPermission int `yaml:"groupsperpermission"`
+	UsersPerPermission  int `yaml:"usersperpermission"`
+	// FilesPerRepo files of each repo are candidates for the downloads
+	FilesPerRepo int     `yaml:"filesperrepo"`
+	NumWorkers   int     `yaml:"numworkers"`
+	RatePerSec   float64 `yaml:"ratepersec"`
+	// The load stops after DurationSecs or NumOps, whichever comes first
+	DurationSecs int `yaml:"durationsecs"`
+	NumOps       int `yaml:"numops"`
+	// CleanUp deletes the users, groups and permission targets at the end of the simulation
+	CleanUp bool `yaml:"cleanup"`
+	Mix     struct {
+		Download         int `yaml:"download"`
+		DeniedDownload   int `yaml:"denieddownload"`
+		UpdateUser       int `yaml:"updateuser"`
+		UpdateGroup      int `yaml:"updategroup"`
+		UpdatePermission int `yaml:"updatepermission"`
+	} `yaml:"mix"`
+}
+
+// Operations of the security simulation, indexes of the mix weights
+const (
+	secOpDownload = iota
+	secOpDeniedDownload
+	secOpUpdateUser
+	secOpUpdateGroup
+	secOpUpdatePermission
+)
+
+// securityModel is the users, groups and permission targets of the simulation
+// in a DUT, assigned deterministically so that a rerun finds the same ones
+type securityModel struct {
+	cfg   SecurityCfg
+	repos []string
+	// files of each repo, and repos each user can read
+	files     map[string][]AqlItem
+	userRepos [][]string
+}
+
+func (sm *securityModel) userName(n int) string {
+	return fmt.Sprintf("%s-user-%d", sm.cfg.Prefix, n)
+}
+
+func (sm *securityModel) groupName(n int) string {
+	return fmt.Sprintf("%s-group-%d", sm.cfg.Prefix, n)
+}
+
+func (sm *securityModel) permissionName(n int) string {
+	return fmt.Sprintf("%s-perm-%d", sm.cfg.Prefix, n)
+}
+
+// spread returns count indexes below n starting at the slot-th block of count
+func spread(slot int, count int, n int) []int {
+	indexes := []int{}
+	for k := 0; k < count && k < n; k++ {
+		indexes = append(indexes, (slot*count+k)%n)
+	}
+	return indexes
+}
+
+// user returns the details of the n-th user
+func (sm *securityModel) user(n int, email string) services.User {
+	groups := []string{}
+	for _, g := range spread(n, sm.cfg.GroupsPerUser, sm.cfg.NumGroups) {
+		groups = append(groups, sm.groupName(g))
+	}
+	return services.User{Name: sm.userName(n), Email: email, Password: sm.cfg.Password, Groups: groups}
+}
+
+// permission returns the n-th permission target, granting read to its groups
+// and read, write and annotate to its users
+func (sm *securityModel) permission(n int) services.PermissionTargetParams {
+	params := services.NewPermissionTargetParams()
+	params.Name = sm.permissionName(n)
+	params.Repo.Repositories = []string{}
+	for _, r := range spread(n, sm.cfg.ReposPerPermission, len(sm.repos)) {
+		params.Repo.Repositories = append(params.Repo.Repositories, sm.repos[r])
+	}
+	params.Repo.IncludePatterns = []string{"**"}
+	params.Repo.Actions.Groups = map[string][]string{}
+	for _, g := range spread(n, sm.cfg.GroupsPerPermission, sm.cfg.NumGroups) {
+		params.Repo.Actions.Groups[sm.groupName(g)] = []string{"read"}
+	}
+	params.Repo.Actions.Users = map[string][]string{}
+	for _, u := range spread(n, sm.cfg.UsersPerPermission, sm.cfg.NumUsers) {
+		params.Repo.Actions.Users[sm.userName(u)] = []string{"read", "write", "annotate"}
+	}
+	return params
+}
+
+// computeAccess computes the repos each user can read through its groups and
+// the direct grants of the permission targets
+func (sm *securityModel) computeAccess() {
+	groupRepos := make([][]string, sm.cfg.NumGroups)
+	sm.userRepos = make([][]string, sm.cfg.NumUsers)
+	for p := 0; p < sm.cfg.NumPermissions; p++ {
+		params := sm.permission(p)
+		for _, g := range spread(p, sm.cfg.GroupsPerPermission, sm.cfg.NumGroups) {
+			groupRepos[g] = append(groupRepos[g], params.Repo.Repositories...)
+		}
+		for _, u := range spread(p, sm.cfg.UsersPerPermission, sm.cfg.NumUsers) {
+			sm.userRepos[u] = append(sm.userRepos[u], params.Repo.Repositories...)
+		}
+	}
+	for u := 0; u < sm.cfg.NumUsers; u++ {
+		for _, g := range spread(u, sm.cfg.GroupsPerUser, sm.cfg.NumGroups) {
+			sm.userRepos[u] = append(sm.userRepos[u], groupRepos[g]...)
+		}
+		readable := []string{}
+		for _, r := range sm.userRepos[u] {
+			if len(sm.files[r]) > 0 && !containsString(readable, r) {
+				readable = append(readable, r)
+			}
+		}
+		sm.userRepos[u] = readable
+	}
+}
+
+// runParallel calls fn with 0 to n-1 from numWorkers goroutines
+func runParallel(numWorkers int, n int, fn func(i int)) {
+	jobs := make(chan int)
+	var workerg sync.WaitGroup
+	workerg.Add(numWorkers)
+	for w := 0; w < numWorkers; w++ {
+		go func() {
+			defer workerg.Done()
+			for i := range jobs {
+				fn(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		jobs <- i
+	}
+	close(jobs)
+	workerg.Wait()
+}
+
+// SimSecurity simulates the security entities of a large organization: it
+// creates users, groups and permission targets on the simulator repos, then
+// downloads files as those users, so that the permission evaluation is part of
+// the load, while updating the entities at the configured mix
+func (s *Simulator) SimSecurity(cfg SecurityCfg) error {
+	if cfg.Prefix == "" {
+		cfg.Prefix = DefaultSecurityPrefix
+	}
+	if cfg.Password == "" {
+		cfg.Password = DefaultSecurityPassword
+	}
+	redact.Register(cfg.Password)
+	if cfg.RepoPrefix == "" {
+		cfg.RepoPrefix = DefaultUploadRepoPrefix
+	}
+	if cfg.NumUsers < 1 {
+		cfg.NumUsers = 1
+	}
+	if cfg.NumGroups < 1 {
+		cfg.NumGroups = 1
+	}
+	if cfg.NumPermissions < 1 {
+		cfg.NumPermissions = 1
+	}
+	for _, v := range []*int{&cfg.GroupsPerUser, &cfg.ReposPerPermission, &cfg.GroupsPerPermission} {
+		if *v < 1 {
+			*v = 1
+		}
+	}
+	if cfg.FilesPerRepo < 1 {
+		cfg.FilesPerRepo = 100
+	}
+	if cfg.NumWorkers < 1 {
+		cfg.NumWorkers = 1
+	}
+	weights := []int{cfg.Mix.Download, cfg.Mix.DeniedDownload, cfg.Mix.UpdateUser, cfg.Mix.UpdateGroup, cfg.Mix.UpdatePermission}
+	totalWeight := sumInts(weights)
+	if totalWeight == 0 {
+		weights, totalWeight = []int{1, 0, 0, 0, 0}, 1
+	}
+
+	return s.runOnTargets("security", cfg.TargetCfg, func(ds *DutSet) error {
+		models := map[*Dut]*securityModel{}
+		for _, d := range ds.Duts {
+			repos, err := listSimRepos(d, cfg.RepoPrefix)
+			if err != nil {
+				jflog.Error(fmt.Sprintf("Failed listing repos of DUT %s : %v", d.Name, err))
+				return err
+			}
+			if len(repos) == 0 {
+				err := fmt.Errorf("no repo starting with %s in DUT %s", cfg.RepoPrefix, d.Name)
+				jflog.Error(fmt.Sprintf("security: %v", err))
+				return err
+			}
+			sm := &securityModel{cfg: cfg, repos: repos, files: map[string][]AqlItem{}}
+			for _, repo := range repos {
+				if sm.files[repo], err = findItems(d, repo, "file", cfg.FilesPerRepo); err != nil {
+					jflog.Error(fmt.Sprintf("Failed to find items of repo %s in DUT %s : %v", repo, d.Name, err))
+					return err
+				}
+			}
+			sm.computeAccess()
+			models[d] = sm
+
+			// Groups first, as the users join them, then the permission targets granting both
+			start := time.Now()
+			runParallel(cfg.NumWorkers, cfg.NumGroups, func(i int) { securityCreateGroup(d, sm, i) })
+			runParallel(cfg.NumWorkers, cfg.NumUsers, func(i int) { securityCreateUser(d, sm, i) })
+			runParallel(cfg.NumWorkers, cfg.NumPermissions, func(i int) { securityCreatePermission(d, sm, i) })
+			jflog.Info(fmt.Sprintf("Created %d users, %d groups and %d permission targets in DUT %s in %v",
+				cfg.NumUsers, cfg.NumGroups, cfg.NumPermissions, d.Name, time.Since(start)))
+		}
+
+		if cfg.DurationSecs > 0 || cfg.NumOps > 0 {
+			ticks := rateTicks(cfg.RatePerSec, cfg.DurationSecs, cfg.NumOps)
+			var workerg sync.WaitGroup
+			workerg.Add(cfg.NumWorkers)
+			for i := 0; i < cfg.NumWorkers; i++ {
+				go func(wnum int) {
+					defer workerg.Done()
+					rng := rand.New(rand.NewSource(time.Now().UnixNano() + int64(wnum)))
+					for range ticks {
+						d := ds.Next()
+						sm := models[d]
+						switch pickWeighted(rng, weights, totalWeight) {
+						case secOpDownload:
+							securityDownload(d, sm, rng, false)
+						case secOpDeniedDownload:
+							securityDownload(d, sm, rng, true)
+						case secOpUpdateUser:
+							securityUpdateUser(d, sm, rng.Intn(cfg.NumUsers))
+						case secOpUpdateGroup:
+							securityUpdateGroup(d, sm, rng.Intn(cfg.NumGroups))
+						case secOpUpdatePermission:
+							securityUpdatePermission(d, sm, rng.Intn(cfg.NumPermissions))
+						}
+					}
+				}(i)
+			}
+			workerg.Wait()
+		}
+
+		if cfg.CleanUp {
+			for _, d := range ds.Duts {
+				securityCleanUp(d, models[d])
+			}
+		}
+		jflog.Info(fmt.Sprintf("All security workers completed on DUT(s) %s", ds.Names()))
+		return nil
+	})
+}
+
+// securityCreateGroup creates or replaces the n-th group
+func securityCreateGroup(d *Dut, sm *securityModel, n int) {
+	rec := stats.NewRecorder("security", d.Name)
+	params := services.NewGroupParams()
+	params.GroupDetails = services.Group{Name: sm.groupName(n), Description: "A group created by the data simulator"}
+	params.ReplaceIfExists = true
+	start := time.Now()
+	err := (*d.RtMgr).CreateGroup(params)
+	rec.Record("create-group", start, err)
+	if err != nil {
+		jflog.Error(fmt.Sprintf("Failed to create group %s in DUT %s : %v", params.GroupDetails.Name, d.Name, err))
+	}
+}
+
+// securityCreateUser creates or replaces the n-th user
+func securityCreateUser(d *Dut, sm *securityModel, n int) {
+	rec := stats.NewRecorder("security", d.Name)
+	params := services.NewUserParams()
+	params.UserDetails = sm.user(n, sm.userName(n)+"@datasim.local")
+	params.ReplaceIfExists = true
+	start := time.Now()
+	err := (*d.RtMgr).CreateUser(params)
+	rec.Record("create-user", start, err)
+	if err != nil {
+		jflog.Error(fmt.Sprintf("Failed to create user %s in DUT %s : %v", params.UserDetails.Name, d.Name, err))
+	}
+}
+
+// securityCreatePermission creates the n-th permission target, replacing it
+// when it exists
+func securityCreatePermission(d *Dut, sm *securityModel, n int) {
+	rec := stats.NewRecorder("security", d.Name)
+	params := sm.permission(n)
+	start := time.Now()
+	err := (*d.RtMgr).CreatePermissionTarget(params)
+	if remoteartifacts.IsConflict(err) {
+		err = (*d.RtMgr).UpdatePermissionTarget(params)
+	}
+	rec.Record("create-permission", start, err)
+	if err != nil {
+		jflog.Error(fmt.Sprintf("Failed to create permission target %s in DUT %s : %v", params.Name, d.Name, err))
+	}
+}
+
+// securityDownload downloads a file as a random user, from a repo it can read,
+// or from one it cannot when denied is set, in which case the download must fail
+func securityDownload(d *Dut, sm *securityModel, rng *rand.Rand, denied bool) {
+	u := rng.Intn(sm.cfg.NumUsers)
+	repos := sm.userRepos[u]
+	op := "download"
+	if denied {
+		op = "download-denied"
+		repos = []string{}
+		for repo, files := range sm.files {
+			if len(files) > 0 && !containsString(sm.userRepos[u], repo) {
+				repos = append(repos, repo)
+			}
+		}
+	}
+	if len(repos) == 0 {
+		return
+	}
+	files := sm.files[repos[rng.Intn(len(repos))]]
+	item := files[rng.Intn(len(files))]
+
+	rec := stats.NewRecorder("security", d.Name)
+	start := time.Now()
+	n, err := remoteartifacts.FetchUri(d.UserDetails(sm.userName(u), sm.cfg.Password, ""), item.RepoPath())
+	if denied {
+		if err == nil {
+			err = fmt.Errorf("user %s read %s without permission", sm.userName(u), item.RepoPath())
+		} else if remoteartifacts.IsForbidden(err) || remoteartifacts.IsNotFound(err) {
+			err = nil
+		}
+	}
+	rec.RecordBytes(op, start, n, err)
+	if err != nil {
+		jflog.Error(fmt.Sprintf("Failed %s of %s as %s in DUT %s : %v", op, item.RepoPath(), sm.userName(u), d.Name, err))
+	}
+}
+
+// securityUpdateUser updates the email of the n-th user, keeping its groups
+func securityUpdateUser(d *Dut, sm *securityModel, n int) {
+	rec := stats.NewRecorder("security", d.Name)
+	params := services.NewUserParams()
+	params.UserDetails = sm.user(n, fmt.Sprintf("%s+%d@datasim.local", sm.userName(n), time.Now().UnixNano()))
+	start := time.Now()
+	err := (*d.RtMgr).UpdateUser(params)
+	rec.Record("update-user", start, err)
+	if err != nil {
+		jflog.Error(fmt.Sprintf("Failed to update user %s in DUT %s : %v", params.UserDetails.Name, d.Name, err))
+	}
+}
+
+// securityUpdateGroup updates the description of the n-th group
+func securityUpdateGroup(d *Dut, sm *securityModel, n int) {
+	rec := stats.NewRecorder("security", d.Name)
+	params := services.NewGroupParams()
+	params.GroupDetails = services.Group{Name: sm.groupName(n), Description: fmt.Sprintf("Updated by the data simulator at %s", time.Now().Format(time.RFC3339Nano))}
+	start := time.Now()
+	err := (*d.RtMgr).UpdateGroup(params)
+	rec.Record("update-group", start, err)
+	if err != nil {
+		jflog.Error(fmt.Sprintf("Failed to update group %s in DUT %s : %v", params.GroupDetails.Name, d.Name, err))
+	}
+}
+
+// securityUpdatePermission replaces the n-th permission target with the same
+// grants, which invalidates the permission caches of the DUT
+func securityUpdatePermission(d *Dut, sm *securityModel, n int) {
+	rec := stats.NewRecorder("security", d.Name)
+	params := sm.permission(n)
+	start := time.Now()
+	err := (*d.RtMgr).UpdatePermissionTarget(params)
+	rec.Record("update-permission", start, err)
+	if err != nil {
+		jflog.Error(fmt.Sprintf("Failed to update permission target %s in DUT %s : %v", params.Name, d.Name, err))
+	}
+}
+
+// securityCleanUp deletes the permission targets, users and groups of the simulation
+func securityCleanUp(d *Dut, sm *securityModel) {
+	rec := stats.NewRecorder("security", d.Name)
+	for _, entity := range []struct {
+		op     string
+		count  int
+		name   func(int) string
+		delete func(string) error
+	}{
+		{"delete-permission", sm.cfg.NumPermissions, sm.permissionName, (*d.RtMgr).DeletePermissionTarget},
+		{"delete-user", sm.cfg.NumUsers, sm.userName, (*d.RtMgr).DeleteUser},
+		{"delete-group", sm.cfg.NumGroups, sm.groupName, (*d.RtMgr).DeleteGroup},
+	} {
+		runParallel(sm.cfg.NumWorkers, entity.count, func(i int) {
+			start := time.Now()
+			err := entity.delete(entity.name(i))
+			rec.Record(entity.op, start, err)
+			if err != nil {
+				jflog.Error(fmt.Sprintf("Failed %s %s in DUT %s : %v", entity.op, entity.name(i), d.Name, err))
+			}
+		})
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"io/ioutil"
 	"math/rand"
 	"os"
+	"path/filepath"
 	"sync"
 	"time"
 
@@ -14,102 +15,58 @@ import (
 	jfauth "github.com/jfrog/jfrog-client-go/auth"
 	jflog "github.com/jfrog/jfrog-client-go/utils/log"
 	"jfrog.com/datasim/remoteartifacts"
+	"jfrog.com/datasim/stats"
 )
 
 type Simulator struct {
 	RefRtDetail *jfauth.ServiceDetails
-	DutRtDetail *jfauth.ServiceDetails
 	RefRtMgr    *artifactory.ArtifactoryServicesManager
-	DutRtMgr    *artifactory.ArtifactoryServicesManager
+	Duts        []*Dut
 }
 
 // NewSimulator creates a data simulator
-func NewSimulator(rd *jfauth.ServiceDetails, dd *jfauth.ServiceDetails, rm *artifactory.ArtifactoryServicesManager, dm *artifactory.ArtifactoryServicesManager) *Simulator {
+func NewSimulator(rd *jfauth.ServiceDetails, rm *artifactory.ArtifactoryServicesManager, duts []*Dut) *Simulator {
 	return &Simulator{
 		RefRtDetail: rd,
-		DutRtDetail: dd,
 		RefRtMgr:    rm,
-		DutRtMgr:    dm,
+		Duts:        duts,
 	}
 }
 
-// SimRemoteHttpConns simulates remote http connections by doing download of remote artifacts
-func (s *Simulator) SimRemoteHttpConns(cfgRepos *[]string, tgtDir string) error {
+// SimRemoteHttpConns simulates remote http connections by doing download of remote artifacts.
+// The remote repos of cfgRepos are completed with those the reference server selects by sel.
+func (s *Simulator) SimRemoteHttpConns(tc TargetCfg, cfgRepos *[]string, sel remoteartifacts.RepoSelection, tgtDir string) error {
+	sets, err := s.DutSets(tc)
+	if err != nil {
+		jflog.Error(fmt.Sprintf("remotehttpconn: %v", err))
+		return err
+	}
+	repoNames := append([]string{}, *cfgRepos...)
+	if sel.Enabled {
+		selected, err := remoteartifacts.GetCachedRemoteRepos(s.RefRtDetail, sel)
+		if err != nil {
+			jflog.Error(fmt.Sprintf("Failed remoteartifacts.GetCachedRemoteRepos() : %v", err))
+			return err
+		}
+		for _, r := range *selected {
+			if !containsString(repoNames, r) {
+				repoNames = append(repoNames, r)
+			}
+		}
+	}
+	jflog.Info(fmt.Sprintf("Remote repos of the remotehttpconn simulation : %v", repoNames))
 	repoList := []string{}
-	remoteRepos, err := remoteartifacts.GetRepoInfo(s.RefRtDetail, cfgRepos)
+	remoteRepos, err := remoteartifacts.GetRepoInfo(s.RefRtDetail, &repoNames)
+	if err != nil {
+		jflog.Error(fmt.Sprintf("Failed remoteartifacts.GetRepoInfo() : %v", err))
+		return err
+	}
 	for _, r := range *remoteRepos {
 		jflog.Info(fmt.Sprintf("Fetching files in repo : %+v", r))
-
-		dutRemoteRepo, err := (*s.DutRtMgr).GetRepository(r.Key)
-		if dutRemoteRepo != nil && dutRemoteRepo.Key == r.Key {
-			jflog.Info(fmt.Sprintf("Remote repo %s is present in DUT", dutRemoteRepo.Key))
-			for {
-				err := (*s.DutRtMgr).DeleteRepository(dutRemoteRepo.Key)
-				if err == nil {
-					break
-				}
-				jflog.Error(fmt.Sprintf("Failed to delete in the DUT remote repo %s, retrying after a minute...", dutRemoteRepo.Key))
-				time.Sleep(60 * time.Second)
-			}
-			jflog.Info(fmt.Sprintf("Pausing after deleting %s in DUT", dutRemoteRepo.Key))
-			time.Sleep(5 * time.Second)
+		// The DUTs of a round-robin set are nodes of one cluster, sharing its repos
+		for _, ds := range sets {
+			recreateRemoteRepo(ds.Duts[0], r)
 		}
-		switch r.PackageType {
-		case "maven":
-			params := services.NewMavenRemoteRepositoryParams()
-			params.Key = r.Key
-			params.Url = r.RepoUrl
-			params.RepoLayoutRef = r.RepoLayoutRef
-			params.Description = "A caching proxy repository for " + r.Key
-			params.XrayIndex = &[]bool{true}[0]
-			params.AssumedOfflinePeriodSecs = 600
-			if err = (*s.DutRtMgr).CreateRemoteRepository().Maven(params); err != nil {
-				jflog.Error(fmt.Sprintf("Failed to create maven remote repo %s in DUT", r.Key))
-				os.Exit(-1)
-			}
-			break
-		case "docker":
-			params := services.NewDockerRemoteRepositoryParams()
-			params.Key = r.Key
-			params.Url = r.RepoUrl
-			params.RepoLayoutRef = "simple-default"
-			params.Description = "A caching proxy repository for " + r.Key
-			params.XrayIndex = &[]bool{true}[0]
-			params.AssumedOfflinePeriodSecs = 600
-			if err = (*s.DutRtMgr).CreateRemoteRepository().Docker(params); err != nil {
-				jflog.Error(fmt.Sprintf("Failed to create docker remote repo %s in DUT", r.Key))
-				os.Exit(-1)
-			}
-			break
-		case "debian":
-			params := services.NewDebianRemoteRepositoryParams()
-			params.Key = r.Key
-			params.Url = r.RepoUrl
-			params.RepoLayoutRef = r.RepoLayoutRef
-			params.Description = "A caching proxy repository for " + r.Key
-			params.XrayIndex = &[]bool{true}[0]
-			params.AssumedOfflinePeriodSecs = 600
-			if err = (*s.DutRtMgr).CreateRemoteRepository().Debian(params); err != nil {
-				jflog.Error(fmt.Sprintf("Failed to create debian remote repo %s in DUT", r.Key))
-				os.Exit(-1)
-			}
-		case "npm":
-			params := services.NewPypiRemoteRepositoryParams()
-			params.Key = r.Key
-			params.Url = r.RepoUrl
-			params.RepoLayoutRef = "simple-default"
-			params.Description = "A caching proxy repository for " + r.Key
-			params.XrayIndex = &[]bool{true}[0]
-			params.AssumedOfflinePeriodSecs = 600
-			if err = (*s.DutRtMgr).CreateRemoteRepository().Pypi(params); err != nil {
-				jflog.Error(fmt.Sprintf("Failed to create debian remote repo %s in DUT", r.Key))
-				os.Exit(-1)
-			}
-		default:
-			jflog.Error(fmt.Sprintf("Unsupported PackageType %s", r.PackageType))
-		}
-		dutRemoteRepo, err = (*s.DutRtMgr).GetRepository(r.Key)
-		jflog.Info(fmt.Sprintf("After recreation DUT RT repo list : %+v", dutRemoteRepo))
 		repoList = append(repoList, r.Key)
 	}
 
@@ -119,15 +76,119 @@ func (s *Simulator) SimRemoteHttpConns(cfgRepos *[]string, tgtDir string) error
 		jflog.Error(fmt.Sprintf("Failed remoteartifacts.GetRemoteArtifactFiles()"))
 	}
 	jflog.Info(fmt.Sprintf("Number of artifacts : %d", files.Len()))
-	err = remoteartifacts.DownloadRemoteArtifacts(s.DutRtDetail, files, tgtDir)
-	if err != nil {
-		jflog.Error(fmt.Sprintf("Failed remoteartifacts.GetRemoteArtifactFiles()"))
+
+	return s.runOnTargets("remotehttpconn", tc, func(ds *DutSet) error {
+		// Each DUT of the set downloads its round-robin share of the files
+		parts := map[*Dut]*list.List{}
+		for e := files.Front(); e != nil; e = e.Next() {
+			d := ds.Next()
+			if parts[d] == nil {
+				parts[d] = list.New()
+			}
+			parts[d].PushBack(e.Value)
+		}
+		errs := make(chan error, len(parts))
+		for d, part := range parts {
+			go func(d *Dut, part *list.List) {
+				dutTgtDir := tgtDir
+				if len(s.Duts) > 1 {
+					dutTgtDir = filepath.Join(tgtDir, d.Name)
+				}
+				rec := stats.NewRecorder("remotehttpconn", d.Name)
+				err := remoteartifacts.DownloadRemoteArtifacts(d.RtDetail, part, dutTgtDir, rec)
+				if err != nil {
+					jflog.Error(fmt.Sprintf("Failed remoteartifacts.DownloadRemoteArtifacts() on DUT %s", d.Name))
+				}
+				errs <- err
+			}(d, part)
+		}
+		var err error
+		for range parts {
+			if e := <-errs; e != nil {
+				err = e
+			}
+		}
+		return err
+	})
+}
+
+// recreateRemoteRepo deletes the remote repo in the DUT if present, and creates it
+// again with the settings of the reference remote repo
+func recreateRemoteRepo(d *Dut, r remoteartifacts.RepoInfo) {
+	dutRemoteRepo, err := (*d.RtMgr).GetRepository(r.Key)
+	if dutRemoteRepo != nil && dutRemoteRepo.Key == r.Key {
+		jflog.Info(fmt.Sprintf("Remote repo %s is present in DUT %s", dutRemoteRepo.Key, d.Name))
+		for {
+			err := (*d.RtMgr).DeleteRepository(dutRemoteRepo.Key)
+			if err == nil {
+				break
+			}
+			jflog.Error(fmt.Sprintf("Failed to delete in the DUT %s remote repo %s, retrying after a minute...", d.Name, dutRemoteRepo.Key))
+			time.Sleep(60 * time.Second)
+		}
+		jflog.Info(fmt.Sprintf("Pausing after deleting %s in DUT %s", dutRemoteRepo.Key, d.Name))
+		time.Sleep(5 * time.Second)
 	}
-	return err
+	switch r.PackageType {
+	case "maven":
+		params := services.NewMavenRemoteRepositoryParams()
+		params.Key = r.Key
+		params.Url = r.RepoUrl
+		params.RepoLayoutRef = r.RepoLayoutRef
+		params.Description = "A caching proxy repository for " + r.Key
+		params.XrayIndex = &[]bool{true}[0]
+		params.AssumedOfflinePeriodSecs = 600
+		if err = (*d.RtMgr).CreateRemoteRepository().Maven(params); err != nil {
+			jflog.Error(fmt.Sprintf("Failed to create maven remote repo %s in DUT %s", r.Key, d.Name))
+			os.Exit(-1)
+		}
+		break
+	case "docker":
+		params := services.NewDockerRemoteRepositoryParams()
+		params.Key = r.Key
+		params.Url = r.RepoUrl
+		params.RepoLayoutRef = "simple-default"
+		params.Description = "A caching proxy repository for " + r.Key
+		params.XrayIndex = &[]bool{true}[0]
+		params.AssumedOfflinePeriodSecs = 600
+		if err = (*d.RtMgr).CreateRemoteRepository().Docker(params); err != nil {
+			jflog.Error(fmt.Sprintf("Failed to create docker remote repo %s in DUT %s", r.Key, d.Name))
+			os.Exit(-1)
+		}
+		break
+	case "debian":
+		params := services.NewDebianRemoteRepositoryParams()
+		params.Key = r.Key
+		params.Url = r.RepoUrl
+		params.RepoLayoutRef = r.RepoLayoutRef
+		params.Description = "A caching proxy repository for " + r.Key
+		params.XrayIndex = &[]bool{true}[0]
+		params.AssumedOfflinePeriodSecs = 600
+		if err = (*d.RtMgr).CreateRemoteRepository().Debian(params); err != nil {
+			jflog.Error(fmt.Sprintf("Failed to create debian remote repo %s in DUT %s", r.Key, d.Name))
+			os.Exit(-1)
+		}
+	case "npm":
+		params := services.NewPypiRemoteRepositoryParams()
+		params.Key = r.Key
+		params.Url = r.RepoUrl
+		params.RepoLayoutRef = "simple-default"
+		params.Description = "A caching proxy repository for " + r.Key
+		params.XrayIndex = &[]bool{true}[0]
+		params.AssumedOfflinePeriodSecs = 600
+		if err = (*d.RtMgr).CreateRemoteRepository().Pypi(params); err != nil {
+			jflog.Error(fmt.Sprintf("Failed to create debian remote repo %s in DUT %s", r.Key, d.Name))
+			os.Exit(-1)
+		}
+	default:
+		jflog.Error(fmt.Sprintf("Unsupported PackageType %s", r.PackageType))
+	}
+	dutRemoteRepo, err = (*d.RtMgr).GetRepository(r.Key)
+	jflog.Info(fmt.Sprintf("After recreation DUT %s RT repo list : %+v", d.Name, dutRemoteRepo))
 }
 
 // SimDbConns simulates db connections by doing AQL queries
-func (s *Simulator) SimDbConns(numWorkers int, numItersByWorker int) error {
+func (s *Simulator) SimDbConns(tc TargetCfg, numWorkers int, numItersByWorker int) error {
 	aqls := []string{
 		`items.find({"name" : {"$match":"*.jar"}}).sort({"$asc" : ["repo","name"]})`,
 		`items.find({"modified" : {"$last" : "3d"}})`,
@@ -141,30 +202,38 @@ func (s *Simulator) SimDbConns(numWorkers int, numItersByWorker int) error {
 		`items.find({"size" : {"$gt":"100"},"name":{"$match":"*.xml"},"$or":[{"repo" : "jfrog-libs-cache", "repo" : "ubuntu-cache" }]})`,
 	}
 
-	var workerg sync.WaitGroup
-	workerg.Add(numWorkers)
-	for i := 0; i < numWorkers; i++ {
-		go func(wnum int) {
-			rand.Seed(time.Now().UnixNano())
-			for i := 0; i < numItersByWorker; i++ {
-				q := aqls[rand.Intn(len(aqls))]
-				resp, err := (*s.DutRtMgr).Aql(q)
-				if err != nil {
-					jflog.Error(fmt.Sprintf("Failed AQL = %s", q))
+	return s.runOnTargets("dbconn", tc, func(ds *DutSet) error {
+		var workerg sync.WaitGroup
+		workerg.Add(numWorkers)
+		for i := 0; i < numWorkers; i++ {
+			go func(wnum int) {
+				rand.Seed(time.Now().UnixNano())
+				for i := 0; i < numItersByWorker; i++ {
+					q := aqls[rand.Intn(len(aqls))]
+					d := ds.Next()
+					rec := stats.NewRecorder("dbconn", d.Name)
+					start := time.Now()
+					resp, err := (*d.RtMgr).Aql(q)
+					if err != nil {
+						rec.Record("aql", start, err)
+						jflog.Error(fmt.Sprintf("Failed AQL = %s on DUT %s : %v", q, d.Name, err))
+						continue
+					}
+					qresult, err := ioutil.ReadAll(resp)
+					rec.RecordBytes("aql", start, int64(len(qresult)), err)
+					if err != nil {
+						jflog.Error(fmt.Sprintf("ReadAll Failed for AQL = %s", q))
+					}
+					jflog.Debug(fmt.Sprintf("AQL = %s, DUT = %s, Response size = %d bytes\n", q, d.Name, len(qresult)))
+					resp.Close()
 				}
-				qresult, err := ioutil.ReadAll(resp)
-				if err != nil {
-					jflog.Error(fmt.Sprintf("ReadAll Failed for AQL = %s", q))
-				}
-				jflog.Debug(fmt.Sprintf("AQL = %s, Response size = %d bytes\n", q, len(qresult)))
-				resp.Close()
-			}
-			jflog.Info(fmt.Sprintf("Completed dbconn worker %d", wnum))
-			workerg.Done()
-		}(i)
-	}
+				jflog.Info(fmt.Sprintf("Completed dbconn worker %d on DUT(s) %s", wnum, ds.Names()))
+				workerg.Done()
+			}(i)
+		}
 
-	workerg.Wait()
-	jflog.Info(fmt.Sprintf("All SimDbConns() go-routines completed"))
-	return nil
+		workerg.Wait()
+		jflog.Info(fmt.Sprintf("All SimDbConns() go-routines completed on DUT(s) %s", ds.Names()))
+		return nil
+	})
 }
@@ -0,0 +1,155 @@
+package simulator
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/jfrog/jfrog-client-go/artifactory"
+	"github.com/jfrog/jfrog-client-go/artifactory/auth"
+	jfauth "github.com/jfrog/jfrog-client-go/auth"
+	jflog "github.com/jfrog/jfrog-client-go/utils/log"
+	"jfrog.com/datasim/target"
+)
+
+// Modes of spreading a simulation load over its target DUTs
+const (
+	TargetModeRoundRobin = target.ModeRoundRobin
+	TargetModeMirrored   = target.ModeMirrored
+)
+
+// TargetAll selects every configured DUT
+const TargetAll = target.All
+
+// Dut is a named Artifactory installation under test
+type Dut struct {
+	Name     string
+	RtDetail *jfauth.ServiceDetails
+	RtMgr    *artifactory.ArtifactoryServicesManager
+}
+
+// NewDut creates a DUT
+func NewDut(name string, rd *jfauth.ServiceDetails, rm *artifactory.ArtifactoryServicesManager) *Dut {
+	return &Dut{
+		Name:     name,
+		RtDetail: rd,
+		RtMgr:    rm,
+	}
+}
+
+// UserDetails returns the service details of the DUT with the credentials of
+// another user, anonymous when none is given
+func (d *Dut) UserDetails(username string, password string, accessToken string) *jfauth.ServiceDetails {
+	details := auth.NewArtifactoryDetails()
+	details.SetUrl((*d.RtDetail).GetUrl())
+	details.SetClientCertPath((*d.RtDetail).GetClientCertPath())
+	details.SetClientCertKeyPath((*d.RtDetail).GetClientCertKeyPath())
+	details.SetUser(username)
+	details.SetPassword(password)
+	details.SetAccessToken(accessToken)
+	return &details
+}
+
+// TargetCfg selects the DUTs of a simulation, embedded in each simulation config
+type TargetCfg = target.Cfg
+
+// DutSet is a set of DUTs sharing the load of one simulation run
+type DutSet struct {
+	Duts []*Dut
+	rr   target.RoundRobin
+}
+
+// Next returns the DUTs of the set in round-robin order
+func (ds *DutSet) Next() *Dut {
+	return ds.Duts[ds.rr.Next(len(ds.Duts))]
+}
+
+// Names returns the names of the DUTs of the set
+func (ds *DutSet) Names() string {
+	names := []string{}
+	for _, d := range ds.Duts {
+		names = append(names, d.Name)
+	}
+	return strings.Join(names, ",")
+}
+
+// SelectDuts returns the DUTs named in tc, all of them when none is named
+func (s *Simulator) SelectDuts(tc TargetCfg) ([]*Dut, error) {
+	selected, err := tc.Select(s.dutNames())
+	if err != nil {
+		return nil, err
+	}
+	duts := []*Dut{}
+	for _, i := range selected {
+		duts = append(duts, s.Duts[i])
+	}
+	return duts, nil
+}
+
+// dutNames returns the names of all the DUTs
+func (s *Simulator) dutNames() []string {
+	names := []string{}
+	for _, d := range s.Duts {
+		names = append(names, d.Name)
+	}
+	return names
+}
+
+// GetDut returns the DUT with the given name, nil if there is none
+func (s *Simulator) GetDut(name string) *Dut {
+	for _, d := range s.Duts {
+		if d.Name == name {
+			return d
+		}
+	}
+	return nil
+}
+
+// DutSets returns the sets of DUTs a simulation is run against: a single set
+// sharing the load in round-robin mode, or one set per DUT in mirrored mode
+func (s *Simulator) DutSets(tc TargetCfg) ([]*DutSet, error) {
+	selected, err := tc.Select(s.dutNames())
+	if err != nil {
+		return nil, err
+	}
+	split, err := tc.Split(selected)
+	if err != nil {
+		return nil, err
+	}
+	sets := []*DutSet{}
+	for _, indexes := range split {
+		ds := &DutSet{}
+		for _, i := range indexes {
+			ds.Duts = append(ds.Duts, s.Duts[i])
+		}
+		sets = append(sets, ds)
+	}
+	return sets, nil
+}
+
+// runOnTargets runs fn concurrently for each DUT set of tc and returns the
+// first error encountered
+func (s *Simulator) runOnTargets(simName string, tc TargetCfg, fn func(ds *DutSet) error) error {
+	sets, err := s.DutSets(tc)
+	if err != nil {
+		jflog.Error(fmt.Sprintf("%s: %v", simName, err))
+		return err
+	}
+	errs := make([]error, len(sets))
+	var setg sync.WaitGroup
+	setg.Add(len(sets))
+	for i, ds := range sets {
+		go func(i int, ds *DutSet) {
+			defer setg.Done()
+			jflog.Info(fmt.Sprintf("Running %s against DUT(s) %s", simName, ds.Names()))
+			errs[i] = fn(ds)
+		}(i, ds)
+	}
+	setg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package simulator
+
+import (
+	"testing"
+)
+
+func TestDutSets(t *testing.T) {
+	s := &Simulator{Duts: []*Dut{testDut("http://node1/"), testDut("http://node2/"), testDut("http://node3/")}}
+	for i, d := range s.Duts {
+		d.Name = []string{"node1", "node2", "node3"}[i]
+	}
+	tests := []struct {
+		tc      TargetCfg
+		want    []string
+		wantErr bool
+	}{
+		{TargetCfg{}, []string{"node1,node2,node3"}, false},
+		{TargetCfg{Targets: []string{"node3", "node1"}, TargetMode: TargetModeRoundRobin}, []string{"node3,node1"}, false},
+		{TargetCfg{Targets: []string{TargetAll}, TargetMode: TargetModeMirrored}, []string{"node1", "node2", "node3"}, false},
+		{TargetCfg{Targets: []string{"node4"}}, nil, true},
+		{TargetCfg{TargetMode: "broadcast"}, nil, true},
+	}
+	for _, tt := range tests {
+		sets, err := s.DutSets(tt.tc)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("DutSets(%+v) error = %v, want error %v", tt.tc, err, tt.wantErr)
+			continue
+		}
+		got := []string{}
+		for _, ds := range sets {
+			got = append(got, ds.Names())
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("DutSets(%+v) = %v, want %v", tt.tc, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("DutSets(%+v) = %v, want %v", tt.tc, got, tt.want)
+				break
+			}
+		}
+	}
+
+	sets, _ := s.DutSets(TargetCfg{})
+	for i, want := range []string{"node1", "node2", "node3", "node1"} {
+		if got := sets[0].Next().Name; got != want {
+			t.Errorf("Next() call %d = %s, want %s", i, got, want)
+		}
+	}
+}
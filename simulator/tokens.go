@@ -0,0 +1,182 @@
+package simulator
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/jfrog/jfrog-client-go/artifactory/services"
+	jflog "github.com/jfrog/jfrog-client-go/utils/log"
+	"jfrog.com/datasim/remoteartifacts"
+	"jfrog.com/datasim/stats"
+)
+
+// tokenPingUri is requested with the tokens when no file is found to download
+const tokenPingUri = "api/system/ping"
+
+// TokensCfg configures the access token issuance and revocation simulation
+type TokensCfg struct {
+	TargetCfg `yaml:",inline"`
+	Enabled   bool `yaml:"enabled"`
+	// The tokens are issued for Usernames in turn, for the DUT user when none is given
+	Usernames []string `yaml:"usernames"`
+	// Scope and Audience of the tokens, the DUT defaults when empty
+	Scope         string `yaml:"scope"`
+	Audience      string `yaml:"audience"`
+	ExpiresInSecs int    `yaml:"expiresinsecs"`
+	// Each token is used for RequestsPerToken downloads of the files of the
+	// repos starting with RepoPrefix, then refreshed NumRefreshes times, the
+	// refreshed token being used again, and finally revoked
+	RepoPrefix       string `yaml:"repoprefix"`
+	RequestsPerToken int    `yaml:"requestspertoken"`
+	NumRefreshes     int    `yaml:"numrefreshes"`
+	// VerifyRevoked checks that a revoked token is refused
+	VerifyRevoked bool    `yaml:"verifyrevoked"`
+	NumWorkers    int     `yaml:"numworkers"`
+	RatePerSec    float64 `yaml:"ratepersec"`
+	// The simulation stops after DurationSecs or NumTokens, whichever comes first
+	DurationSecs int `yaml:"durationsecs"`
+	NumTokens    int `yaml:"numtokens"`
+}
+
+// SimTokens simulates token-heavy CI systems: each cycle creates a scoped
+// access token, uses it for a few requests, refreshes it and revokes it,
+// the latency of each step being recorded
+func (s *Simulator) SimTokens(cfg TokensCfg) error {
+	if cfg.ExpiresInSecs <= 0 {
+		cfg.ExpiresInSecs = 3600
+	}
+	if cfg.RepoPrefix == "" {
+		cfg.RepoPrefix = DefaultUploadRepoPrefix
+	}
+	if cfg.RequestsPerToken < 0 {
+		cfg.RequestsPerToken = 0
+	}
+	if cfg.NumWorkers < 1 {
+		cfg.NumWorkers = 1
+	}
+	if cfg.DurationSecs <= 0 && cfg.NumTokens <= 0 {
+		err := fmt.Errorf("durationsecs or numtokens must be set")
+		jflog.Error(fmt.Sprintf("tokens: %v", err))
+		return err
+	}
+
+	return s.runOnTargets("tokens", cfg.TargetCfg, func(ds *DutSet) error {
+		uris := map[*Dut][]string{}
+		for _, d := range ds.Duts {
+			repos, err := listSimRepos(d, cfg.RepoPrefix)
+			if err != nil {
+				jflog.Error(fmt.Sprintf("Failed listing repos of DUT %s : %v", d.Name, err))
+				return err
+			}
+			items, err := findFiles(d, repos, 1000)
+			if err != nil {
+				jflog.Error(fmt.Sprintf("Failed to find items in DUT %s : %v", d.Name, err))
+				return err
+			}
+			for _, item := range items {
+				uris[d] = append(uris[d], item.RepoPath())
+			}
+			if len(uris[d]) == 0 {
+				jflog.Warn(fmt.Sprintf("No file in the repos starting with %s of DUT %s, the tokens are used on %s", cfg.RepoPrefix, d.Name, tokenPingUri))
+				uris[d] = []string{tokenPingUri}
+			}
+		}
+
+		ticks := rateTicks(cfg.RatePerSec, cfg.DurationSecs, cfg.NumTokens)
+		var workerg sync.WaitGroup
+		workerg.Add(cfg.NumWorkers)
+		for i := 0; i < cfg.NumWorkers; i++ {
+			go func(wnum int) {
+				defer workerg.Done()
+				rng := rand.New(rand.NewSource(time.Now().UnixNano() + int64(wnum)))
+				seq := wnum
+				for range ticks {
+					d := ds.Next()
+					username := (*d.RtDetail).GetUser()
+					if len(cfg.Usernames) > 0 {
+						username = cfg.Usernames[seq%len(cfg.Usernames)]
+					}
+					seq += cfg.NumWorkers
+					tokenCycle(cfg, d, rng, uris[d], username)
+				}
+			}(i)
+		}
+		workerg.Wait()
+		jflog.Info(fmt.Sprintf("All tokens workers completed on DUT(s) %s", ds.Names()))
+		return nil
+	})
+}
+
+// tokenCycle creates a token for the user, uses, refreshes and revokes it
+func tokenCycle(cfg TokensCfg, d *Dut, rng *rand.Rand, uris []string, username string) {
+	rec := stats.NewRecorder("tokens", d.Name)
+	params := services.NewCreateTokenParams()
+	params.Username, params.Scope, params.Audience = username, cfg.Scope, cfg.Audience
+	params.ExpiresIn = cfg.ExpiresInSecs
+	params.Refreshable = cfg.NumRefreshes > 0
+
+	start := time.Now()
+	token, err := (*d.RtMgr).CreateToken(params)
+	rec.Record("create", start, err)
+	if err != nil {
+		jflog.Error(fmt.Sprintf("Failed to create a token for %s in DUT %s : %v", username, d.Name, err))
+		return
+	}
+	tokenUse(cfg, d, rng, uris, token.AccessToken)
+
+	for i := 0; i < cfg.NumRefreshes; i++ {
+		refreshParams := services.NewRefreshTokenParams()
+		refreshParams.Token = params
+		refreshParams.AccessToken, refreshParams.RefreshToken = token.AccessToken, token.RefreshToken
+		start = time.Now()
+		refreshed, err := (*d.RtMgr).RefreshToken(refreshParams)
+		rec.Record("refresh", start, err)
+		if err != nil {
+			jflog.Error(fmt.Sprintf("Failed to refresh a token of %s in DUT %s : %v", username, d.Name, err))
+			break
+		}
+		token = refreshed
+		tokenUse(cfg, d, rng, uris, token.AccessToken)
+	}
+
+	revokeParams := services.NewRevokeTokenParams()
+	revokeParams.Token = token.AccessToken
+	start = time.Now()
+	_, err = (*d.RtMgr).RevokeToken(revokeParams)
+	rec.Record("revoke", start, err)
+	if err != nil {
+		jflog.Error(fmt.Sprintf("Failed to revoke a token of %s in DUT %s : %v", username, d.Name, err))
+		return
+	}
+
+	if cfg.VerifyRevoked {
+		start = time.Now()
+		_, err = remoteartifacts.FetchUri(d.UserDetails("", "", token.AccessToken), uris[rng.Intn(len(uris))])
+		if err == nil {
+			err = fmt.Errorf("revoked token of %s still accepted", username)
+		} else if remoteartifacts.IsForbidden(err) {
+			err = nil
+		}
+		rec.Record("use-revoked", start, err)
+		if err != nil {
+			jflog.Error(fmt.Sprintf("Failed to verify a revoked token of %s in DUT %s : %v", username, d.Name, err))
+		}
+	}
+}
+
+// tokenUse issues the requests of a token
+func tokenUse(cfg TokensCfg, d *Dut, rng *rand.Rand, uris []string, accessToken string) {
+	rec := stats.NewRecorder("tokens", d.Name)
+	details := d.UserDetails("", "", accessToken)
+	for i := 0; i < cfg.RequestsPerToken; i++ {
+		uri := uris[rng.Intn(len(uris))]
+		start := time.Now()
+		n, err := remoteartifacts.FetchUri(details, uri)
+		rec.RecordBytes("use", start, n, err)
+		if err != nil {
+			jflog.Error(fmt.Sprintf("Failed to get %s with a token in DUT %s : %v", uri, d.Name, err))
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package simulator
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jfrog/jfrog-client-go/artifactory/services"
+	jflog "github.com/jfrog/jfrog-client-go/utils/log"
+	"jfrog.com/datasim/generator"
+	"jfrog.com/datasim/remoteartifacts"
+	"jfrog.com/datasim/stats"
+)
+
+// Methods of deploying the generated files
+const (
+	UploadMethodRawPut  = "rawput"
+	UploadMethodManager = "manager"
+)
+
+// UploadCfg configures the upload simulation
+type UploadCfg struct {
+	TargetCfg   `yaml:",inline"`
+	Enabled     bool               `yaml:"enabled"`
+	RepoPrefix  string             `yaml:"repoprefix"`
+	NumRepos    int                `yaml:"numrepos"`
+	PackageType string             `yaml:"packagetype"`
+	NumFiles    int                `yaml:"numfiles"`
+	NumWorkers  int                `yaml:"numworkers"`
+	PathDepth   int                `yaml:"pathdepth"`
+	FanOut      int                `yaml:"fanout"`
+	Method      string             `yaml:"method"`
+	Seed        int64              `yaml:"seed"`
+	SizeDist    generator.SizeDist `yaml:"sizedist"`
+}
+
+// DefaultUploadRepoPrefix prefixes the repos of the upload simulation
+const DefaultUploadRepoPrefix = "datasim-upload"
+
+// uploadJob is one package to generate and deploy, seq numbers the jobs of all repos
+type uploadJob struct {
+	repo  string
+	index int
+	seq   int
+}
+
+// UploadRepoKey returns the key of the n-th repo created by the upload simulation
+func UploadRepoKey(prefix string, n int) string {
+	return fmt.Sprintf("%s-%d", prefix, n)
+}
+
+// SimUpload simulates write load by creating local repos in the DUT and
+// deploying generated files to them
+func (s *Simulator) SimUpload(cfg UploadCfg) error {
+	if cfg.PackageType == "" {
+		cfg.PackageType = generator.FormatGeneric
+	}
+	if err := cfg.SizeDist.Validate(); err != nil {
+		jflog.Error(fmt.Sprintf("upload: %v", err))
+		return err
+	}
+	if cfg.Method != "" && cfg.Method != UploadMethodRawPut && cfg.Method != UploadMethodManager {
+		err := fmt.Errorf("unsupported upload method %s", cfg.Method)
+		jflog.Error(fmt.Sprintf("upload: %v", err))
+		return err
+	}
+	if cfg.PackageType != generator.FormatGeneric && (cfg.PathDepth != 0 || cfg.FanOut != 0) {
+		jflog.Warn(fmt.Sprintf("upload: pathdepth and fanout do not apply to %s packages, which are laid out by their coordinates", cfg.PackageType))
+	}
+	if cfg.NumWorkers < 1 {
+		cfg.NumWorkers = 1
+	}
+	if cfg.RepoPrefix == "" {
+		cfg.RepoPrefix = DefaultUploadRepoPrefix
+	}
+
+	return s.runOnTargets("upload", cfg.TargetCfg, func(ds *DutSet) error {
+		repos := []string{}
+		for n := 1; n <= cfg.NumRepos; n++ {
+			repo := UploadRepoKey(cfg.RepoPrefix, n)
+			for _, d := range ds.Duts {
+				if err := createLocalRepo(d, repo, cfg.PackageType); err != nil {
+					return err
+				}
+			}
+			repos = append(repos, repo)
+		}
+
+		jobs := make(chan uploadJob, 1024)
+		var workerg sync.WaitGroup
+		workerg.Add(cfg.NumWorkers)
+		for i := 0; i < cfg.NumWorkers; i++ {
+			go func(wnum int) {
+				defer workerg.Done()
+				s.uploadWorker(cfg, ds, jobs)
+			}(i)
+		}
+		jflog.Info(fmt.Sprintf("Created %d uploadWorker() go routines", cfg.NumWorkers))
+
+		seq := 0
+		for _, repo := range repos {
+			for i := 0; i < cfg.NumFiles; i++ {
+				jobs <- uploadJob{repo, i, seq}
+				seq++
+			}
+		}
+		close(jobs)
+		workerg.Wait()
+		jflog.Info(fmt.Sprintf("All uploadWorker() completed on DUT(s) %s", ds.Names()))
+		return nil
+	})
+}
+
+// uploadWorker generates and deploys the packages of the jobs it receives
+func (s *Simulator) uploadWorker(cfg UploadCfg, ds *DutSet, jobs <-chan uploadJob) {
+	upcount := 0
+	for job := range jobs {
+		d := ds.Next()
+		rec := stats.NewRecorder("upload", d.Name)
+
+		// A random source per job keeps the data independent of the worker scheduling
+		rng := generator.NewRand(cfg.Seed, job.seq)
+		pkg, err := generator.NewPackage(cfg.PackageType, rng, job.index, cfg.SizeDist.Sample(rng), cfg.PathDepth, cfg.FanOut)
+		if err != nil {
+			jflog.Error(fmt.Sprintf("Failed to generate %s package : %v", cfg.PackageType, err))
+			continue
+		}
+
+		for _, f := range pkg.Files {
+			repoPath := path.Join(job.repo, f.Path)
+			start := time.Now()
+			if cfg.Method == UploadMethodManager {
+				err = uploadWithManager(d, repoPath, f.MatrixParams, f.Data)
+			} else {
+				err = remoteartifacts.UploadArtifact(d.RtDetail, repoPath+f.MatrixParams, f.Data)
+			}
+			rec.RecordBytes("upload", start, int64(len(f.Data)), err)
+			if err != nil {
+				jflog.Error(fmt.Sprintf("Failed to upload %s to DUT %s : %v", repoPath, d.Name, err))
+				break
+			}
+			upcount++
+		}
+	}
+	jflog.Info(fmt.Sprintf("uploadWorker() complete, uploaded %d files", upcount))
+}
+
+// uploadWithManager deploys data through the services manager of the DUT,
+// which reads it from a temporary file
+func uploadWithManager(d *Dut, repoPath string, matrixParams string, data []byte) error {
+	tmp, err := ioutil.TempFile("", "datasim-upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	tmp.Close()
+
+	params := services.NewUploadParams()
+	params.Pattern = tmp.Name()
+	params.Target = repoPath
+	params.Flat = true
+	params.TargetProps = strings.TrimPrefix(matrixParams, ";")
+	_, failed, err := (*d.RtMgr).UploadFiles(params)
+	if err == nil && failed > 0 {
+		err = fmt.Errorf("failed to upload %s", repoPath)
+	}
+	return err
+}
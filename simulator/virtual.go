@@ -0,0 +1,211 @@
+package simulator
+
+import (
+	"fmt"
+	"math/rand"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	jflog "github.com/jfrog/jfrog-client-go/utils/log"
+	"jfrog.com/datasim/remoteartifacts"
+	"jfrog.com/datasim/stats"
+)
+
+// DefaultVirtualRepoKey is the key of the virtual repo of the virtual simulation
+const DefaultVirtualRepoKey = "datasim-virtual"
+
+// VirtualCfg configures the virtual repository resolution simulation
+type VirtualCfg struct {
+	TargetCfg   `yaml:",inline"`
+	Enabled     bool   `yaml:"enabled"`
+	RepoKey     string `yaml:"repokey"`
+	PackageType string `yaml:"packagetype"`
+	// The virtual repo aggregates the local repos starting with LocalRepoPrefix
+	// and the remote repos of RemoteRepos, all of PackageType
+	LocalRepoPrefix string   `yaml:"localrepoprefix"`
+	RemoteRepos     []string `yaml:"remoterepos"`
+	// NumItems bounds the files of each member repo requested through the virtual repo
+	NumItems   int     `yaml:"numitems"`
+	RatePerSec float64 `yaml:"ratepersec"`
+	// The simulation stops after DurationSecs or NumRequests, whichever comes first
+	DurationSecs int `yaml:"durationsecs"`
+	NumRequests  int `yaml:"numrequests"`
+	NumWorkers   int `yaml:"numworkers"`
+	// MetadataPercent of the requests are for package metadata instead of files
+	MetadataPercent int `yaml:"metadatapercent"`
+}
+
+// virtualMembers returns the local and remote repos of the DUT to aggregate
+func virtualMembers(d *Dut, cfg VirtualCfg) ([]string, error) {
+	repos, err := remoteartifacts.ListRepositories(d.RtDetail)
+	if err != nil {
+		return nil, err
+	}
+	members := []string{}
+	for _, r := range repos {
+		if !strings.EqualFold(r.PackageType, cfg.PackageType) || r.Key == cfg.RepoKey {
+			continue
+		}
+		local := strings.EqualFold(r.Type, RepoClassLocal) && strings.HasPrefix(r.Key, cfg.LocalRepoPrefix)
+		remote := strings.EqualFold(r.Type, RepoClassRemote) && containsString(cfg.RemoteRepos, r.Key)
+		if local || remote {
+			members = append(members, r.Key)
+		}
+	}
+	return members, nil
+}
+
+// setupVirtualRepo creates the virtual repo in the DUT, or updates it when present
+func setupVirtualRepo(d *Dut, cfg VirtualCfg, members []string) error {
+	repoCfg := remoteartifacts.RepoConfig{
+		Key:          cfg.RepoKey,
+		Rclass:       RepoClassVirtual,
+		PackageType:  cfg.PackageType,
+		Description:  simRepoDescription,
+		Repositories: members,
+	}
+	if repo, _ := (*d.RtMgr).GetRepository(cfg.RepoKey); repo != nil && repo.Key == cfg.RepoKey {
+		jflog.Info(fmt.Sprintf("Updating virtual repo %s in DUT %s with %v", cfg.RepoKey, d.Name, members))
+		return remoteartifacts.UpdateRepository(d.RtDetail, repoCfg)
+	}
+	jflog.Info(fmt.Sprintf("Creating virtual repo %s in DUT %s with %v", cfg.RepoKey, d.Name, members))
+	return remoteartifacts.CreateRepository(d.RtDetail, repoCfg)
+}
+
+// virtualUris returns the file and metadata URIs to request through the virtual repo
+func virtualUris(d *Dut, cfg VirtualCfg, members []string) ([]string, []string, error) {
+	files, metadata := []string{}, []string{}
+	seen := map[string]bool{}
+	for _, m := range members {
+		// Remote repos store what they proxy in their cache repo
+		repo := m
+		if containsString(cfg.RemoteRepos, m) {
+			repo = m + "-cache"
+		}
+		items, err := findItems(d, repo, "file", cfg.NumItems)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, it := range items {
+			files = append(files, path.Join(cfg.RepoKey, it.Path, it.Name))
+			if uri := metadataUri(cfg.RepoKey, cfg.PackageType, it); uri != "" && !seen[uri] {
+				seen[uri] = true
+				metadata = append(metadata, uri)
+			}
+		}
+	}
+	return files, metadata, nil
+}
+
+// metadataUri returns the URI of the metadata a client fetches before the item,
+// "" when the package type has none
+func metadataUri(repoKey string, packageType string, it AqlItem) string {
+	switch strings.ToLower(packageType) {
+	case "maven":
+		// <group>/<artifact>/<version>/<file>
+		if it.Path == "." || !strings.Contains(it.Path, "/") {
+			return ""
+		}
+		return path.Join(repoKey, path.Dir(it.Path), "maven-metadata.xml")
+	case "npm":
+		// <name>/-/<name>-<version>.tgz, the name possibly scoped
+		name := strings.TrimSuffix(it.Path, "/-")
+		if name == it.Path {
+			return ""
+		}
+		return path.Join("api/npm", repoKey, name)
+	case "pypi":
+		// <name>/<version>/<file>
+		name := strings.SplitN(it.Path, "/", 2)[0]
+		if name == "." {
+			return ""
+		}
+		return path.Join("api/pypi", repoKey, "simple", name) + "/"
+	}
+	return ""
+}
+
+// SimVirtual simulates the resolution through a virtual repo aggregating the
+// simulator local repos and remote repos, downloading files and the package
+// metadata clients request, like maven-metadata.xml and npm package documents
+func (s *Simulator) SimVirtual(cfg VirtualCfg) error {
+	if cfg.RepoKey == "" {
+		cfg.RepoKey = DefaultVirtualRepoKey
+	}
+	if cfg.PackageType == "" {
+		cfg.PackageType = "generic"
+	}
+	if cfg.LocalRepoPrefix == "" {
+		cfg.LocalRepoPrefix = DefaultUploadRepoPrefix
+	}
+	if cfg.NumItems < 1 {
+		cfg.NumItems = 1000
+	}
+	if cfg.NumWorkers < 1 {
+		cfg.NumWorkers = 1
+	}
+	if cfg.DurationSecs <= 0 && cfg.NumRequests <= 0 {
+		err := fmt.Errorf("durationsecs or numrequests must be set")
+		jflog.Error(fmt.Sprintf("virtual: %v", err))
+		return err
+	}
+
+	return s.runOnTargets("virtual", cfg.TargetCfg, func(ds *DutSet) error {
+		files, metadata := map[*Dut][]string{}, map[*Dut][]string{}
+		for _, d := range ds.Duts {
+			members, err := virtualMembers(d, cfg)
+			if err != nil {
+				jflog.Error(fmt.Sprintf("Failed listing repos of DUT %s : %v", d.Name, err))
+				return err
+			}
+			if len(members) == 0 {
+				err := fmt.Errorf("no %s repo to aggregate in DUT %s", cfg.PackageType, d.Name)
+				jflog.Error(fmt.Sprintf("virtual: %v", err))
+				return err
+			}
+			if err := setupVirtualRepo(d, cfg, members); err != nil {
+				jflog.Error(fmt.Sprintf("Failed to set up virtual repo %s in DUT %s : %v", cfg.RepoKey, d.Name, err))
+				return err
+			}
+			files[d], metadata[d], err = virtualUris(d, cfg, members)
+			if err != nil {
+				jflog.Error(fmt.Sprintf("Failed to find items in DUT %s : %v", d.Name, err))
+				return err
+			}
+			jflog.Info(fmt.Sprintf("Virtual repo %s of DUT %s : %d files, %d metadata", cfg.RepoKey, d.Name, len(files[d]), len(metadata[d])))
+		}
+
+		ticks := rateTicks(cfg.RatePerSec, cfg.DurationSecs, cfg.NumRequests)
+		var workerg sync.WaitGroup
+		workerg.Add(cfg.NumWorkers)
+		for i := 0; i < cfg.NumWorkers; i++ {
+			go func(wnum int) {
+				defer workerg.Done()
+				rng := rand.New(rand.NewSource(time.Now().UnixNano() + int64(wnum)))
+				for range ticks {
+					d := ds.Next()
+					op, uris := "download", files[d]
+					if len(metadata[d]) > 0 && rng.Intn(100) < cfg.MetadataPercent {
+						op, uris = "metadata", metadata[d]
+					}
+					if len(uris) == 0 {
+						continue
+					}
+					uri := uris[rng.Intn(len(uris))]
+					rec := stats.NewRecorder("virtual", d.Name)
+					start := time.Now()
+					n, err := remoteartifacts.FetchUri(d.RtDetail, uri)
+					rec.RecordBytes(op, start, n, err)
+					if err != nil {
+						jflog.Error(fmt.Sprintf("Failed to get %s from DUT %s : %v", uri, d.Name, err))
+					}
+				}
+			}(i)
+		}
+		workerg.Wait()
+		jflog.Info(fmt.Sprintf("All virtual workers completed on DUT(s) %s", ds.Names()))
+		return nil
+	})
+}
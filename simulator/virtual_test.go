@@ -0,0 +1,42 @@
+package simulator
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestVirtualMembers(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/artifactory/api/repositories" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`[
+			{"key": "datasim-upload-1", "type": "LOCAL", "packageType": "Maven"},
+			{"key": "datasim-upload-2", "type": "LOCAL", "packageType": "npm"},
+			{"key": "datasim-upload-virtual", "type": "VIRTUAL", "packageType": "Maven"},
+			{"key": "datasim-upload-remote", "type": "REMOTE", "packageType": "Maven"},
+			{"key": "datasim-upload-fed", "type": "FEDERATED", "packageType": "Maven"},
+			{"key": "jcenter", "type": "REMOTE", "packageType": "Maven"},
+			{"key": "central-virtual", "type": "VIRTUAL", "packageType": "Maven"},
+			{"key": "libs", "type": "LOCAL", "packageType": "Maven"}
+		]`))
+	}))
+	defer server.Close()
+
+	cfg := VirtualCfg{
+		RepoKey:         "datasim-upload-virtual",
+		PackageType:     "maven",
+		LocalRepoPrefix: "datasim-upload",
+		RemoteRepos:     []string{"jcenter", "central-virtual", "libs"},
+	}
+	members, err := virtualMembers(testDut(server.URL+"/artifactory/"), cfg)
+	if err != nil {
+		t.Fatalf("virtualMembers() failed: %v", err)
+	}
+	if got := strings.Join(members, ","); got != "datasim-upload-1,jcenter" {
+		t.Errorf("virtualMembers() = %s, want datasim-upload-1,jcenter", got)
+	}
+}
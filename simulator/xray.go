@@ -0,0 +1,210 @@
+package simulator
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jfrog/jfrog-client-go/artifactory/services"
+	jflog "github.com/jfrog/jfrog-client-go/utils/log"
+	"jfrog.com/datasim/remoteartifacts"
+	"jfrog.com/datasim/stats"
+)
+
+// Default names of the Xray resources of the xray simulation
+const (
+	DefaultXrayPolicyName = "datasim-policy"
+	DefaultXrayWatchName  = "datasim-watch"
+)
+
+// XrayCfg configures the Xray scan simulation
+type XrayCfg struct {
+	TargetCfg   `yaml:",inline"`
+	Enabled     bool   `yaml:"enabled"`
+	RepoPrefix  string `yaml:"repoprefix"`
+	PolicyName  string `yaml:"policyname"`
+	WatchName   string `yaml:"watchname"`
+	MinSeverity string `yaml:"minseverity"`
+	// NumArtifacts of the watched repos are scanned on demand
+	NumArtifacts     int `yaml:"numartifacts"`
+	NumWorkers       int `yaml:"numworkers"`
+	PollIntervalSecs int `yaml:"pollintervalsecs"`
+	ScanTimeoutSecs  int `yaml:"scantimeoutsecs"`
+	// Builds to scan, given as <name>/<number>
+	Builds []string `yaml:"builds"`
+}
+
+// SimXray simulates Xray load by creating a policy and a watch over the
+// simulator repos, enabling their indexing, then triggering on-demand scans of
+// artifacts and builds and polling each one until it completes. The time from
+// the trigger to the completion is recorded per artifact and build.
+func (s *Simulator) SimXray(cfg XrayCfg) error {
+	if cfg.RepoPrefix == "" {
+		cfg.RepoPrefix = DefaultUploadRepoPrefix
+	}
+	if cfg.PolicyName == "" {
+		cfg.PolicyName = DefaultXrayPolicyName
+	}
+	if cfg.WatchName == "" {
+		cfg.WatchName = DefaultXrayWatchName
+	}
+	if cfg.MinSeverity == "" {
+		cfg.MinSeverity = "Low"
+	}
+	if cfg.NumWorkers < 1 {
+		cfg.NumWorkers = 1
+	}
+	if cfg.PollIntervalSecs < 1 {
+		cfg.PollIntervalSecs = 5
+	}
+	if cfg.ScanTimeoutSecs < 1 {
+		cfg.ScanTimeoutSecs = 600
+	}
+
+	return s.runOnTargets("xray", cfg.TargetCfg, func(ds *DutSet) error {
+		items := map[*Dut][]AqlItem{}
+		for _, d := range ds.Duts {
+			repos, err := listSimRepos(d, cfg.RepoPrefix)
+			if err != nil {
+				jflog.Error(fmt.Sprintf("Failed listing repos of DUT %s : %v", d.Name, err))
+				return err
+			}
+			if err := setupXrayWatch(d, cfg, repos); err != nil {
+				return err
+			}
+			if items[d], err = findFiles(d, repos, cfg.NumArtifacts); err != nil {
+				jflog.Error(fmt.Sprintf("Failed to find items in DUT %s : %v", d.Name, err))
+				return err
+			}
+			jflog.Info(fmt.Sprintf("Scanning %d artifacts and %d builds in DUT %s", len(items[d]), len(cfg.Builds), d.Name))
+		}
+
+		// Scans are spread over the DUTs of the set, each scanning its own artifacts
+		type scanJob struct {
+			d     *Dut
+			item  *AqlItem
+			build string
+		}
+		jobs := make(chan scanJob)
+		var workerg sync.WaitGroup
+		workerg.Add(cfg.NumWorkers)
+		for i := 0; i < cfg.NumWorkers; i++ {
+			go func() {
+				defer workerg.Done()
+				for job := range jobs {
+					if job.item != nil {
+						scanArtifact(cfg, job.d, *job.item)
+					} else {
+						scanBuild(job.d, job.build)
+					}
+				}
+			}()
+		}
+		for _, d := range ds.Duts {
+			for i := range items[d] {
+				jobs <- scanJob{d: d, item: &items[d][i]}
+			}
+		}
+		for _, b := range cfg.Builds {
+			jobs <- scanJob{d: ds.Next(), build: b}
+		}
+		close(jobs)
+		workerg.Wait()
+		jflog.Info(fmt.Sprintf("All xray workers completed on DUT(s) %s", ds.Names()))
+		return nil
+	})
+}
+
+// setupXrayWatch enables the indexing of the repos and watches them with the policy
+func setupXrayWatch(d *Dut, cfg XrayCfg, repos []string) error {
+	rec := stats.NewRecorder("xray", d.Name)
+	for _, repo := range repos {
+		start := time.Now()
+		err := remoteartifacts.SetXrayIndex(d.RtDetail, repo)
+		rec.Record("index-repo", start, err)
+		if err != nil {
+			jflog.Error(fmt.Sprintf("Failed to enable the xray indexing of repo %s in DUT %s : %v", repo, d.Name, err))
+			return err
+		}
+	}
+	start := time.Now()
+	err := remoteartifacts.CreateXrayPolicy(d.RtDetail, cfg.PolicyName, cfg.MinSeverity)
+	rec.Record("create-policy", start, err)
+	if err != nil {
+		jflog.Error(fmt.Sprintf("Failed to create xray policy %s for DUT %s : %v", cfg.PolicyName, d.Name, err))
+		return err
+	}
+	if len(repos) == 0 {
+		jflog.Warn(fmt.Sprintf("No repo starting with %s to watch in DUT %s", cfg.RepoPrefix, d.Name))
+		return nil
+	}
+	start = time.Now()
+	err = remoteartifacts.CreateXrayWatch(d.RtDetail, cfg.WatchName, cfg.PolicyName, repos)
+	rec.Record("create-watch", start, err)
+	if err != nil {
+		jflog.Error(fmt.Sprintf("Failed to create xray watch %s for DUT %s : %v", cfg.WatchName, d.Name, err))
+		return err
+	}
+	return nil
+}
+
+// scanArtifact triggers the scan of the item and polls while it is pending or
+// in progress, until it ends or times out. Artifacts Xray does not support, like
+// generic files, and unknown statuses end the polling, recorded as other ops.
+func scanArtifact(cfg XrayCfg, d *Dut, item AqlItem) {
+	rec := stats.NewRecorder("xray", d.Name)
+	itemPath := strings.TrimPrefix(item.RepoPath(), item.Repo+"/")
+	start := time.Now()
+	err := remoteartifacts.ScanArtifact(d.RtDetail, item.Repo, itemPath)
+	rec.Record("trigger-scan", start, err)
+	if err != nil {
+		jflog.Error(fmt.Sprintf("Failed to trigger the scan of %s in DUT %s : %v", item.RepoPath(), d.Name, err))
+		return
+	}
+	deadline := start.Add(time.Duration(cfg.ScanTimeoutSecs) * time.Second)
+	for {
+		op := "scan-artifact"
+		status, err := remoteartifacts.GetArtifactScanStatus(d.RtDetail, item.Repo, itemPath)
+		switch {
+		case err != nil:
+			err = fmt.Errorf("scan status: %v", err)
+		case status == remoteartifacts.XrayScanDone:
+		case status == remoteartifacts.XrayScanFailed:
+			err = fmt.Errorf("scan failed")
+		case status == remoteartifacts.XrayScanNotSupported:
+			op = "scan-not-supported"
+		case status != remoteartifacts.XrayScanPending && status != remoteartifacts.XrayScanScanning && status != remoteartifacts.XrayScanInProgress:
+			op = "scan-unknown-status"
+			err = fmt.Errorf("unknown scan status %q", status)
+		case time.Now().After(deadline):
+			err = fmt.Errorf("scan not done after %ds, status %s", cfg.ScanTimeoutSecs, status)
+		default:
+			time.Sleep(time.Duration(cfg.PollIntervalSecs) * time.Second)
+			continue
+		}
+		rec.Record(op, start, err)
+		if err != nil {
+			jflog.Error(fmt.Sprintf("Failed scan of %s in DUT %s : %v", item.RepoPath(), d.Name, err))
+			return
+		}
+		jflog.Debug(fmt.Sprintf("Scanned %s in DUT %s in %v, status %s", item.RepoPath(), d.Name, time.Since(start), status))
+		return
+	}
+}
+
+// scanBuild scans the build, given as <name>/<number>, waiting for the result
+func scanBuild(d *Dut, build string) {
+	rec := stats.NewRecorder("xray", d.Name)
+	i := strings.LastIndex(build, "/")
+	if i < 0 {
+		jflog.Error(fmt.Sprintf("Invalid build %s, expecting <name>/<number>", build))
+		return
+	}
+	start := time.Now()
+	_, err := (*d.RtMgr).XrayScanBuild(services.XrayScanParams{BuildName: build[:i], BuildNumber: build[i+1:]})
+	rec.Record("scan-build", start, err)
+	if err != nil {
+		jflog.Error(fmt.Sprintf("Failed scan of build %s in DUT %s : %v", build, d.Name, err))
+	}
+}
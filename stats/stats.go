@@ -0,0 +1,174 @@
+package stats
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	jflog "github.com/jfrog/jfrog-client-go/utils/log"
+)
+
+// maxSamples bounds the latencies kept per operation for the percentiles
+const maxSamples = 10000
+
+// key identifies the operations aggregated together
+type key struct {
+	sim string
+	dut string
+	op  string
+}
+
+// opStats aggregates the outcome of one operation
+type opStats struct {
+	count   int64
+	errors  int64
+	bytes   int64
+	total   time.Duration
+	min     time.Duration
+	max     time.Duration
+	samples []time.Duration
+}
+
+var (
+	mu    sync.Mutex
+	ops   = map[key]*opStats{}
+	start = time.Now()
+)
+
+// Recorder records operations of a simulation run against a DUT
+type Recorder struct {
+	Sim string
+	Dut string
+}
+
+// NewRecorder creates a recorder for the simulation and DUT
+func NewRecorder(sim string, dut string) *Recorder {
+	return &Recorder{Sim: sim, Dut: dut}
+}
+
+// Record adds an operation started at start, failed when err is not nil
+func (r *Recorder) Record(op string, start time.Time, err error) {
+	r.Add(op, time.Since(start), 0, err)
+}
+
+// RecordBytes adds an operation that transferred n bytes
+func (r *Recorder) RecordBytes(op string, start time.Time, n int64, err error) {
+	r.Add(op, time.Since(start), n, err)
+}
+
+// Add adds an operation that took d
+func (r *Recorder) Add(op string, d time.Duration, n int64, err error) {
+	k := key{r.Sim, r.Dut, op}
+	mu.Lock()
+	defer mu.Unlock()
+	s, ok := ops[k]
+	if !ok {
+		s = &opStats{min: d}
+		ops[k] = s
+	}
+	s.count++
+	s.bytes += n
+	if err != nil {
+		s.errors++
+	}
+	s.total += d
+	if d < s.min {
+		s.min = d
+	}
+	if d > s.max {
+		s.max = d
+	}
+	// Reservoir sampling keeps a uniform sample of the latencies
+	if len(s.samples) < maxSamples {
+		s.samples = append(s.samples, d)
+	} else if i := rand.Int63n(s.count); i < maxSamples {
+		s.samples[i] = d
+	}
+}
+
+// OpSummary is the report line of one operation of a simulation on a DUT
+type OpSummary struct {
+	Sim    string  `json:"simulation"`
+	Dut    string  `json:"dut"`
+	Op     string  `json:"operation"`
+	Count  int64   `json:"count"`
+	Errors int64   `json:"errors"`
+	Bytes  int64   `json:"bytes"`
+	OpsSec float64 `json:"opsPerSec"`
+	AvgMs  float64 `json:"avgMs"`
+	MinMs  float64 `json:"minMs"`
+	P50Ms  float64 `json:"p50Ms"`
+	P95Ms  float64 `json:"p95Ms"`
+	P99Ms  float64 `json:"p99Ms"`
+	MaxMs  float64 `json:"maxMs"`
+}
+
+func toMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// percentile returns the p-th percentile of sorted latencies
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	return sorted[int(p*float64(len(sorted)-1))]
+}
+
+// Summary returns the summary of every recorded operation, ordered by
+// simulation, DUT and operation
+func Summary() []OpSummary {
+	mu.Lock()
+	defer mu.Unlock()
+	elapsed := time.Since(start).Seconds()
+	summaries := []OpSummary{}
+	for k, s := range ops {
+		sorted := append([]time.Duration{}, s.samples...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		summaries = append(summaries, OpSummary{
+			Sim:    k.sim,
+			Dut:    k.dut,
+			Op:     k.op,
+			Count:  s.count,
+			Errors: s.errors,
+			Bytes:  s.bytes,
+			OpsSec: float64(s.count) / elapsed,
+			AvgMs:  toMs(s.total) / float64(s.count),
+			MinMs:  toMs(s.min),
+			P50Ms:  toMs(percentile(sorted, 0.50)),
+			P95Ms:  toMs(percentile(sorted, 0.95)),
+			P99Ms:  toMs(percentile(sorted, 0.99)),
+			MaxMs:  toMs(s.max),
+		})
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		a, b := summaries[i], summaries[j]
+		if a.Sim != b.Sim {
+			return a.Sim < b.Sim
+		}
+		if a.Dut != b.Dut {
+			return a.Dut < b.Dut
+		}
+		return a.Op < b.Op
+	})
+	return summaries
+}
+
+// LogReport logs the summary broken down per simulation, DUT and operation
+func LogReport() {
+	for _, s := range Summary() {
+		jflog.Info(fmt.Sprintf("Report sim=%s dut=%s op=%s count=%d errors=%d bytes=%d ops/s=%.2f avg=%.1fms min=%.1fms p50=%.1fms p95=%.1fms p99=%.1fms max=%.1fms",
+			s.Sim, s.Dut, s.Op, s.Count, s.Errors, s.Bytes, s.OpsSec, s.AvgMs, s.MinMs, s.P50Ms, s.P95Ms, s.P99Ms, s.MaxMs))
+	}
+}
+
+// WriteReport writes the summary as JSON
+func WriteReport(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(Summary())
+}
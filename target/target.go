@@ -0,0 +1,82 @@
+package target
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// Modes of spreading a simulation load over its target DUTs
+const (
+	// ModeRoundRobin spreads the load of a single run over the DUTs
+	ModeRoundRobin = "roundrobin"
+	// ModeMirrored runs the same load against each DUT at the same time
+	ModeMirrored = "mirrored"
+)
+
+// All selects every configured DUT
+const All = "all"
+
+// Cfg selects the DUTs of a simulation, embedded in each simulation config
+type Cfg struct {
+	Targets    []string `yaml:"targets"`
+	TargetMode string   `yaml:"targetmode"`
+}
+
+// Select returns the indexes in names of the DUTs the config targets, all of
+// them when none is named
+func (c Cfg) Select(names []string) ([]int, error) {
+	all := make([]int, len(names))
+	for i := range names {
+		all[i] = i
+	}
+	if len(c.Targets) == 0 {
+		return all, nil
+	}
+	selected := []int{}
+	for _, target := range c.Targets {
+		if target == All {
+			return all, nil
+		}
+		found := false
+		for i, name := range names {
+			if name == target {
+				selected = append(selected, i)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown target DUT %s", target)
+		}
+	}
+	return selected, nil
+}
+
+// Split groups the selected DUTs into the sets a simulation is run against: a
+// single set sharing the load in round-robin mode, or one set per DUT in
+// mirrored mode
+func (c Cfg) Split(selected []int) ([][]int, error) {
+	switch c.TargetMode {
+	case "", ModeRoundRobin:
+		return [][]int{selected}, nil
+	case ModeMirrored:
+		sets := [][]int{}
+		for _, i := range selected {
+			sets = append(sets, []int{i})
+		}
+		return sets, nil
+	default:
+		return nil, fmt.Errorf("unsupported targetmode %s", c.TargetMode)
+	}
+}
+
+// RoundRobin hands out the indexes of n items in turn, safe for concurrent use
+type RoundRobin struct {
+	next uint64
+}
+
+// Next returns the index of the next of n items
+func (rr *RoundRobin) Next(n int) int {
+	i := atomic.AddUint64(&rr.next, 1) - 1
+	return int(i % uint64(n))
+}
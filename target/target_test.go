@@ -0,0 +1,101 @@
+package target
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestSelect(t *testing.T) {
+	names := []string{"node1", "node2", "node3"}
+	tests := []struct {
+		targets []string
+		want    []int
+		wantErr bool
+	}{
+		{nil, []int{0, 1, 2}, false},
+		{[]string{}, []int{0, 1, 2}, false},
+		{[]string{All}, []int{0, 1, 2}, false},
+		{[]string{"node2"}, []int{1}, false},
+		{[]string{"node3", "node1"}, []int{2, 0}, false},
+		{[]string{"node1", All}, []int{0, 1, 2}, false},
+		{[]string{"node4"}, nil, true},
+		{[]string{"node1", "node4"}, nil, true},
+	}
+	for _, tt := range tests {
+		got, err := Cfg{Targets: tt.targets}.Select(names)
+		if (err != nil) != tt.wantErr || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Select(%v) = %v, %v, want %v, error %v", tt.targets, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		mode     string
+		selected []int
+		want     [][]int
+		wantErr  bool
+	}{
+		{"", []int{0, 1, 2}, [][]int{{0, 1, 2}}, false},
+		{ModeRoundRobin, []int{2, 0}, [][]int{{2, 0}}, false},
+		{ModeRoundRobin, []int{1}, [][]int{{1}}, false},
+		{ModeMirrored, []int{0, 1, 2}, [][]int{{0}, {1}, {2}}, false},
+		{ModeMirrored, []int{1}, [][]int{{1}}, false},
+		{"broadcast", []int{0, 1}, nil, true},
+	}
+	for _, tt := range tests {
+		got, err := Cfg{TargetMode: tt.mode}.Split(tt.selected)
+		if (err != nil) != tt.wantErr || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Split(%q, %v) = %v, %v, want %v, error %v", tt.mode, tt.selected, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestRoundRobin(t *testing.T) {
+	tests := []struct {
+		n     int
+		calls int
+		want  []int
+	}{
+		{1, 3, []int{0, 0, 0}},
+		{2, 5, []int{0, 1, 0, 1, 0}},
+		{3, 7, []int{0, 1, 2, 0, 1, 2, 0}},
+	}
+	for _, tt := range tests {
+		rr := &RoundRobin{}
+		got := []int{}
+		for c := 0; c < tt.calls; c++ {
+			got = append(got, rr.Next(tt.n))
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Next(%d) x%d = %v, want %v", tt.n, tt.calls, got, tt.want)
+		}
+	}
+}
+
+func TestRoundRobinConcurrent(t *testing.T) {
+	const n, workers, perWorker = 3, 8, 300
+	rr := &RoundRobin{}
+	counts := make([]int, n)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for c := 0; c < perWorker; c++ {
+				i := rr.Next(n)
+				mu.Lock()
+				counts[i]++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	for i, c := range counts {
+		if c != workers*perWorker/n {
+			t.Errorf("item %d handed out %d times, want %d", i, c, workers*perWorker/n)
+		}
+	}
+}